@@ -0,0 +1,64 @@
+// Command listener forwards the payment contract's events to the payment service.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Blockchain/config"
+	blockchain "github.com/Blockchain/utils"
+)
+
+func main() {
+	configPath := "config/blockchain_config.yaml"
+	if len(os.Args) > 1 {
+		configPath = os.Args[1]
+	}
+	cfg := config.MustLoadConfig(configPath)
+
+	shutdownTracing, err := blockchain.SetupTracing(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.Printf("Error flushing traces: %v", err)
+		}
+	}()
+
+	messages, err := blockchain.NewAMQPBus(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+	}
+	defer messages.Close()
+
+	// The events only go to the payment service, so there is no in-process consumer
+	listener, err := blockchain.NewEventListener(cfg, nil, messages)
+	if err != nil {
+		log.Fatalf("Failed to start event listener: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Metrics.ListenerAddr != "" {
+		go func() {
+			if err := blockchain.ServeMetrics(ctx, cfg.Metrics.ListenerAddr); err != nil {
+				log.Printf("Metrics server stopped: %v", err)
+			}
+		}()
+	}
+
+	if err := listener.StartListening(ctx); err != nil {
+		log.Fatalf("Event listener stopped: %v", err)
+	}
+	<-ctx.Done()
+	listener.StopListening()
+	log.Println("Event listener stopped.")
+}
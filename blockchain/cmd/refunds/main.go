@@ -0,0 +1,62 @@
+// Command refunds makes the on-chain compensating transfers for refunds issued by the payment service.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Blockchain/config"
+	blockchain "github.com/Blockchain/utils"
+)
+
+func main() {
+	configPath := "config/blockchain_config.yaml"
+	if len(os.Args) > 1 {
+		configPath = os.Args[1]
+	}
+	cfg := config.MustLoadConfig(configPath)
+
+	shutdownTracing, err := blockchain.SetupTracing(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.Printf("Error flushing traces: %v", err)
+		}
+	}()
+
+	messages, err := blockchain.NewAMQPBus(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+	}
+	defer messages.Close()
+
+	worker, err := blockchain.NewRefundWorker(cfg, messages)
+	if err != nil {
+		log.Fatalf("Failed to start refund worker: %v", err)
+	}
+	defer worker.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Metrics.Addr != "" {
+		go func() {
+			if err := blockchain.ServeMetrics(ctx, cfg.Metrics.Addr); err != nil {
+				log.Printf("Metrics server stopped: %v", err)
+			}
+		}()
+	}
+
+	if err := worker.Run(ctx); err != nil {
+		log.Fatalf("Refund worker stopped: %v", err)
+	}
+	log.Println("Refund worker stopped.")
+}
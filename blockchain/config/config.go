@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -28,7 +29,26 @@ type BlockchainConfig struct {
 		Password string `yaml:"password"` // RabbitMQ password
 		Exchange string `yaml:"exchange"` // RabbitMQ exchange name
 		Queue    string `yaml:"queue"`    // RabbitMQ queue name
+
+		MaxAttempts int           `yaml:"max_attempts"` // Times a message is handled before it is dead-lettered; 0 means 5
+		RetryDelay  time.Duration `yaml:"retry_delay"`  // Wait before a failed message is retried, doubling with every attempt; 0 means 1s
+
+		ConfirmTimeout time.Duration `yaml:"confirm_timeout"` // How long publishing waits for the broker to confirm a message; 0 means 5s
+		Prefetch       int           `yaml:"prefetch"`        // Messages each subscriber may hold unacknowledged; 0 means 10
 	} `yaml:"rabbitmq"`
+	Refunds struct {
+		JournalDir string `yaml:"journal_dir"` // Directory keeping the signed refund transfers; empty means data/refunds
+	} `yaml:"refunds"`
+	Metrics struct {
+		Addr         string `yaml:"addr"`          // Address the refund worker serves /metrics on for Prometheus; empty disables it
+		ListenerAddr string `yaml:"listener_addr"` // Address the event listener serves /metrics on; empty disables it
+	} `yaml:"metrics"`
+	Tracing struct {
+		Exporter     string  `yaml:"exporter"`      // none, stdout or otlp; empty means none
+		OTLPEndpoint string  `yaml:"otlp_endpoint"` // host:port of the OTLP/gRPC collector
+		OTLPInsecure bool    `yaml:"otlp_insecure"` // Connect to the collector without TLS
+		SampleRatio  float64 `yaml:"sample_ratio"`  // Share of new traces recorded; 0 is treated as 1
+	} `yaml:"tracing"`
 }
 
 // LoadConfig loads the configuration from a YAML file
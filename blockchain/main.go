@@ -12,6 +12,8 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+
+	blockchain "github.com/Blockchain/utils"
 )
 
 var url = "https://holesky.infura.io/v3/6e169b79ad1847e083e71343dfafbf06"
@@ -24,8 +26,8 @@ func main() {
 	}
 	defer client.Close()
 
-	// User input for fiat-to-crypto conversion
-	var fiatAmount float64
+	// User input for fiat-to-crypto conversion (the amount is kept as a string so it is never rounded through a float)
+	var fiatAmount string
 	var senderFiat, receiverFiat string
 
 	fmt.Print("Enter amount in sender's fiat currency: ")
@@ -35,16 +37,23 @@ func main() {
 	fmt.Print("Enter receiver's fiat currency (e.g., eur): ")
 	fmt.Scanln(&receiverFiat)
 
-	// Get conversion rate from fiat to Ethereum
-	ethRate, err := getConversionRate(senderFiat, "ethereum")
+	// Parse the amount exactly, rejecting more decimal places than the sender's currency has
+	amount, err := blockchain.ParseFiatAmount(fiatAmount, senderFiat)
+	if err != nil {
+		log.Fatalf("Invalid amount: %v", err)
+	}
+
+	// Get the price of one Ether in the sender's fiat currency
+	ethRate, err := getConversionRate("ethereum", senderFiat)
 	if err != nil {
 		log.Fatalf("Failed to fetch Ethereum conversion rate: %v", err)
 	}
 
-	// Calculate equivalent Ether in Wei
-	amountInEther := big.NewFloat(fiatAmount / ethRate)
-	amountInWei := new(big.Int)
-	amountInEther.Mul(amountInEther, big.NewFloat(1e18)).Int(amountInWei)
+	// Calculate equivalent Ether in Wei (rounded down so the sender never pays more than requested)
+	amountInWei, err := blockchain.FiatToWei(amount, ethRate)
+	if err != nil {
+		log.Fatalf("Failed to convert amount to Wei: %v", err)
+	}
 
 	// Wallet details
 	sender := "6c50E2d7ddB983451bCab2438D3Ed03E5F01B2cE"
@@ -69,8 +78,12 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to fetch receiver's fiat conversion rate: %v", err)
 	}
-	amountReceived := new(big.Float).Mul(new(big.Float).SetInt(amountInWei), big.NewFloat(receiverRate/1e18))
-	fmt.Printf("Receiver will receive approximately %.2f %s\n", amountReceived, receiverFiat)
+	// Quote it to the receiver's currency precision, ties to even
+	amountReceived, err := blockchain.WeiToFiat(amountInWei, receiverRate, receiverFiat, blockchain.RoundHalfEven)
+	if err != nil {
+		log.Fatalf("Failed to convert Wei to receiver's currency: %v", err)
+	}
+	fmt.Printf("Receiver will receive approximately %s %s\n", amountReceived, receiverFiat)
 }
 
 func checkBalances(client *ethclient.Client, sender, receiver string) {
@@ -93,8 +106,7 @@ func getWalletBalance(client *ethclient.Client, address string) (*big.Int, error
 }
 
 func weiToEther(wei *big.Int) string {
-	ether := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18))
-	return ether.Text('f', 18)
+	return blockchain.WeiToEther(wei)
 }
 
 func sendTransaction(client *ethclient.Client, sender, receiver string, amount *big.Int, privateKeyHex string) (string, error) {
@@ -135,18 +147,30 @@ func sendTransaction(client *ethclient.Client, sender, receiver string, amount *
 	return signedTx.Hash().Hex(), nil
 }
 
-func getConversionRate(fromCurrency, toCurrency string) (float64, error) {
+// getConversionRate returns the price of one unit of fromCurrency in toCurrency as an exact rational,
+// decoding the JSON number directly so it never passes through a float64
+func getConversionRate(fromCurrency, toCurrency string) (*big.Rat, error) {
 	apiURL := fmt.Sprintf("https://api.coingecko.com/api/v3/simple/price?ids=%s&vs_currencies=%s", fromCurrency, toCurrency)
 	resp, err := http.Get(apiURL)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var result map[string]map[string]float64
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, err
+	var result map[string]map[string]json.Number
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
 	}
 
-	return result[fromCurrency][toCurrency], nil
+	price, ok := result[fromCurrency][toCurrency]
+	if !ok {
+		return nil, fmt.Errorf("no %s price for %s", toCurrency, fromCurrency)
+	}
+	rate, ok := new(big.Rat).SetString(price.String())
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid %s price for %s: %s", toCurrency, fromCurrency, price)
+	}
+	return rate, nil
 }
@@ -0,0 +1,510 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Blockchain/config"
+	"github.com/Go-payments/bus"
+	amqp091 "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPBus is a bus.Bus carried by RabbitMQ. Queues are durable and messages persistent, as the payment
+// service declares and expects them. Publishing waits for the broker to confirm it has taken the
+// message, and a lost connection is re-established in the background, after which subscribers resume.
+// Failed messages are retried through delay queues and dead-lettered the way the payment service does
+// it, so its dlq command works on this service's queues too.
+type AMQPBus struct {
+	url            string
+	maxAttempts    int           // Times a message is handled before it is dead-lettered
+	retryDelay     time.Duration // Wait before the first retry, doubling with every attempt
+	confirmTimeout time.Duration // How long a publish waits for the broker's confirmation
+	prefetch       int           // Messages each subscriber may hold unacknowledged
+
+	mu        sync.Mutex
+	conn      *amqp091.Connection // Current connection, replaced when it is lost
+	publisher *confirmChannel     // Channel publishing in confirm mode, reopened when it is closed
+	closed    bool                // Set by Close, stops the recovery
+}
+
+var _ bus.Bus = (*AMQPBus)(nil)
+
+// Backoff between attempts to re-establish a lost connection or subscription
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Defaults of the settings left unconfigured
+const (
+	DefaultMaxAttempts    = 5               // Times a message is handled before it is dead-lettered, as in the payment service
+	DefaultRetryDelay     = time.Second     // Wait before the first retry, as in the payment service
+	DefaultConfirmTimeout = 5 * time.Second // How long publishing waits for the broker's confirmation
+	DefaultPrefetch       = 10              // Messages each subscriber may hold unacknowledged
+)
+
+// errNotConnected is returned while the connection is lost and not yet re-established
+var errNotConnected = errors.New("not connected to RabbitMQ")
+
+// NewAMQPBus connects to the RabbitMQ server described by the config; the connection is
+// re-established in the background whenever it is lost
+func NewAMQPBus(cfg *config.BlockchainConfig) (*AMQPBus, error) {
+	url := fmt.Sprintf("amqp://%s:%s@%s:%d/",
+		cfg.RabbitMQ.Username,
+		cfg.RabbitMQ.Password,
+		cfg.RabbitMQ.Host,
+		cfg.RabbitMQ.Port,
+	)
+	conn, err := amqp091.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+	}
+
+	maxAttempts, retryDelay, confirmTimeout := cfg.RabbitMQ.MaxAttempts, cfg.RabbitMQ.RetryDelay, cfg.RabbitMQ.ConfirmTimeout
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if retryDelay <= 0 {
+		retryDelay = DefaultRetryDelay
+	}
+	if confirmTimeout <= 0 {
+		confirmTimeout = DefaultConfirmTimeout
+	}
+	prefetch := cfg.RabbitMQ.Prefetch
+	if prefetch <= 0 {
+		prefetch = DefaultPrefetch
+	}
+	b := &AMQPBus{
+		url:            url,
+		maxAttempts:    maxAttempts,
+		retryDelay:     retryDelay,
+		confirmTimeout: confirmTimeout,
+		prefetch:       prefetch,
+		conn:           conn,
+	}
+	go b.reconnect(conn.NotifyClose(make(chan *amqp091.Error, 1)))
+	return b, nil
+}
+
+// reconnect waits for the connection to be lost, as reported on closed, then dials again with backoff
+// until it succeeds or Close is called
+func (b *AMQPBus) reconnect(closed chan *amqp091.Error) {
+	err := <-closed
+	if err == nil {
+		return // Closed by Close
+	}
+	log.Printf("Lost connection to RabbitMQ: %v", err)
+
+	delay := minReconnectDelay
+	for {
+		time.Sleep(delay)
+		if b.isClosed() {
+			return
+		}
+
+		conn, err := amqp091.Dial(b.url)
+		if err != nil {
+			log.Printf("Failed to reconnect to RabbitMQ, retrying in %s: %v", delay, err)
+			delay = min(2*delay, maxReconnectDelay)
+			continue
+		}
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return
+		}
+		b.conn = conn
+		b.publisher = nil // Opened again on the new connection by the next publish
+		b.mu.Unlock()
+
+		queueReconnects.Inc()
+		log.Println("Reconnected to RabbitMQ")
+		go b.reconnect(conn.NotifyClose(make(chan *amqp091.Error, 1)))
+		return
+	}
+}
+
+func (b *AMQPBus) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// channel opens a channel on the current connection
+func (b *AMQPBus) channel() (*amqp091.Channel, error) {
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+
+	if conn.IsClosed() {
+		return nil, errNotConnected
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RabbitMQ channel: %v", err)
+	}
+	return ch, nil
+}
+
+// declareQueue declares a durable queue, as the payment service does
+func declareQueue(ch *amqp091.Channel, queue string) error {
+	if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %v", queue, err)
+	}
+	return nil
+}
+
+// declareRetryQueues declares the dead-letter queue of queue and one retry queue per delay. A retry
+// queue has no consumer: its messages expire after the delay and are dead-lettered back to queue.
+func (b *AMQPBus) declareRetryQueues(ch *amqp091.Channel, queue string) error {
+	if err := declareQueue(ch, bus.DeadLetterQueue(queue)); err != nil {
+		return err
+	}
+	for attempts := 1; attempts < b.maxAttempts; attempts++ {
+		delay := bus.RetryDelay(b.retryDelay, attempts)
+		name := bus.RetryQueue(queue, delay)
+		_, err := ch.QueueDeclare(name, true, false, false, false, amqp091.Table(bus.RetryQueueArguments(queue, delay)))
+		if err != nil {
+			return fmt.Errorf("failed to declare queue %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Publish sends msg to a queue as a persistent message, with the trace context of ctx in its headers,
+// and returns once the broker has confirmed it, so a nil error means the message is safe with the
+// broker. It fails if no confirmation comes within the confirm timeout; the message may then still
+// have been taken, so a caller retrying it may publish it twice.
+func (b *AMQPBus) Publish(ctx context.Context, queue string, msg bus.Message) error {
+	return b.publish(ctx, queue, true, amqp091.Publishing{
+		ContentType: msg.ContentType,
+		MessageId:   msg.ID,
+		Timestamp:   time.Now(),
+		Body:        msg.Body,
+	})
+}
+
+// publish sends a persistent message to a queue, declaring the queue first if declare is set, adding
+// the trace context of ctx to its headers, and waits for the broker's confirmation. Retry queues are
+// declared with arguments by their subscriber and must not be declared here without them.
+func (b *AMQPBus) publish(ctx context.Context, queue string, declare bool, msg amqp091.Publishing) (err error) {
+	span, headers := startPublishSpan(ctx, queue)
+	defer func() { endSpan(span, err) }()
+	defer func() { queueMessages.WithLabelValues(queue, "published", resultLabel(err)).Inc() }()
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	msg.Headers = headers
+	msg.DeliveryMode = amqp091.Persistent // Survives a broker restart, like the durable queue
+
+	publisher, err := b.confirmChannel()
+	if err != nil {
+		return err
+	}
+	confirmed, err := publisher.publish(ctx, queue, declare, msg)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(b.confirmTimeout)
+	defer timeout.Stop()
+	select {
+	case ack, ok := <-confirmed:
+		if !ok {
+			return errors.New("channel closed before the broker confirmed the message")
+		}
+		if !ack {
+			return errors.New("broker rejected the message")
+		}
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("broker did not confirm the message within %s", b.confirmTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// confirmChannel returns the channel messages are published on, opening it on the current connection
+// if there is none yet or the previous one was closed
+func (b *AMQPBus) confirmChannel() (*confirmChannel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.publisher != nil && !b.publisher.isClosed() {
+		return b.publisher, nil
+	}
+	if b.conn.IsClosed() {
+		return nil, errNotConnected
+	}
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RabbitMQ channel: %v", err)
+	}
+	publisher, err := newConfirmChannel(ch)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	b.publisher = publisher
+	return publisher, nil
+}
+
+// confirmChannel is a channel in confirm mode, which hands every publisher the broker's confirmation
+// of its own message
+type confirmChannel struct {
+	ch *amqp091.Channel
+
+	publishMu sync.Mutex      // Serializes publishes, so delivery tags are known
+	nextTag   uint64          // Delivery tag of the next message published
+	declared  map[string]bool // Queues already declared on this channel
+
+	pendingMu sync.Mutex
+	pending   map[uint64]chan bool // Waiting publishers by delivery tag; nil once the channel is closed
+}
+
+func newConfirmChannel(ch *amqp091.Channel) (*confirmChannel, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to put the channel in confirm mode: %v", err)
+	}
+	cc := &confirmChannel{
+		ch:       ch,
+		nextTag:  1,
+		declared: map[string]bool{},
+		pending:  map[uint64]chan bool{},
+	}
+	go cc.dispatch(ch.NotifyPublish(make(chan amqp091.Confirmation, 64)))
+	return cc, nil
+}
+
+// dispatch passes each confirmation to the publisher waiting for it. Once the channel is closed, the
+// publishers still waiting are told their message was not confirmed.
+func (cc *confirmChannel) dispatch(confirmations chan amqp091.Confirmation) {
+	for confirmation := range confirmations {
+		cc.pendingMu.Lock()
+		waiter := cc.pending[confirmation.DeliveryTag]
+		delete(cc.pending, confirmation.DeliveryTag)
+		cc.pendingMu.Unlock()
+
+		if waiter != nil {
+			waiter <- confirmation.Ack
+		}
+	}
+
+	cc.pendingMu.Lock()
+	for _, waiter := range cc.pending {
+		close(waiter)
+	}
+	cc.pending = nil
+	cc.pendingMu.Unlock()
+}
+
+func (cc *confirmChannel) isClosed() bool {
+	cc.pendingMu.Lock()
+	defer cc.pendingMu.Unlock()
+	return cc.pending == nil
+}
+
+// publish publishes msg to a queue, first declaring the queue if declare is set and it was not
+// declared on this channel yet. The returned channel receives whether the broker took the message, or
+// is closed if the channel closes before the broker answers.
+func (cc *confirmChannel) publish(ctx context.Context, queue string, declare bool, msg amqp091.Publishing) (<-chan bool, error) {
+	cc.publishMu.Lock()
+	defer cc.publishMu.Unlock()
+
+	if declare && !cc.declared[queue] {
+		if err := declareQueue(cc.ch, queue); err != nil {
+			return nil, err
+		}
+		cc.declared[queue] = true
+	}
+
+	// Register before publishing, since the confirmation may arrive before the publish returns
+	tag := cc.nextTag
+	confirmed := make(chan bool, 1) // Buffered, so dispatch never waits for a publisher that gave up
+	cc.pendingMu.Lock()
+	if cc.pending == nil {
+		cc.pendingMu.Unlock()
+		return nil, errors.New("channel closed")
+	}
+	cc.pending[tag] = confirmed
+	cc.pendingMu.Unlock()
+
+	err := cc.ch.PublishWithContext(ctx,
+		"",    // Default exchange
+		queue, // Routing key (queue name)
+		false, // Mandatory
+		false, // Immediate
+		msg,
+	)
+	if err != nil {
+		cc.pendingMu.Lock()
+		delete(cc.pending, tag)
+		cc.pendingMu.Unlock()
+		return nil, fmt.Errorf("failed to publish message: %v", err)
+	}
+	cc.nextTag++
+	return confirmed, nil
+}
+
+// Subscribe calls handle for the messages of a queue, one at a time, until ctx is canceled; up to the
+// prefetch count are delivered ahead of handling. Each message is acknowledged once handled, so one
+// received but not handled when the service stops is delivered again. A message whose handler fails
+// is retried after a delay, and moved to the queue's dead-letter queue once its attempts are used up
+// or the failure is permanent, with the error in its x-last-error header. If the channel or the
+// connection to RabbitMQ is lost, consuming resumes once it can be re-established, and the broker
+// redelivers the messages that were not yet acknowledged. Subscribe fails only if the queue cannot be
+// consumed at first.
+func (b *AMQPBus) Subscribe(ctx context.Context, queue string, handle bus.Handler) error {
+	ch, msgs, err := b.consume(queue)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if ch != nil {
+			ch.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Printf("Channel consuming %s closed, resubscribing", queue)
+				ch.Close()
+				if ch, msgs = b.resubscribe(ctx, queue); ch == nil {
+					return nil
+				}
+				continue
+			}
+
+			msgCtx, span := startConsumerSpan(context.WithoutCancel(ctx), queue, msg)
+			err := handle(msgCtx, bus.Message{
+				ID:          msg.MessageId,
+				ContentType: msg.ContentType,
+				Body:        msg.Body,
+				PublishedAt: msg.Timestamp,
+			})
+			endSpan(span, err)
+			queueMessages.WithLabelValues(queue, "consumed", resultLabel(err)).Inc()
+			b.settle(msgCtx, queue, msg, err)
+		}
+	}
+}
+
+// consume opens a channel on the current connection, declares the queue with its retry and dead-letter
+// queues on it, and starts consuming the queue, limited to the prefetch count
+func (b *AMQPBus) consume(queue string) (*amqp091.Channel, <-chan amqp091.Delivery, error) {
+	ch, err := b.channel()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ch.Qos(b.prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to set prefetch count: %v", err)
+	}
+	if err := declareQueue(ch, queue); err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	if err := b.declareRetryQueues(ch, queue); err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	msgs, err := ch.Consume(queue, "", false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to consume %s: %v", queue, err)
+	}
+	return ch, msgs, nil
+}
+
+// resubscribe consumes the queue again, retrying with backoff while the connection is being
+// re-established. It returns a nil channel once ctx is canceled.
+func (b *AMQPBus) resubscribe(ctx context.Context, queue string) (*amqp091.Channel, <-chan amqp091.Delivery) {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-time.After(delay):
+		}
+
+		ch, msgs, err := b.consume(queue)
+		if err == nil {
+			log.Printf("Resubscribed to %s", queue)
+			return ch, msgs
+		}
+		log.Printf("Failed to resubscribe to %s, retrying in %s: %v", queue, delay, err)
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
+
+// settle acknowledges a handled message. If handling failed with err, the message is first moved to a
+// retry queue, from which it is delivered again after a delay that doubles with every attempt, or to the
+// dead-letter queue once the attempts are used up or err is permanent. The failure is recorded in the
+// headers the payment service uses, so its dlq command can list and replay the message. If the move
+// fails, the message is returned to the queue.
+func (b *AMQPBus) settle(ctx context.Context, queue string, msg amqp091.Delivery, err error) {
+	if err != nil {
+		failed := bus.Attempts(msg.Headers) + 1
+		headers := amqp091.Table{}
+		for key, value := range msg.Headers {
+			headers[key] = value
+		}
+		headers[bus.AttemptsHeader] = int32(failed)
+		headers[bus.LastErrorHeader] = err.Error()
+
+		target := bus.DeadLetterQueue(queue)
+		if !bus.IsPermanent(err) && failed < b.maxAttempts {
+			target = bus.RetryQueue(queue, bus.RetryDelay(b.retryDelay, failed))
+			log.Printf("Retrying message from %s in %s (attempt %d of %d): %v", queue, bus.RetryDelay(b.retryDelay, failed), failed, b.maxAttempts, err)
+		} else {
+			headers[bus.DeadLetteredAtHeader] = time.Now().UTC()
+			log.Printf("Dead-lettering message from %s after %d attempts: %v", queue, failed, err)
+		}
+
+		moveErr := b.publish(ctx, target, false, amqp091.Publishing{
+			Headers:       headers,
+			ContentType:   msg.ContentType,
+			CorrelationId: msg.CorrelationId,
+			MessageId:     msg.MessageId,
+			Timestamp:     msg.Timestamp,
+			Type:          msg.Type,
+			Body:          msg.Body,
+		})
+		if moveErr != nil {
+			log.Printf("Failed to move message from %s to %s, requeuing it: %v", queue, target, moveErr)
+			if nackErr := msg.Nack(false, true); nackErr != nil {
+				log.Printf("Failed to requeue message from %s: %v", queue, nackErr)
+			}
+			return
+		}
+	}
+	if ackErr := msg.Ack(false); ackErr != nil {
+		log.Printf("Failed to acknowledge message from %s: %v", queue, ackErr)
+	}
+}
+
+// Close closes the connection to RabbitMQ and its channels for good
+func (b *AMQPBus) Close() {
+	b.mu.Lock()
+	b.closed = true
+	conn := b.conn
+	b.mu.Unlock()
+
+	if err := conn.Close(); err != nil && !errors.Is(err, amqp091.ErrClosed) {
+		log.Printf("Failed to close RabbitMQ connection: %v", err)
+	}
+}
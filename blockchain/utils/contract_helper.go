@@ -44,8 +44,10 @@ func InitClient(rpcURL, contractAddr, contractABIPath string) (*ethclient.Client
     return client, parsedABI, common.HexToAddress(contractAddr), nil
 }
 
-// SendPayment sends ETH from the sender to the receiver using the smart contract.
+// SendPayment sends ETH from the sender to the receiver using the smart contract. Each node call
+// is traced as a child of the span in ctx.
 func SendPayment(
+	ctx context.Context,
 	client *ethclient.Client,
 	senderKey *ecdsa.PrivateKey,
 	contractAddress common.Address,
@@ -60,19 +62,27 @@ func SendPayment(
 	fmt.Printf("Sending payment to receiver: %s\n", receiverAddress.Hex())
 
 	// Get nonce for the sender
-	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	var nonce uint64
+	err := traceEthCall(ctx, "eth_getTransactionCount", func(ctx context.Context) (err error) {
+		nonce, err = client.PendingNonceAt(ctx, senderAddress)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get nonce: %v", err)
 	}
 
 	// Get gas price from the network
-	gasPrice, err := client.SuggestGasPrice(context.Background())
+	var gasPrice *big.Int
+	err = traceEthCall(ctx, "eth_gasPrice", func(ctx context.Context) (err error) {
+		gasPrice, err = client.SuggestGasPrice(ctx)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to suggest gas price: %v", err)
 	}
 
 	// Pack contract function call with parameters
-	data, err := parsedABI.Pack("sendPayment", receiverAddress, amount) // Adjust function signature if needed
+	data, err := parsedABI.Pack("sendPayment", receiverAddress) // The amount is paid as the call's value
 	if err != nil {
 		return nil, fmt.Errorf("failed to pack transaction data: %v", err)
 	}
@@ -83,17 +93,20 @@ func SendPayment(
 			From:     senderAddress,
 			To:       &contractAddress,
 			GasPrice: gasPrice,
-			Value:    big.NewInt(0), // Ether value sent (0 unless required)
+			Value:    amount, // Ether paid to the receiver through the contract
 			Data:     data,
 		}
-		gasLimit, err = client.EstimateGas(context.Background(), callMsg)
+		err = traceEthCall(ctx, "eth_estimateGas", func(ctx context.Context) (err error) {
+			gasLimit, err = client.EstimateGas(ctx, callMsg)
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to estimate gas: %v", err)
 		}
 	}
 
-	// Create the transaction (value set to 0 unless sending Ether directly)
-	tx := types.NewTransaction(nonce, contractAddress, big.NewInt(0), gasLimit, gasPrice, data)
+	// Create the transaction; sendPayment is payable and forwards the value to the receiver
+	tx := types.NewTransaction(nonce, contractAddress, amount, gasLimit, gasPrice, data)
 
 	// Sign the transaction
 	signer := types.NewEIP155Signer(chainID)
@@ -103,7 +116,10 @@ func SendPayment(
 	}
 
 	// Send the transaction to the Ethereum network
-	err = client.SendTransaction(context.Background(), signedTx)
+	err = traceEthCall(ctx, "eth_sendRawTransaction", func(ctx context.Context) error {
+		return client.SendTransaction(ctx, signedTx)
+	})
+	txSubmitted.WithLabelValues(TxKindPayment, resultLabel(err)).Inc()
 	if err != nil {
 		return nil, fmt.Errorf("failed to send transaction: %v", err)
 	}
@@ -114,6 +130,61 @@ func SendPayment(
 
 
 
+// SignTransfer signs a plain Ether transfer from the key's address to the receiver, using the next
+// nonce of the sender, without sending it
+func SignTransfer(
+	ctx context.Context,
+	client *ethclient.Client,
+	senderKey *ecdsa.PrivateKey,
+	receiverAddress common.Address,
+	amount *big.Int,
+	chainID *big.Int,
+) (*types.Transaction, error) {
+	senderAddress := crypto.PubkeyToAddress(senderKey.PublicKey)
+
+	// Get nonce for the sender
+	var nonce uint64
+	err := traceEthCall(ctx, "eth_getTransactionCount", func(ctx context.Context) (err error) {
+		nonce, err = client.PendingNonceAt(ctx, senderAddress)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %v", err)
+	}
+
+	// Get gas price from the network
+	var gasPrice *big.Int
+	err = traceEthCall(ctx, "eth_gasPrice", func(ctx context.Context) (err error) {
+		gasPrice, err = client.SuggestGasPrice(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest gas price: %v", err)
+	}
+
+	// A plain transfer always costs 21000 gas
+	tx := types.NewTransaction(nonce, receiverAddress, amount, 21000, gasPrice, nil)
+
+	// Sign the transaction
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), senderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	return signedTx, nil
+}
+
+// SendSignedTransaction sends a signed transaction to the Ethereum network, counting it under kind
+func SendSignedTransaction(ctx context.Context, client *ethclient.Client, signedTx *types.Transaction, kind string) error {
+	err := traceEthCall(ctx, "eth_sendRawTransaction", func(ctx context.Context) error {
+		return client.SendTransaction(ctx, signedTx)
+	})
+	txSubmitted.WithLabelValues(kind, resultLabel(err)).Inc()
+	if err != nil {
+		return fmt.Errorf("failed to send transaction: %v", err)
+	}
+	return nil
+}
+
 // GetPaymentDetails retrieves the details of a payment using its ID.
 func GetPaymentDetails(paymentID uint64) (common.Address, common.Address, *big.Int, uint64, error) {
 	// Pack function call data
@@ -0,0 +1,47 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Go-payments/bus/memory"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestProcessLogForwardsOnlyPaymentSentLogsStillOnChain(t *testing.T) {
+	contractABI := loadPaymentABI(t)
+	event := contractABI.Events["PaymentSent"]
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(250000000000000000), big.NewInt(1700000000))
+	if err != nil {
+		t.Fatalf("failed to pack event: %v", err)
+	}
+	sender, receiver := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	topics := []common.Hash{event.ID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())}
+
+	messages := memory.NewBus(3, time.Millisecond)
+	listener := &EventListener{contractABI: contractABI, publisher: messages}
+
+	sent := types.Log{TxHash: common.HexToHash("0xabc"), Index: 0, Topics: topics, Data: data}
+	removed := sent
+	removed.Removed = true // Rolled back by a reorg
+	for _, vLog := range []types.Log{
+		removed,
+		{TxHash: common.HexToHash("0xabc"), Index: 1, Data: data},                                        // No topics
+		{TxHash: common.HexToHash("0xabc"), Index: 2, Topics: topics[:1], Data: data},                    // Indexed fields missing
+		{TxHash: common.HexToHash("0xabc"), Index: 3, Topics: []common.Hash{common.HexToHash("0xdead")}}, // Some other event
+		sent,
+	} {
+		listener.processLog(context.Background(), vLog)
+	}
+
+	pending := messages.Pending(PaymentEventQueue)
+	if len(pending) != 1 {
+		t.Fatalf("%d events forwarded, want only the PaymentSent log still on chain", len(pending))
+	}
+	if pending[0].ID != LogEventID(sent) {
+		t.Errorf("forwarded event %s, want the one of log %d", pending[0].ID, sent.Index)
+	}
+}
@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Blockchain/events/eventspb"
+	"github.com/Go-payments/bus"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EventContentType marks a message holding an event envelope (see events/events.proto, shared with the
+// payment service)
+const EventContentType = "application/cloudevents+protobuf"
+
+// Event types, each naming its payload message in events/events.proto; they must match the payment
+// service's
+const (
+	EventPaymentStatusUpdate = "payments.payment.status_update" // eventspb.PaymentStatusUpdate
+	EventChainPaymentSent    = "blockchain.payment.sent"        // eventspb.ChainPaymentSent
+	EventRefundRequested     = "payments.refund.requested"      // eventspb.RefundRequested
+	EventRefundResult        = "blockchain.refund.result"       // eventspb.RefundResult
+)
+
+// eventSchemaVersions holds the payload schema version of every event type this service knows. When a
+// type gets a new version, UnmarshalEvent must learn to convert the older versions still in flight.
+var eventSchemaVersions = map[string]uint32{
+	EventPaymentStatusUpdate: 1,
+	EventChainPaymentSent:    1,
+	EventRefundRequested:     1,
+	EventRefundResult:        1,
+}
+
+// Event holds the attributes of a decoded envelope
+type Event struct {
+	ID            string
+	Type          string
+	Source        string
+	SchemaVersion uint32
+	CorrelationID string
+	Time          time.Time
+}
+
+// NewEventMessage wraps payload in a new envelope of eventType, correlated with the other events of the
+// same payment or refund by correlationID, ready to be published. The event gets a random ID, which
+// suits only events without a natural key; see NewEventMessageWithID.
+func NewEventMessage(eventType, correlationID string, payload proto.Message) (bus.Message, error) {
+	return NewEventMessageWithID(uuid.NewString(), eventType, correlationID, payload)
+}
+
+// NewEventMessageWithID is NewEventMessage for an event whose ID is derived from what it reports, so
+// that reporting the same thing again, e.g. a contract log forwarded again after a restart, gives the
+// same ID and the payment service's inbox skips it
+func NewEventMessageWithID(id, eventType, correlationID string, payload proto.Message) (bus.Message, error) {
+	version, ok := eventSchemaVersions[eventType]
+	if !ok {
+		return bus.Message{}, fmt.Errorf("unknown event type %q", eventType)
+	}
+	data, err := proto.Marshal(payload)
+	if err != nil {
+		return bus.Message{}, fmt.Errorf("failed to marshal %s payload: %v", eventType, err)
+	}
+
+	body, err := proto.Marshal(&eventspb.Envelope{
+		Id:            id,
+		Type:          eventType,
+		Source:        ServiceName,
+		SchemaVersion: version,
+		CorrelationId: correlationID,
+		Time:          timestamppb.Now(),
+		Data:          data,
+	})
+	if err != nil {
+		return bus.Message{}, fmt.Errorf("failed to marshal %s envelope: %v", eventType, err)
+	}
+	return bus.Message{ID: id, ContentType: EventContentType, Body: body}, nil
+}
+
+// LogEventID returns the ID of the event reporting a contract log: the SHA-256 of its transaction hash
+// and log index, which stay the same however often the log is received
+func LogEventID(vLog types.Log) string {
+	var index [8]byte
+	binary.BigEndian.PutUint64(index[:], uint64(vLog.Index))
+	sum := sha256.Sum256(append(vLog.TxHash.Bytes(), index[:]...))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefundResultEventID returns the ID of the event reporting a refund's outcome: the SHA-256 of the
+// refund ID and the transfer's hash, the zero hash for a refund that failed before a transfer was sent.
+// It is the same for every command delivery reporting that outcome.
+func RefundResultEventID(refundID string, txHash common.Hash) string {
+	sum := sha256.Sum256(append([]byte(refundID), txHash.Bytes()...))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsEvent reports whether msg holds an event envelope. Messages published before the envelope was
+// introduced carry their payload bare.
+func IsEvent(msg bus.Message) bool {
+	return msg.ContentType == EventContentType
+}
+
+// UnmarshalEvent decodes the envelope in msg, which must hold an event of eventType, into payload and
+// returns its attributes. A payload of a newer schema version than this service knows is decoded as the
+// newest version it knows, ignoring the fields it does not.
+func UnmarshalEvent(msg bus.Message, eventType string, payload proto.Message) (Event, error) {
+	var envelope eventspb.Envelope
+	if err := proto.Unmarshal(msg.Body, &envelope); err != nil {
+		return Event{}, fmt.Errorf("malformed event envelope: %v", err)
+	}
+	event := Event{
+		ID:            envelope.Id,
+		Type:          envelope.Type,
+		Source:        envelope.Source,
+		SchemaVersion: max(envelope.SchemaVersion, 1),
+		CorrelationID: envelope.CorrelationId,
+		Time:          envelope.Time.AsTime(),
+	}
+	if event.Type != eventType {
+		return event, fmt.Errorf("expected a %s event, got %q", eventType, event.Type)
+	}
+	if event.ID == "" {
+		return event, errors.New("event has no id")
+	}
+
+	if known := eventSchemaVersions[eventType]; event.SchemaVersion > known {
+		if _, seen := warnedEventVersions.LoadOrStore(fmt.Sprintf("%s/%d", eventType, event.SchemaVersion), true); !seen {
+			log.Printf("Received %s events of schema version %d, decoding them as version %d", eventType, event.SchemaVersion, known)
+		}
+	}
+	if err := proto.Unmarshal(envelope.Data, payload); err != nil {
+		return event, fmt.Errorf("malformed %s event %s (schema version %d): %v", eventType, event.ID, event.SchemaVersion, err)
+	}
+	return event, nil
+}
+
+// warnedEventVersions holds the newer schema versions already logged, by event type and version
+var warnedEventVersions sync.Map
@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/Blockchain/events/eventspb"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestLogEventIDIsStableForTheSameLog(t *testing.T) {
+	vLog := types.Log{TxHash: common.HexToHash("0xabc"), Index: 3, BlockNumber: 100}
+
+	// The same log received again, e.g. after resubscribing, keeps its ID
+	again := vLog
+	again.BlockNumber = 101
+	if LogEventID(vLog) != LogEventID(again) {
+		t.Error("LogEventID differs for the same transaction and log index")
+	}
+
+	other := vLog
+	other.Index = 4
+	if LogEventID(vLog) == LogEventID(other) {
+		t.Error("LogEventID is the same for two logs of one transaction")
+	}
+}
+
+func TestNewEventMessageWithID(t *testing.T) {
+	id := LogEventID(types.Log{TxHash: common.HexToHash("0xabc"), Index: 3})
+	msg, err := NewEventMessageWithID(id, EventChainPaymentSent, "0xabc", &eventspb.ChainPaymentSent{TxHash: "0xabc"})
+	if err != nil {
+		t.Fatalf("NewEventMessageWithID: %v", err)
+	}
+	if msg.ID != id {
+		t.Errorf("message ID = %q, want %q", msg.ID, id)
+	}
+
+	var payload eventspb.ChainPaymentSent
+	event, err := UnmarshalEvent(msg, EventChainPaymentSent, &payload)
+	if err != nil {
+		t.Fatalf("UnmarshalEvent: %v", err)
+	}
+	if event.ID != id || payload.TxHash != "0xabc" {
+		t.Errorf("UnmarshalEvent = %+v with tx %q, want ID %q and tx 0xabc", event, payload.TxHash, id)
+	}
+}
+
+func TestRefundResultEventIDKeysFailuresOnTheRefund(t *testing.T) {
+	failed := RefundResultEventID("refund-1", common.Hash{})
+	if failed != RefundResultEventID("refund-1", common.Hash{}) {
+		t.Error("RefundResultEventID differs for two failures of one refund")
+	}
+	if failed == RefundResultEventID("refund-2", common.Hash{}) {
+		t.Error("RefundResultEventID is the same for failures of two refunds")
+	}
+	if failed == RefundResultEventID("refund-1", common.HexToHash("0xabc")) {
+		t.Error("RefundResultEventID is the same for a refund's failure and its transfer")
+	}
+}
@@ -0,0 +1,146 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Kinds of transactions, as labeled in the metrics
+const (
+	TxKindPayment  = "payment"  // Contract payments sent by SendPayment
+	TxKindTransfer = "transfer" // Plain Ether transfers sent by SendTransfer, such as refunds
+)
+
+// MetricsRegistry holds the metrics of the blockchain service. go-ethereum registers its own metrics
+// on the global Prometheus registry, so ours are kept apart.
+var MetricsRegistry = prometheus.NewRegistry()
+
+var (
+	// txSubmitted counts transactions sent to the network, by kind (payment or transfer)
+	txSubmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "blockchain",
+		Name:      "transactions_submitted_total",
+		Help:      "Transactions sent to the network, by kind (payment, transfer) and result (ok, error).",
+	}, []string{"kind", "result"})
+
+	// txConfirmation observes the time from sending a transaction to its receipt
+	txConfirmation = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "blockchain",
+		Name:      "transaction_confirmation_seconds",
+		Help:      "Time from sending a transaction to its inclusion in a block, by kind and receipt status (success, reverted).",
+		Buckets:   []float64{5, 10, 15, 30, 60, 120, 300, 600, 1800},
+	}, []string{"kind", "status"})
+
+	// gasUsed counts the gas consumed by mined transactions
+	gasUsed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "blockchain",
+		Name:      "gas_used_total",
+		Help:      "Gas consumed by mined transactions, by kind.",
+	}, []string{"kind"})
+
+	// feesPaid counts the fees paid for mined transactions (gas used times effective gas price)
+	feesPaid = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "blockchain",
+		Name:      "fees_paid_wei_total",
+		Help:      "Fees paid for mined transactions in Wei, by kind.",
+	}, []string{"kind"})
+
+	// subscriptionReconnects counts how often the log subscription was re-established after failing
+	subscriptionReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "blockchain",
+		Name:      "subscription_reconnects_total",
+		Help:      "Times the contract log subscription was re-established after an error.",
+	})
+
+	// queueReconnects counts how often the connection to RabbitMQ was re-established after being lost
+	queueReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "blockchain",
+		Name:      "queue_reconnects_total",
+		Help:      "Times the connection to RabbitMQ was re-established after being lost.",
+	})
+
+	// queueMessages counts the messages exchanged with RabbitMQ, by queue and direction (published, consumed)
+	queueMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "blockchain",
+		Name:      "queue_messages_total",
+		Help:      "Messages exchanged with RabbitMQ, by queue, direction (published, consumed) and result (ok, error).",
+	}, []string{"queue", "direction", "result"})
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		txSubmitted,
+		txConfirmation,
+		gasUsed,
+		feesPaid,
+		subscriptionReconnects,
+		queueReconnects,
+		queueMessages,
+	)
+}
+
+// resultLabel turns an error into the result label of the metrics
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// ServeMetrics serves /metrics on addr until ctx is canceled
+func ServeMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(MetricsRegistry, promhttp.HandlerOpts{Registry: MetricsRegistry}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving metrics on %s/metrics", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve metrics: %v", err)
+	}
+	return nil
+}
+
+// ObserveConfirmation waits until tx is mined, then records how long that took since sentAt and the
+// gas it spent, and returns its receipt. It gives up and returns nil when ctx is canceled.
+func ObserveConfirmation(ctx context.Context, client *ethclient.Client, tx *types.Transaction, kind string, sentAt time.Time) *types.Receipt {
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error waiting for transaction %s: %v", tx.Hash().Hex(), err)
+		}
+		return nil
+	}
+
+	status := "success"
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = "reverted"
+	}
+	txConfirmation.WithLabelValues(kind, status).Observe(time.Since(sentAt).Seconds())
+	gasUsed.WithLabelValues(kind).Add(float64(receipt.GasUsed))
+	if receipt.EffectiveGasPrice != nil {
+		fee, _ := new(big.Float).SetInt(new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))).Float64()
+		feesPaid.WithLabelValues(kind).Add(fee)
+	}
+	return receipt
+}
@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Go-payments/bus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/google/uuid"
+)
+
+// RefundJournal remembers the compensating transfer signed for each refund. The transfer is saved
+// before it is sent, so a refund command delivered again sends the same signed transaction, which the
+// network can only include once, instead of paying the refund a second time. Once the transfer's
+// receipt is seen, the block it was mined in is recorded too, and a mined transfer is never replaced.
+type RefundJournal interface {
+	// Load returns the transfer signed for a refund, or nil if there is none
+	Load(refundID string) (*RefundEntry, error)
+
+	// Save records the transfer signed for a refund, replacing any earlier one
+	Save(refundID string, tx *types.Transaction) error
+
+	// MarkMined records the block the transfer of a refund was mined in
+	MarkMined(refundID string, block uint64) error
+}
+
+// RefundEntry is the transfer journaled for a refund
+type RefundEntry struct {
+	Tx         *types.Transaction
+	MinedBlock uint64 // Block the transfer was mined in, or 0 if its receipt has not been seen
+}
+
+// Mined reports whether the transfer's receipt has been seen
+func (e *RefundEntry) Mined() bool {
+	return e.MinedBlock > 0
+}
+
+// FileRefundJournal keeps a RefundJournal in a directory, one file per refund holding the signed
+// transaction and, once it is mined, another holding its block number. Files are written atomically
+// and synced, so nothing saved is lost to a crash.
+type FileRefundJournal struct {
+	dir string
+}
+
+var _ RefundJournal = (*FileRefundJournal)(nil)
+
+// NewFileRefundJournal opens the journal kept in dir, creating the directory if needed
+func NewFileRefundJournal(dir string) (*FileRefundJournal, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create refund journal %s: %v", dir, err)
+	}
+	return &FileRefundJournal{dir: dir}, nil
+}
+
+// path returns the file of a refund with the given extension. Refund IDs are UUIDs, which also keeps
+// them safe as file names.
+func (j *FileRefundJournal) path(refundID, ext string) (string, error) {
+	id, err := uuid.Parse(refundID)
+	if err != nil {
+		return "", bus.Permanent(fmt.Errorf("invalid refund ID %q: %v", refundID, err))
+	}
+	return filepath.Join(j.dir, id.String()+ext), nil
+}
+
+// Load returns the transfer signed for a refund, or nil if there is none
+func (j *FileRefundJournal) Load(refundID string) (*RefundEntry, error) {
+	path, err := j.path(refundID, ".tx")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transfer of refund %s: %v", refundID, err)
+	}
+
+	entry := &RefundEntry{Tx: new(types.Transaction)}
+	if err := entry.Tx.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("failed to decode transfer of refund %s: %v", refundID, err)
+	}
+
+	minedPath, _ := j.path(refundID, ".mined")
+	data, err = os.ReadFile(minedPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return entry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mined block of refund %s: %v", refundID, err)
+	}
+	if entry.MinedBlock, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+		return nil, fmt.Errorf("failed to decode mined block of refund %s: %v", refundID, err)
+	}
+	return entry, nil
+}
+
+// Save records the transfer signed for a refund, replacing any earlier one
+func (j *FileRefundJournal) Save(refundID string, tx *types.Transaction) error {
+	path, err := j.path(refundID, ".tx")
+	if err != nil {
+		return err
+	}
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode transfer of refund %s: %v", refundID, err)
+	}
+	if err := j.write(path, data); err != nil {
+		return fmt.Errorf("failed to save transfer of refund %s: %v", refundID, err)
+	}
+	return nil
+}
+
+// MarkMined records the block the transfer of a refund was mined in
+func (j *FileRefundJournal) MarkMined(refundID string, block uint64) error {
+	path, err := j.path(refundID, ".mined")
+	if err != nil {
+		return err
+	}
+	if err := j.write(path, []byte(strconv.FormatUint(block, 10)+"\n")); err != nil {
+		return fmt.Errorf("failed to save mined block of refund %s: %v", refundID, err)
+	}
+	return nil
+}
+
+// write replaces a file of the journal. It writes a temporary file and renames it, so a crash never
+// leaves a partial file behind.
+func (j *FileRefundJournal) write(path string, data []byte) error {
+	tmp, err := os.CreateTemp(j.dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(j.dir)
+}
+
+// syncDir flushes a directory, making a rename in it durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to sync %s: %v", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %v", dir, err)
+	}
+	return nil
+}
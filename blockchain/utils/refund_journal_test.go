@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+func TestFileRefundJournal(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := NewFileRefundJournal(dir)
+	if err != nil {
+		t.Fatalf("NewFileRefundJournal: %v", err)
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	sign := func(nonce uint64) *types.Transaction {
+		tx := types.NewTransaction(nonce, common.HexToAddress("0x02"), big.NewInt(1000), 21000, big.NewInt(1), nil)
+		signed, err := types.SignTx(tx, types.NewEIP155Signer(big.NewInt(17000)), key)
+		if err != nil {
+			t.Fatalf("SignTx: %v", err)
+		}
+		return signed
+	}
+
+	refundID := uuid.New().String()
+	if entry, err := journal.Load(refundID); err != nil || entry != nil {
+		t.Fatalf("Load of an unknown refund = %v, %v; want nil, nil", entry, err)
+	}
+
+	first := sign(7)
+	if err := journal.Save(refundID, first); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// A journal opened again, as after a restart, still has the transfer
+	reopened, err := NewFileRefundJournal(dir)
+	if err != nil {
+		t.Fatalf("NewFileRefundJournal: %v", err)
+	}
+	entry, err := reopened.Load(refundID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if entry == nil || entry.Tx.Hash() != first.Hash() {
+		t.Fatalf("Load returned %v, want transfer %s", entry, first.Hash().Hex())
+	}
+	if entry.Mined() {
+		t.Errorf("Load reported transfer %s mined before its receipt was seen", first.Hash().Hex())
+	}
+
+	replacement := sign(8)
+	if err := journal.Save(refundID, replacement); err != nil {
+		t.Fatalf("Save of a replacement: %v", err)
+	}
+	if entry, _ := journal.Load(refundID); entry == nil || entry.Tx.Hash() != replacement.Hash() {
+		t.Errorf("Load after replacing returned %v, want transfer %s", entry, replacement.Hash().Hex())
+	}
+
+	if err := journal.MarkMined(refundID, 1234); err != nil {
+		t.Fatalf("MarkMined: %v", err)
+	}
+	if reopened, _ = NewFileRefundJournal(dir); reopened == nil {
+		t.Fatal("NewFileRefundJournal failed to reopen the journal")
+	}
+	entry, err = reopened.Load(refundID)
+	if err != nil {
+		t.Fatalf("Load of a mined transfer: %v", err)
+	}
+	if entry == nil || entry.Tx.Hash() != replacement.Hash() || entry.MinedBlock != 1234 {
+		t.Errorf("Load of a mined transfer returned %v, want transfer %s mined at block 1234", entry, replacement.Hash().Hex())
+	}
+}
+
+func TestFileRefundJournalRejectsInvalidRefundIDs(t *testing.T) {
+	journal, err := NewFileRefundJournal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileRefundJournal: %v", err)
+	}
+	for _, refundID := range []string{"", "../../etc/passwd", "refund-1"} {
+		if _, err := journal.Load(refundID); err == nil {
+			t.Errorf("Load(%q) accepted an invalid refund ID", refundID)
+		}
+	}
+}
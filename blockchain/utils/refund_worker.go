@@ -0,0 +1,368 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Blockchain/config"
+	"github.com/Blockchain/events/eventspb"
+	"github.com/Go-payments/bus"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// RefundQueue carries compensating transfer commands from the payment service
+	RefundQueue = "blockchain_refunds"
+
+	// RefundResultQueue carries the outcome of compensating transfers back to the payment service
+	RefundResultQueue = "blockchain_refund_results"
+)
+
+// RefundCommand asks for part of an on-chain payment to be returned to its sender, in the JSON form the
+// payment service published before the event envelope (now eventspb.RefundRequested)
+type RefundCommand struct {
+	RefundID      string `json:"refund_id"`
+	TransactionID string `json:"transaction_id"`
+	ChainTxHash   string `json:"chain_tx_hash"`  // Original settlement transaction
+	RefundAmount  string `json:"refund_amount"`  // Decimal amount being refunded
+	PaymentAmount string `json:"payment_amount"` // Decimal amount of the original payment
+	Currency      string `json:"currency"`
+}
+
+// RefundWorker turns refund commands into compensating transfers and reports the results
+type RefundWorker struct {
+	client      *ethclient.Client
+	refundKey   *ecdsa.PrivateKey // Wallet the compensating transfers are paid from
+	chainID     *big.Int
+	contractABI abi.ABI       // Payment contract, whose PaymentSent events record what a payment paid
+	journal     RefundJournal // Transfers signed so far, so no refund is paid twice
+	messages    bus.Bus       // Carries the commands in and the results out
+}
+
+// DefaultRefundJournalDir is where the refund worker keeps the transfers it signed, unless configured
+const DefaultRefundJournalDir = "data/refunds"
+
+// NewRefundWorker connects to the Ethereum node described by the config and opens its refund journal;
+// refund commands and results travel through messages
+func NewRefundWorker(cfg *config.BlockchainConfig, messages bus.Bus) (*RefundWorker, error) {
+	client, err := ethclient.Dial(cfg.Blockchain.RPCURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Ethereum client: %v", err)
+	}
+
+	key, err := ParsePrivateKey(cfg.Blockchain.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+
+	abiData, err := os.ReadFile(cfg.Blockchain.ContractABI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contract ABI: %v", err)
+	}
+	contractABI, err := abi.JSON(strings.NewReader(string(abiData)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse contract ABI: %v", err)
+	}
+
+	journalDir := cfg.Refunds.JournalDir
+	if journalDir == "" {
+		journalDir = DefaultRefundJournalDir
+	}
+	journal, err := NewFileRefundJournal(journalDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RefundWorker{
+		client:      client,
+		refundKey:   key,
+		chainID:     big.NewInt(cfg.Blockchain.NetworkID),
+		contractABI: contractABI,
+		journal:     journal,
+		messages:    messages,
+	}, nil
+}
+
+// Run processes refund commands until the context is canceled
+func (w *RefundWorker) Run(ctx context.Context) error {
+	log.Println("Waiting for refund commands...")
+	if err := w.messages.Subscribe(ctx, RefundQueue, w.handle); err != nil {
+		return fmt.Errorf("failed to consume refund commands: %v", err)
+	}
+	return nil
+}
+
+// handle makes the compensating transfer a refund command asks for and reports the outcome. A transfer
+// that can never be made is reported as a failed refund; any other error is returned so the bus retries
+// the command, which the journal makes safe. A malformed command is dead-lettered.
+func (w *RefundWorker) handle(ctx context.Context, msg bus.Message) error {
+	cmd, correlationID, err := decodeRefundCommand(msg)
+	if err != nil {
+		log.Printf("Error unmarshalling refund command: %v", err)
+		return bus.Permanent(fmt.Errorf("malformed refund command: %v", err))
+	}
+
+	result := &eventspb.RefundResult{RefundId: cmd.RefundId}
+	tx, err := w.refund(ctx, cmd)
+	if err != nil && !bus.IsPermanent(err) {
+		log.Printf("Refund %s for payment %s not sent yet: %v", cmd.RefundId, cmd.TransactionId, err)
+		return err
+	}
+	if err != nil {
+		log.Printf("Refund %s for payment %s failed: %v", cmd.RefundId, cmd.TransactionId, err)
+		result.Error = err.Error()
+	} else {
+		log.Printf("Refund %s for payment %s sent in %s", cmd.RefundId, cmd.TransactionId, tx.Hash().Hex())
+		result.ChainTxHash = tx.Hash().Hex()
+		go w.observe(ctx, cmd.RefundId, tx)
+	}
+
+	if err := w.publishResult(ctx, correlationID, result); err != nil {
+		return fmt.Errorf("failed to publish result of refund %s: %v", cmd.RefundId, err)
+	}
+	return nil
+}
+
+// decodeRefundCommand decodes a refund command, either in an event envelope or as the JSON the payment
+// service published before the envelope, and returns it with its correlation ID
+func decodeRefundCommand(msg bus.Message) (*eventspb.RefundRequested, string, error) {
+	if IsEvent(msg) {
+		cmd := &eventspb.RefundRequested{}
+		event, err := UnmarshalEvent(msg, EventRefundRequested, cmd)
+		return cmd, event.CorrelationID, err
+	}
+
+	var legacy RefundCommand
+	if err := json.Unmarshal(msg.Body, &legacy); err != nil {
+		return nil, "", err
+	}
+	return &eventspb.RefundRequested{
+		RefundId:      legacy.RefundID,
+		TransactionId: legacy.TransactionID,
+		ChainTxHash:   legacy.ChainTxHash,
+		RefundAmount:  legacy.RefundAmount,
+		PaymentAmount: legacy.PaymentAmount,
+		Currency:      legacy.Currency,
+	}, legacy.TransactionID, nil
+}
+
+// Close releases the Ethereum connection; the bus is closed by its owner
+func (w *RefundWorker) Close() {
+	w.client.Close()
+}
+
+// refund sends the original sender the refunded share of what the settlement transaction paid. The
+// signed transfer is saved in the journal before it is sent; a refund found there is never signed
+// again, but its transfer is sent again if the network does not know it, so redelivered commands are
+// safe.
+func (w *RefundWorker) refund(ctx context.Context, cmd *eventspb.RefundRequested) (*types.Transaction, error) {
+	entry, err := w.journal.Load(cmd.RefundId)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if entry.Mined() {
+			return entry.Tx, nil
+		}
+		return entry.Tx, w.resend(ctx, cmd.RefundId, entry.Tx)
+	}
+
+	tx, err := w.signRefund(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.journal.Save(cmd.RefundId, tx); err != nil {
+		return nil, err
+	}
+	return tx, SendSignedTransaction(ctx, w.client, tx, TxKindTransfer)
+}
+
+// signRefund signs the transfer returning the refunded share of the settlement transaction to its sender
+func (w *RefundWorker) signRefund(ctx context.Context, cmd *eventspb.RefundRequested) (*types.Transaction, error) {
+	var original *types.Transaction
+	err := traceEthCall(ctx, "eth_getTransactionByHash", func(ctx context.Context) (err error) {
+		original, _, err = w.client.TransactionByHash(ctx, common.HexToHash(cmd.ChainTxHash))
+		return err
+	})
+	// A node that has not synced the settlement yet reports it not found too, so this is retried like
+	// any other failure and dead-lettered once the attempts run out
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction %s: %v", cmd.ChainTxHash, err)
+	}
+
+	sender, err := types.Sender(types.LatestSignerForChainID(original.ChainId()), original)
+	if err != nil {
+		return nil, bus.Permanent(fmt.Errorf("failed to recover sender of %s: %v", cmd.ChainTxHash, err))
+	}
+
+	paid, err := w.paidValue(ctx, original)
+	if err != nil {
+		return nil, err
+	}
+	value, err := RefundValue(paid, cmd.RefundAmount, cmd.PaymentAmount)
+	if err != nil {
+		return nil, bus.Permanent(err)
+	}
+
+	return SignTransfer(ctx, w.client, w.refundKey, sender, value, w.chainID)
+}
+
+// resend makes sure the network has a transfer signed earlier. A transfer with a receipt is recorded
+// as mined, and one the node has pending is left alone. One the node knows nothing of is sent again
+// while its nonce is unused. Once the nonce is used the transfer may have been replaced, but it may
+// also have been mined by a node that no longer indexes it; signing another could pay the refund
+// twice, so the command fails instead, to be retried or dead-lettered.
+func (w *RefundWorker) resend(ctx context.Context, refundID string, tx *types.Transaction) error {
+	var receipt *types.Receipt
+	err := traceEthCall(ctx, "eth_getTransactionReceipt", func(ctx context.Context) (err error) {
+		receipt, err = w.client.TransactionReceipt(ctx, tx.Hash())
+		return err
+	})
+	if err == nil {
+		return w.markMined(refundID, tx, receipt)
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return fmt.Errorf("failed to fetch receipt of transfer %s: %v", tx.Hash().Hex(), err)
+	}
+
+	err = traceEthCall(ctx, "eth_getTransactionByHash", func(ctx context.Context) (err error) {
+		_, _, err = w.client.TransactionByHash(ctx, tx.Hash())
+		return err
+	})
+	if err == nil {
+		return nil // Pending
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return fmt.Errorf("failed to look up transfer %s: %v", tx.Hash().Hex(), err)
+	}
+
+	var nonce uint64
+	from := crypto.PubkeyToAddress(w.refundKey.PublicKey)
+	err = traceEthCall(ctx, "eth_getTransactionCount", func(ctx context.Context) (err error) {
+		nonce, err = w.client.NonceAt(ctx, from, nil)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get nonce: %v", err)
+	}
+	if nonce > tx.Nonce() {
+		return fmt.Errorf("transfer %s of refund %s has neither a receipt nor a pending transaction but its nonce %d is used", tx.Hash().Hex(), refundID, tx.Nonce())
+	}
+
+	return SendSignedTransaction(ctx, w.client, tx, TxKindTransfer)
+}
+
+// observe waits for the transfer of a refund to be mined and records its block in the journal
+func (w *RefundWorker) observe(ctx context.Context, refundID string, tx *types.Transaction) {
+	receipt := ObserveConfirmation(ctx, w.client, tx, TxKindTransfer, time.Now())
+	if receipt == nil {
+		return
+	}
+	if err := w.markMined(refundID, tx, receipt); err != nil {
+		log.Printf("Error recording transfer %s of refund %s as mined: %v", tx.Hash().Hex(), refundID, err)
+	}
+}
+
+// markMined records the block a refund's transfer was mined in, so it is never sent or signed again
+func (w *RefundWorker) markMined(refundID string, tx *types.Transaction, receipt *types.Receipt) error {
+	if err := w.journal.MarkMined(refundID, receipt.BlockNumber.Uint64()); err != nil {
+		return err
+	}
+	log.Printf("Transfer %s of refund %s mined at block %s", tx.Hash().Hex(), refundID, receipt.BlockNumber)
+	return nil
+}
+
+// paidValue returns the Wei a settlement transaction paid. That is its value, unless it is a contract
+// call sent without one, as SendPayment did before it passed the amount as the call's value; the
+// amount is then taken from the PaymentSent event the call emitted.
+func (w *RefundWorker) paidValue(ctx context.Context, original *types.Transaction) (*big.Int, error) {
+	if original.Value().Sign() > 0 {
+		return original.Value(), nil
+	}
+
+	var receipt *types.Receipt
+	err := traceEthCall(ctx, "eth_getTransactionReceipt", func(ctx context.Context) (err error) {
+		receipt, err = w.client.TransactionReceipt(ctx, original.Hash())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch receipt of %s: %v", original.Hash().Hex(), err)
+	}
+	paid, err := PaymentSentAmount(w.contractABI, receipt)
+	if err != nil {
+		return nil, bus.Permanent(err)
+	}
+	return paid, nil
+}
+
+// PaymentSentAmount returns the amount of the PaymentSent event in a receipt
+func PaymentSentAmount(contractABI abi.ABI, receipt *types.Receipt) (*big.Int, error) {
+	event, ok := contractABI.Events["PaymentSent"]
+	if !ok {
+		return nil, fmt.Errorf("contract ABI has no PaymentSent event")
+	}
+
+	for _, vLog := range receipt.Logs {
+		if len(vLog.Topics) == 0 || vLog.Topics[0] != event.ID {
+			continue
+		}
+		var sent PaymentEvent
+		if err := contractABI.UnpackIntoInterface(&sent, event.Name, vLog.Data); err != nil {
+			return nil, fmt.Errorf("failed to unpack PaymentSent event: %v", err)
+		}
+		if sent.Amount == nil || sent.Amount.Sign() <= 0 {
+			break
+		}
+		return sent.Amount, nil
+	}
+	return nil, fmt.Errorf("transaction %s paid no Ether", receipt.TxHash.Hex())
+}
+
+// RefundValue scales an on-chain value by refundAmount / paymentAmount, rounding down to whole Wei
+// so the refund never exceeds the share of the original transfer being returned
+func RefundValue(paid *big.Int, refundAmount, paymentAmount string) (*big.Int, error) {
+	refund, ok := new(big.Rat).SetString(refundAmount)
+	if !ok || refund.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid refund amount %q", refundAmount)
+	}
+	payment, ok := new(big.Rat).SetString(paymentAmount)
+	if !ok || payment.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid payment amount %q", paymentAmount)
+	}
+	if refund.Cmp(payment) > 0 {
+		return nil, fmt.Errorf("refund amount %s exceeds payment amount %s", refundAmount, paymentAmount)
+	}
+
+	share := new(big.Rat).Mul(new(big.Rat).SetInt(paid), new(big.Rat).Quo(refund, payment))
+	value := new(big.Int).Quo(share.Num(), share.Denom())
+	if value.Sign() == 0 {
+		return nil, fmt.Errorf("refund of %s rounds to zero Wei", refundAmount)
+	}
+	return value, nil
+}
+
+// publishResult reports a refund's outcome to the payment service, in the trace of ctx and correlated
+// with the command
+func (w *RefundWorker) publishResult(ctx context.Context, correlationID string, result *eventspb.RefundResult) error {
+	// A refund's outcome is reported under the same ID however often its command is delivered; a failure
+	// has no transfer, so it is keyed on the refund alone and the payment service applies only the first
+	id := RefundResultEventID(result.RefundId, common.HexToHash(result.ChainTxHash))
+	msg, err := NewEventMessageWithID(id, EventRefundResult, correlationID, result)
+	if err != nil {
+		return err
+	}
+	return w.messages.Publish(ctx, RefundResultQueue, msg)
+}
@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func loadPaymentABI(t *testing.T) abi.ABI {
+	t.Helper()
+	data, err := os.ReadFile("../contracts/Payment.abi")
+	if err != nil {
+		t.Fatalf("failed to read contract ABI: %v", err)
+	}
+	contractABI, err := abi.JSON(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("failed to parse contract ABI: %v", err)
+	}
+	return contractABI
+}
+
+func TestPaymentSentAmount(t *testing.T) {
+	contractABI := loadPaymentABI(t)
+	event := contractABI.Events["PaymentSent"]
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(250000000000000000), big.NewInt(1700000000))
+	if err != nil {
+		t.Fatalf("failed to pack event: %v", err)
+	}
+
+	sender, receiver := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	receipt := &types.Receipt{
+		TxHash: common.HexToHash("0xabc"),
+		Logs: []*types.Log{
+			{Topics: []common.Hash{common.HexToHash("0xdead")}}, // Some other event
+			{Topics: []common.Hash{event.ID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())}, Data: data},
+		},
+	}
+
+	amount, err := PaymentSentAmount(contractABI, receipt)
+	if err != nil {
+		t.Fatalf("PaymentSentAmount: %v", err)
+	}
+	if amount.Cmp(big.NewInt(250000000000000000)) != 0 {
+		t.Errorf("PaymentSentAmount = %s, want 250000000000000000", amount)
+	}
+
+	if _, err := PaymentSentAmount(contractABI, &types.Receipt{TxHash: receipt.TxHash}); err == nil {
+		t.Error("PaymentSentAmount found an amount in a receipt without a PaymentSent event")
+	}
+}
+
+func TestRefundValue(t *testing.T) {
+	paid := big.NewInt(1000000000000000000) // 1 Ether
+
+	tests := []struct {
+		refund, payment string
+		want            string // Empty if the refund is rejected
+	}{
+		{refund: "100.00", payment: "100.00", want: "1000000000000000000"},
+		{refund: "25.00", payment: "100.00", want: "250000000000000000"},
+		{refund: "33.33", payment: "100.00", want: "333300000000000000"},
+		{refund: "0.01", payment: "3", want: "3333333333333333"}, // Rounded down
+		{refund: "100.01", payment: "100.00"},
+		{refund: "0", payment: "100.00"},
+		{refund: "abc", payment: "100.00"},
+	}
+	for _, tt := range tests {
+		value, err := RefundValue(paid, tt.refund, tt.payment)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("RefundValue(%s of %s) = %s, want an error", tt.refund, tt.payment, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("RefundValue(%s of %s): %v", tt.refund, tt.payment, err)
+			continue
+		}
+		if value.String() != tt.want {
+			t.Errorf("RefundValue(%s of %s) = %s, want %s", tt.refund, tt.payment, value, tt.want)
+		}
+	}
+}
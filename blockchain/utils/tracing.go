@@ -0,0 +1,146 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Blockchain/config"
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies the blockchain service in traces
+const ServiceName = "blockchain-service"
+
+// tracerName is the instrumentation scope of the spans started by this module
+const tracerName = "github.com/Blockchain"
+
+// SetupTracing installs the global tracer provider and propagator described by cfg. The returned
+// function flushes the spans still buffered and must be called on exit. Trace context carried by
+// RabbitMQ messages is passed on even when no exporter is configured.
+func SetupTracing(ctx context.Context, cfg *config.BlockchainConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Tracing.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		var opts []otlptracegrpc.Option
+		if cfg.Tracing.OTLPEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Tracing.OTLPEndpoint))
+		}
+		if cfg.Tracing.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Tracing.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %v", cfg.Tracing.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the service for traces: %v", err)
+	}
+
+	ratio := cfg.Tracing.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	log.Printf("Exporting traces to %s", cfg.Tracing.Exporter)
+	return provider.Shutdown, nil
+}
+
+// startSpan starts a span named name as a child of the span in ctx
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, recording err as its failure if it is not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceEthCall runs an Ethereum JSON-RPC call inside a client span named after its method
+func traceEthCall(ctx context.Context, method string, call func(context.Context) error) error {
+	ctx, span := startSpan(ctx, method, trace.SpanKindClient,
+		semconv.RPCSystemKey.String("jsonrpc"),
+		semconv.RPCMethod(method),
+	)
+	err := call(ctx)
+	endSpan(span, err)
+	return err
+}
+
+// headerCarrier adapts the headers of a RabbitMQ message to the OpenTelemetry propagators
+type headerCarrier amqp091.Table
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// startPublishSpan starts a producer span for a message sent to queue and returns it with the
+// headers carrying its trace context
+func startPublishSpan(ctx context.Context, queue string) (trace.Span, amqp091.Table) {
+	ctx, span := startSpan(ctx, "publish "+queue, trace.SpanKindProducer,
+		semconv.MessagingSystemRabbitmq,
+		semconv.MessagingDestinationName(queue),
+		semconv.MessagingOperationTypePublish,
+	)
+	headers := amqp091.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+	return span, headers
+}
+
+// startConsumerSpan starts a consumer span for a message received from queue, continuing the trace of
+// its sender if the message carries one
+func startConsumerSpan(ctx context.Context, queue string, msg amqp091.Delivery) (context.Context, trace.Span) {
+	if msg.Headers != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier(msg.Headers))
+	}
+	return startSpan(ctx, "process "+queue, trace.SpanKindConsumer,
+		semconv.MessagingSystemRabbitmq,
+		semconv.MessagingDestinationName(queue),
+		semconv.MessagingOperationTypeDeliver,
+	)
+}
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Currency precision and rounding (Exponent, RoundingMode) come from precision_gen.go, generated from
+// the payment service's money package
+
+// weiPerEther is 10^18, the number of wei in one Ether
+var weiPerEther = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+// ParseFiatAmount parses a positive decimal fiat amount exactly, rejecting more decimal places than the
+// currency allows
+func ParseFiatAmount(value, currency string) (*big.Rat, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	value = strings.TrimSpace(value)
+	amount, ok := new(big.Rat).SetString(value)
+	if !ok || amount.Sign() <= 0 || strings.ContainsAny(value, "eE/") {
+		return nil, fmt.Errorf("invalid amount %q", value)
+	}
+	// Trailing zeros never change the value, so "1.500" is fine for a 2-digit currency
+	if _, frac, ok := strings.Cut(value, "."); ok && len(strings.TrimRight(frac, "0")) > exp {
+		return nil, fmt.Errorf("amount %q has more than %d decimal places for %s", value, exp, currency)
+	}
+	return amount, nil
+}
+
+// FiatToWei converts a fiat amount into wei given the fiat price of one Ether.
+// The result is rounded down so the sender is never charged more than they asked to send.
+func FiatToWei(amount, fiatPerEther *big.Rat) (*big.Int, error) {
+	if fiatPerEther == nil || fiatPerEther.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid conversion rate")
+	}
+
+	wei := new(big.Rat).Quo(amount, fiatPerEther)
+	wei.Mul(wei, new(big.Rat).SetInt(weiPerEther))
+	return round(wei, RoundDown), nil
+}
+
+// WeiToFiat converts wei into a fiat amount given the fiat price of one Ether, rounded to the currency's
+// precision with the given mode, and returns it formatted with exactly that many decimal places
+func WeiToFiat(wei *big.Int, fiatPerEther *big.Rat, currency string, mode RoundingMode) (string, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return "", err
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+	value := new(big.Rat).Mul(new(big.Rat).SetFrac(wei, weiPerEther), fiatPerEther)
+	value.Mul(value, new(big.Rat).SetInt(scale))
+	return new(big.Rat).SetFrac(round(value, mode), scale).FloatString(exp), nil
+}
+
+// WeiToEther formats a wei amount as an exact Ether decimal string
+func WeiToEther(wei *big.Int) string {
+	return new(big.Rat).SetFrac(wei, weiPerEther).FloatString(18)
+}
@@ -0,0 +1,70 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseFiatAmount(t *testing.T) {
+	tests := []struct {
+		value, currency string
+		want            string // Empty when the amount is rejected
+	}{
+		{value: "12.34", currency: "usd", want: "617/50"},
+		{value: "12.340", currency: "USD", want: "617/50"},
+		{value: "12.345", currency: "usd"},
+		{value: "1500", currency: "jpy", want: "1500"},
+		{value: "1500.5", currency: "jpy"},
+		{value: "1.234", currency: "bhd", want: "617/500"},
+		{value: "0", currency: "usd"},
+		{value: "1e3", currency: "usd"},
+		{value: "10", currency: "xyz"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFiatAmount(tt.value, tt.currency)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("ParseFiatAmount(%q, %s) = %s, want an error", tt.value, tt.currency, got)
+		case tt.want != "" && err != nil:
+			t.Errorf("ParseFiatAmount(%q, %s): %v", tt.value, tt.currency, err)
+		case tt.want != "" && got.RatString() != tt.want:
+			t.Errorf("ParseFiatAmount(%q, %s) = %s, want %s", tt.value, tt.currency, got.RatString(), tt.want)
+		}
+	}
+}
+
+func TestWeiToFiatRoundsToCurrencyPrecision(t *testing.T) {
+	halfEther := new(big.Int).Div(weiPerEther, big.NewInt(2))
+	tests := []struct {
+		rate     string // Price of one Ether
+		currency string
+		mode     RoundingMode
+		want     string
+	}{
+		{rate: "2000.01", currency: "usd", mode: RoundHalfEven, want: "1000.00"},
+		{rate: "2000.03", currency: "usd", mode: RoundHalfEven, want: "1000.02"},
+		{rate: "2000.01", currency: "usd", mode: RoundHalfUp, want: "1000.01"},
+		{rate: "2000.03", currency: "usd", mode: RoundDown, want: "1000.01"},
+		{rate: "2000.01", currency: "usd", mode: RoundUp, want: "1000.01"},
+		{rate: "301", currency: "jpy", mode: RoundHalfEven, want: "150"},
+		{rate: "301", currency: "jpy", mode: RoundHalfUp, want: "151"},
+		{rate: "0.123", currency: "bhd", mode: RoundHalfEven, want: "0.062"},
+		{rate: "0.123", currency: "bhd", mode: RoundDown, want: "0.061"},
+	}
+
+	for _, tt := range tests {
+		rate, _ := new(big.Rat).SetString(tt.rate)
+		got, err := WeiToFiat(halfEther, rate, tt.currency, tt.mode)
+		if err != nil {
+			t.Fatalf("WeiToFiat: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("half an Ether at %s %s with mode %d = %s, want %s", tt.rate, tt.currency, tt.mode, got, tt.want)
+		}
+	}
+
+	if _, err := WeiToFiat(halfEther, big.NewRat(1, 1), "xyz", RoundHalfEven); err == nil {
+		t.Error("WeiToFiat accepted an unknown currency")
+	}
+}
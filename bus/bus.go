@@ -0,0 +1,76 @@
+// Package bus defines how the payment and blockchain services exchange messages, independently of the
+// broker carrying them. Both services require this module through a replace directive pointing at
+// this directory, so they share one definition of the contract and of how queues are named. Each
+// service carries it over RabbitMQ (the payment service's rabbitmq package, the blockchain service's
+// AMQPBus), and bus/memory carries it in process memory, for tests and for running without a broker.
+//
+// Messages are published to named queues. Every message of a queue is handled by one of its
+// subscribers, and a message whose handling fails is retried before it is dead-lettered. Both services
+// must agree on the queue names and message formats.
+package bus
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Message is a message published to or received from a queue
+type Message struct {
+	ID          string // Identifier chosen by the publisher, if any
+	ContentType string // Encoding of Body, e.g. "application/protobuf" or "application/json"
+	Body        []byte
+	PublishedAt time.Time // Set when the message is published
+}
+
+// Publisher publishes messages to queues
+type Publisher interface {
+	// Publish hands msg to the bus for delivery to queue, with the trace context of ctx. The queue is
+	// created if it does not exist yet, so messages published before anyone subscribes are kept.
+	Publish(ctx context.Context, queue string, msg Message) error
+}
+
+// Handler handles one message received from a queue. ctx continues the trace the message was published
+// in. An error has the message delivered again after a delay, unless it is marked with Permanent.
+type Handler func(ctx context.Context, msg Message) error
+
+// Subscriber delivers the messages of queues to handlers
+type Subscriber interface {
+	// Subscribe calls handle for the messages of queue until ctx is canceled, resuming the subscription
+	// if it is lost, and returns once the messages already received are handled. Handlers are not
+	// canceled with ctx. A message whose handler keeps failing is retried with a growing delay and
+	// dead-lettered once its attempts are used up, or right away if the failure is permanent.
+	// Subscribe fails only if the queue cannot be consumed at first.
+	Subscribe(ctx context.Context, queue string, handle Handler) error
+}
+
+// Bus publishes and subscribes. Handlers that have effects outside the service, such as sending a
+// transaction, must make sure a retried message cannot have them twice.
+type Bus interface {
+	Publisher
+	Subscriber
+}
+
+// permanentError marks a failure that delivering the message again cannot fix
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that retrying cannot fix, such as a malformed message, so the
+// message is dead-lettered right away
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked by Permanent
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// RetryDelay is how long a message waits before its next delivery after failing attempts times, starting
+// from delay and doubling with every attempt
+func RetryDelay(delay time.Duration, attempts int) time.Duration {
+	return delay << (attempts - 1)
+}
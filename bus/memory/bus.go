@@ -0,0 +1,246 @@
+// Package memory implements bus.Bus in process memory, for tests and for running a service without
+// RabbitMQ. Messages are lost on restart.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Go-payments/bus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans of the bus
+const tracerName = "github.com/Go-payments/bus/memory"
+
+// DeadLetter is a message given up on
+type DeadLetter struct {
+	bus.Message
+	Attempts       int    // Times handling the message failed
+	LastError      string // Why the last attempt failed
+	DeadLetteredAt time.Time
+}
+
+// delivery is a message waiting in a queue
+type delivery struct {
+	msg          bus.Message
+	traceContext propagation.MapCarrier // Trace the message was published in
+	attempts     int                    // Times handling the message failed so far
+}
+
+// queue holds the messages of one queue until a subscriber takes them
+type queue struct {
+	waiting []delivery    // Oldest first
+	ready   chan struct{} // Signaled when a message is added to waiting
+	dead    []DeadLetter
+}
+
+// Bus keeps the messages of every queue in memory until a subscriber takes them. Like the RabbitMQ
+// backends, it retries failed messages with a doubling delay and dead-letters them once their attempts
+// are used up.
+type Bus struct {
+	maxAttempts int
+	retryDelay  time.Duration
+
+	mu     sync.Mutex
+	queues map[string]*queue
+}
+
+var _ bus.Bus = (*Bus)(nil)
+
+// NewBus creates an empty bus handling every message up to maxAttempts times, waiting retryDelay before
+// the first retry
+func NewBus(maxAttempts int, retryDelay time.Duration) *Bus {
+	return &Bus{
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		queues:      map[string]*queue{},
+	}
+}
+
+// queue returns the queue named name, creating it if needed; the caller holds b.mu
+func (b *Bus) queue(name string) *queue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &queue{ready: make(chan struct{}, 1)}
+		b.queues[name] = q
+	}
+	return q
+}
+
+// enqueue adds d to the end of a queue and wakes a subscriber waiting for it
+func (b *Bus) enqueue(name string, d delivery) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := b.queue(name)
+	q.waiting = append(q.waiting, d)
+	select {
+	case q.ready <- struct{}{}:
+	default: // A subscriber was already woken
+	}
+}
+
+// startSpan starts a span of the bus in the global tracer provider
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, recording err on it if there is one
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Publish adds a copy of msg to a queue, with the trace context of ctx
+func (b *Bus) Publish(ctx context.Context, queueName string, msg bus.Message) error {
+	ctx, span := startSpan(ctx, "publish "+queueName, trace.SpanKindProducer,
+		semconv.MessagingOperationTypePublish,
+		semconv.MessagingDestinationName(queueName),
+	)
+	defer span.End()
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	msg.Body = bytes.Clone(msg.Body)
+	msg.PublishedAt = time.Now()
+	b.enqueue(queueName, delivery{msg: msg, traceContext: carrier})
+	return nil
+}
+
+// next takes the oldest message of q, waiting for one if it is empty. It returns false once ctx is
+// canceled.
+func (b *Bus) next(ctx context.Context, q *queue) (delivery, bool) {
+	for {
+		if ctx.Err() != nil {
+			return delivery{}, false
+		}
+
+		b.mu.Lock()
+		if len(q.waiting) > 0 {
+			d := q.waiting[0]
+			q.waiting = q.waiting[1:]
+			if len(q.waiting) > 0 {
+				// Pass the wake-up on to another subscriber, since one signal may stand for several messages
+				select {
+				case q.ready <- struct{}{}:
+				default:
+				}
+			}
+			b.mu.Unlock()
+			return d, true
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-q.ready:
+		}
+	}
+}
+
+// Subscribe calls handle for the messages of a queue, one at a time, until ctx is canceled. A message
+// whose handler fails is retried after a delay, and dead-lettered once its attempts are used up or the
+// failure is permanent.
+func (b *Bus) Subscribe(ctx context.Context, queueName string, handle bus.Handler) error {
+	b.mu.Lock()
+	q := b.queue(queueName)
+	b.mu.Unlock()
+
+	for {
+		d, ok := b.next(ctx, q)
+		if !ok {
+			return nil
+		}
+
+		// Each message is handled to the end even if ctx is canceled meanwhile
+		msgCtx := otel.GetTextMapPropagator().Extract(context.WithoutCancel(ctx), d.traceContext)
+		msgCtx, span := startSpan(msgCtx, "process "+queueName, trace.SpanKindConsumer,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(queueName),
+		)
+		err := handle(msgCtx, d.msg)
+		endSpan(span, err)
+		b.settle(queueName, d, err)
+	}
+}
+
+// settle schedules a message whose handling failed with err for another delivery, or dead-letters it
+// once its attempts are used up or err is permanent
+func (b *Bus) settle(queueName string, d delivery, err error) {
+	if err == nil {
+		return
+	}
+
+	d.attempts++
+	if !bus.IsPermanent(err) && d.attempts < b.maxAttempts {
+		delay := bus.RetryDelay(b.retryDelay, d.attempts)
+		log.Printf("Retrying message from %s in %s (attempt %d of %d): %v", queueName, delay, d.attempts, b.maxAttempts, err)
+		time.AfterFunc(delay, func() { b.enqueue(queueName, d) })
+		return
+	}
+
+	log.Printf("Dead-lettered message from %s after %d attempts: %v", queueName, d.attempts, err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(queueName)
+	q.dead = append(q.dead, DeadLetter{
+		Message:        d.msg,
+		Attempts:       d.attempts,
+		LastError:      err.Error(),
+		DeadLetteredAt: time.Now(),
+	})
+}
+
+// Pending returns the messages waiting in a queue, oldest first, without removing them
+func (b *Bus) Pending(queueName string) []bus.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[queueName]
+	if !ok {
+		return nil
+	}
+	msgs := make([]bus.Message, len(q.waiting))
+	for i, d := range q.waiting {
+		msgs[i] = d.msg
+	}
+	return msgs
+}
+
+// DeadLetters returns the messages dead-lettered from a queue, oldest first
+func (b *Bus) DeadLetters(queueName string) []DeadLetter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[queueName]
+	if !ok {
+		return nil
+	}
+	return append([]DeadLetter(nil), q.dead...)
+}
+
+// QueueDepths returns the number of messages waiting in each queue and its dead letters, named like
+// the RabbitMQ dead-letter queues
+func (b *Bus) QueueDepths() (map[string]int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	depths := make(map[string]int, 2*len(b.queues))
+	for name, q := range b.queues {
+		depths[name] = len(q.waiting)
+		depths[bus.DeadLetterQueue(name)] = len(q.dead)
+	}
+	return depths, nil
+}
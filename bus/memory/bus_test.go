@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Go-payments/bus"
+)
+
+// consume subscribes handle to a queue until the wait times out, and returns how often it was called
+func consume(b *Bus, queueName string, wait time.Duration, handle bus.Handler) int {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	calls := 0
+	b.Subscribe(ctx, queueName, func(ctx context.Context, msg bus.Message) error {
+		calls++
+		return handle(ctx, msg)
+	})
+	return calls
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := NewBus(3, time.Millisecond)
+	body := []byte("update")
+	if err := b.Publish(context.Background(), "payment_updates", bus.Message{ID: "msg-1", Body: body}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	body[0] = 'X' // The bus keeps its own copy
+
+	var got bus.Message
+	calls := consume(b, "payment_updates", 100*time.Millisecond, func(ctx context.Context, msg bus.Message) error {
+		got = msg
+		return nil
+	})
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	if got.ID != "msg-1" || string(got.Body) != "update" || got.PublishedAt.IsZero() {
+		t.Errorf("received %+v, want msg-1 carrying %q with its publish time", got, "update")
+	}
+	if dead := b.DeadLetters("payment_updates"); len(dead) != 0 {
+		t.Errorf("%d messages dead-lettered, want none", len(dead))
+	}
+}
+
+func TestFailedMessagesAreRetriedThenDeadLettered(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		failures  int // Deliveries failing before one succeeds
+		wantCalls int
+		wantDead  int
+	}{
+		{name: "recovers", err: errors.New("database unavailable"), failures: 2, wantCalls: 3},
+		{name: "attempts used up", err: errors.New("database unavailable"), failures: 10, wantCalls: 3, wantDead: 1},
+		{name: "permanent", err: bus.Permanent(errors.New("malformed status update")), failures: 10, wantCalls: 1, wantDead: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBus(3, time.Millisecond)
+			if err := b.Publish(context.Background(), "payment_updates", bus.Message{Body: []byte("update")}); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+
+			calls := consume(b, "payment_updates", 200*time.Millisecond, func(ctx context.Context, msg bus.Message) error {
+				if tt.failures > 0 {
+					tt.failures--
+					return tt.err
+				}
+				return nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+
+			dead := b.DeadLetters("payment_updates")
+			if len(dead) != tt.wantDead {
+				t.Fatalf("%d messages dead-lettered, want %d", len(dead), tt.wantDead)
+			}
+			if tt.wantDead > 0 {
+				if dead[0].Attempts != tt.wantCalls || dead[0].LastError != tt.err.Error() || string(dead[0].Body) != "update" {
+					t.Errorf("dead letter = %+v, want %d attempts failing with %q", dead[0], tt.wantCalls, tt.err)
+				}
+				depths, _ := b.QueueDepths()
+				if depths["payment_updates.dead"] != tt.wantDead || depths["payment_updates"] != 0 {
+					t.Errorf("queue depths = %v", depths)
+				}
+			}
+		})
+	}
+}
+
+func TestPendingLeavesMessagesWaiting(t *testing.T) {
+	b := NewBus(3, time.Millisecond)
+	for _, id := range []string{"msg-1", "msg-2"} {
+		if err := b.Publish(context.Background(), "blockchain_refunds", bus.Message{ID: id}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		pending := b.Pending("blockchain_refunds")
+		if len(pending) != 2 || pending[0].ID != "msg-1" || pending[1].ID != "msg-2" {
+			t.Fatalf("pending messages = %+v, want msg-1 and msg-2", pending)
+		}
+	}
+	if pending := b.Pending("payment_events"); len(pending) != 0 {
+		t.Errorf("%d messages pending in a queue nothing was published to", len(pending))
+	}
+}
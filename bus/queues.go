@@ -0,0 +1,48 @@
+package bus
+
+import (
+	"fmt"
+	"time"
+)
+
+// Headers recording a message's failed attempts, which the RabbitMQ backends set when they retry or
+// dead-letter it
+const (
+	AttemptsHeader       = "x-attempts"         // Number of times handling the message failed
+	LastErrorHeader      = "x-last-error"       // Why the last attempt failed
+	DeadLetteredAtHeader = "x-dead-lettered-at" // When the message was moved to the dead-letter queue
+)
+
+// DeadLetterQueue names the queue holding the messages of queue that could not be handled
+func DeadLetterQueue(queue string) string {
+	return queue + ".dead"
+}
+
+// RetryQueue names the queue holding messages of queue for delay before they are delivered again.
+// The delay is part of the name, so changing the retry delay declares new queues instead of clashing
+// with the arguments of the existing ones.
+func RetryQueue(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queue, delay)
+}
+
+// RetryQueueArguments are the arguments RetryQueue(queue, delay) is declared with. A retry queue has
+// no consumer: its messages expire after the delay and are dead-lettered back to queue.
+func RetryQueueArguments(queue string, delay time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"x-message-ttl":             delay.Milliseconds(),
+		"x-dead-letter-exchange":    "", // The default exchange routes by queue name
+		"x-dead-letter-routing-key": queue,
+	}
+}
+
+// Attempts returns how many times handling a message failed before, as recorded in its headers
+func Attempts(headers map[string]interface{}) int {
+	switch n := headers[AttemptsHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	default:
+		return 0
+	}
+}
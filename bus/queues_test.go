@@ -0,0 +1,45 @@
+package bus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryQueuesFollowTheRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     string
+	}{
+		{attempts: 1, want: "payment_updates.retry.1s"},
+		{attempts: 2, want: "payment_updates.retry.2s"},
+		{attempts: 4, want: "payment_updates.retry.8s"},
+	}
+	for _, tt := range tests {
+		if got := RetryQueue("payment_updates", RetryDelay(time.Second, tt.attempts)); got != tt.want {
+			t.Errorf("retry queue after %d attempts = %q, want %q", tt.attempts, got, tt.want)
+		}
+	}
+
+	args := RetryQueueArguments("payment_updates", 2*time.Second)
+	if args["x-message-ttl"] != int64(2000) || args["x-dead-letter-routing-key"] != "payment_updates" {
+		t.Errorf("retry queue arguments = %v, want a 2000ms TTL dead-lettering to payment_updates", args)
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]interface{}
+		want    int
+	}{
+		{name: "first delivery", want: 0},
+		{name: "as published", headers: map[string]interface{}{AttemptsHeader: int32(2)}, want: 2},
+		{name: "as decoded by some clients", headers: map[string]interface{}{AttemptsHeader: int64(3)}, want: 3},
+		{name: "malformed", headers: map[string]interface{}{AttemptsHeader: "3"}, want: 0},
+	}
+	for _, tt := range tests {
+		if got := Attempts(tt.headers); got != tt.want {
+			t.Errorf("%s: Attempts = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
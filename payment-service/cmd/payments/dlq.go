@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Go-payments/bus"
+	"github.com/Go-payments/internal/rabbitmq"
+)
+
+// runDLQCommand runs the dlq subcommand, which inspects, replays or purges the messages dead-lettered
+// from a queue
+func runDLQCommand(ctx context.Context, conn *rabbitmq.Connection, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: dlq list <queue> [limit] | replay <queue> [limit] | purge <queue>")
+	}
+	command, queue := args[0], args[1]
+
+	limit := 0
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid limit %q", args[2])
+		}
+		limit = n
+	}
+
+	switch command {
+	case "list":
+		letters, err := conn.DeadLetters(queue, limit)
+		if err != nil {
+			return err
+		}
+		for _, letter := range letters {
+			fmt.Printf("dead-lettered %s\tattempts %d\tpublished %s\t%s\n",
+				formatTime(letter.DeadLetteredAt), letter.Attempts, formatTime(letter.PublishedAt), letter.LastError)
+			fmt.Printf("\t%s %s\n", letter.ContentType, formatBody(letter.ContentType, letter.Body))
+		}
+		fmt.Printf("%d message(s) in %s\n", len(letters), bus.DeadLetterQueue(queue))
+		return nil
+	case "replay":
+		replayed, err := conn.ReplayDeadLetters(ctx, queue, limit)
+		fmt.Printf("Replayed %d message(s) from %s to %s\n", replayed, bus.DeadLetterQueue(queue), queue)
+		return err
+	case "purge":
+		purged, err := conn.PurgeDeadLetters(queue)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d message(s) from %s\n", purged, bus.DeadLetterQueue(queue))
+		return nil
+	default:
+		return fmt.Errorf("unknown dlq command %q, expected list, replay or purge", command)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatBody shows text bodies as they are and binary ones (e.g., Protobuf) quoted
+func formatBody(contentType string, body []byte) string {
+	if strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/") {
+		return string(body)
+	}
+	return strconv.Quote(string(body))
+}
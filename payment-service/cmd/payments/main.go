@@ -1,75 +1,310 @@
+// Command payments runs the payment service: the gRPC API, its HTTP gateway and the background
+// consumers and relays. "payments migrate up|down [steps]|status" manages the database schema instead,
+// and "payments dlq list|replay|purge <queue>" the messages a queue's consumer gave up on.
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Go-payments/bus"
+	busmemory "github.com/Go-payments/bus/memory"
+	apierror "github.com/Go-payments/internal/api/error"
+	grpc_server "github.com/Go-payments/internal/api/grpc"
+	"github.com/Go-payments/internal/auth"
 	"github.com/Go-payments/internal/config"
 	"github.com/Go-payments/internal/db"
-
-	// "github.com/Go-payments/internal/api/grpc"
-	paymentgrpc "github.com/Go-payments/internal/api/grpc"
-	middlewares "github.com/Go-payments/internal/api/middleware" // Assuming your middleware is in this package
-	pb "github.com/Go-payments/internal/proto"
+	"github.com/Go-payments/internal/db/memory"
+	"github.com/Go-payments/internal/health"
+	"github.com/Go-payments/internal/inbox"
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/metrics"
+	"github.com/Go-payments/internal/outbox"
+	pb "github.com/Go-payments/internal/proto/grpc"
 	"github.com/Go-payments/internal/rabbitmq"
+	"github.com/Go-payments/internal/tracing"
 	"github.com/labstack/echo/v4"
-	"google.golang.org/grpc" // <-- Add this import
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
-func main() {
-	// Load configurations
-	cfg := config.Load()
+// readinessInterval is how often the gRPC health service re-runs the readiness checks
+const readinessInterval = 5 * time.Second
 
-	// Initialize Database
-	dbConn, err := db.Connect(cfg)
+func main() {
+	// Load configuration from defaults, the config file, the environment and flags
+	cfg, args, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
-	defer dbConn.Close() // Close the database connection when main exits
 
-	// Initialize RabbitMQ
-	rabbitConn, err := rabbitmq.Connect(cfg)
+	// SIGINT or SIGTERM starts a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// "dlq list|replay|purge <queue> [limit]" manages dead-lettered messages without starting the service
+	if len(args) > 0 && args[0] == "dlq" {
+		if cfg.Broker != config.BrokerRabbitMQ {
+			log.Fatalf("The dlq command needs the %s broker, dead letters of the %s broker do not outlive the service", config.BrokerRabbitMQ, cfg.Broker)
+		}
+		rabbitConn, err := rabbitmq.Connect(cfg.RabbitMQ.URL, rabbitOptions(cfg.RabbitMQ))
+		if err != nil {
+			log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		}
+		defer rabbitConn.Close()
+		if err := runDLQCommand(ctx, rabbitConn, args[1:]); err != nil {
+			log.Fatalf("Dead-letter command failed: %v", err)
+		}
+		return
+	}
+
+	// Trace requests and messages; buffered spans are flushed after everything else has stopped
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
-	defer rabbitConn.Close() // Close the RabbitMQ connection when main exits
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
 
-	// Initialize Echo server (optional if you want HTTP alongside gRPC)
-	e := echo.New()
+	// Readiness probes the dependencies the service cannot work without
+	checker := health.NewChecker()
+
+	var store db.PaymentStore
+	if cfg.Storage == config.StorageMemory {
+		// Everything is lost on restart; meant for local development without Postgres
+		log.Println("Using in-memory storage")
+		store = memory.NewStore()
+	} else {
+		// Connect to the database
+		dbConn, err := db.Connect(cfg.Database.URL)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer dbConn.Close() // Ensure the database connection is closed when the server stops
+
+		customDB := &db.DB{DB: dbConn}
 
-	// Register middlewares if you want to use them for HTTP requests
-	e.Use(middlewares.AuthMiddleware)
+		// "migrate up|down [steps]|status" manages the schema without starting the service
+		if len(args) > 0 && args[0] == "migrate" {
+			if err := runMigrateCommand(customDB, args[1:]); err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			return
+		}
+
+		// Bring the schema up to date before serving requests
+		if cfg.Database.AutoMigrate {
+			if err := customDB.Migrate(); err != nil {
+				log.Fatalf("Failed to migrate database: %v", err)
+			}
+		}
+		store = db.WithTracing(customDB)
+		checker.Add("postgres", customDB.PingContext)
+		metrics.RegisterDB(dbConn, "payments")
+	}
+	if len(args) > 0 {
+		log.Fatalf("Unknown command %q", strings.Join(args, " "))
+	}
+
+	var messages bus.Bus
+	if cfg.Broker == config.BrokerMemory {
+		// Messages for other services are kept until the service stops; meant for local development without RabbitMQ
+		log.Println("Using the in-memory message broker")
+		memoryBus := busmemory.NewBus(cfg.RabbitMQ.MaxAttempts, cfg.RabbitMQ.RetryDelay)
+		metrics.RegisterQueueDepth(memoryBus.QueueDepths)
+		messages = memoryBus
+	} else {
+		// Connect to RabbitMQ; the connection is re-established in the background if it is lost
+		rabbitConn, err := rabbitmq.Connect(cfg.RabbitMQ.URL, rabbitOptions(cfg.RabbitMQ))
+		if err != nil {
+			log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		}
+		defer rabbitConn.Close() // Close RabbitMQ connection when the server stops
+		checker.Add("rabbitmq", func(context.Context) error { return rabbitConn.Check() })
+		metrics.RegisterQueueDepth(rabbitConn.QueueDepths)
+		messages = rabbitConn
+	}
 
-	// Start gRPC Server
-	listener, err := net.Listen("tcp", cfg.GRPCPort)
+	// Consumers, relays and pollers run until shutdown; they are waited for before the connections close
+	var workers sync.WaitGroup
+	background := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
+
+	// Create PaymentHandler
+	paymentHandler := grpc_server.NewPaymentHandler(store, messages)
+	paymentHandler.Fees = ledger.FeeSchedule{BasisPoints: cfg.FeeBasisPoints}
+	// Match contract events until the last retry delay, so the final attempt acknowledges events that
+	// are not ours instead of dead-lettering them
+	if cfg.RabbitMQ.MaxAttempts > 1 {
+		paymentHandler.ChainEventMatchWindow = bus.RetryDelay(cfg.RabbitMQ.RetryDelay, cfg.RabbitMQ.MaxAttempts-1)
+	}
+
+	// Set up the gRPC server
+	lis, err := net.Listen("tcp", cfg.GRPCAddr)
 	if err != nil {
-		log.Fatalf("Failed to listen on port %s: %v", cfg.GRPCPort, err)
+		log.Fatalf("Failed to listen on %s: %v", cfg.GRPCAddr, err)
 	}
-	grpcServer := grpc.NewServer() // Correctly calling the grpc.NewServer() function
 
-	// Register gRPC services
-	pb.RegisterPaymentServiceServer(grpcServer, paymentgrpc.NewPaymentHandler(dbConn, rabbitConn))
+	// Every call must carry a token issued by user-authentication, granting the permission the RPC requires
+	var verifier auth.Verifier = auth.NewJWKSVerifier(cfg.Auth.JWKSURL, cfg.Auth.Issuer, cfg.Auth.Audience)
+	if cfg.Auth.RevocationsURL != "" {
+		// Reject tokens revoked on logout or refresh token reuse before they expire
+		revocations := auth.NewRevocationList(cfg.Auth.RevocationsURL, cfg.Auth.RevocationsPollInterval)
+		background(revocations.Run)
+		verifier = auth.WithRevocations(verifier, revocations)
+	} else {
+		log.Println("auth.revocations_url is not set, revoked tokens are accepted until they expire")
+	}
+
+	// Create a new gRPC server and register the PaymentService
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+		grpc.ChainUnaryInterceptor(metrics.UnaryServerInterceptor(), apierror.UnaryServerInterceptor(), auth.UnaryServerInterceptor(verifier, grpc_server.MethodPermissions), auth.UnaryPolicyInterceptor(grpc_server.MethodPermissions)),
+		grpc.ChainStreamInterceptor(metrics.StreamServerInterceptor(), apierror.StreamServerInterceptor(), auth.StreamServerInterceptor(verifier, grpc_server.MethodPermissions), auth.StreamPolicyInterceptor(grpc_server.MethodPermissions)),
+	)
+	pb.RegisterPaymentServiceServer(grpcServer, paymentHandler)
+	background(paymentHandler.ListenForPaymentStatusUpdates)
+	background(paymentHandler.ListenForChainRefundResults)
+	background(paymentHandler.ListenForChainPaymentEvents)
 
-	// Run gRPC server in a goroutine
+	// The standard gRPC health service reports the readiness checks
+	healthServer := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	background(func(ctx context.Context) {
+		checker.Report(ctx, healthServer, readinessInterval, pb.PaymentService_ServiceDesc.ServiceName)
+	})
+
+	// Publish events written to the outbox by the handlers
+	outboxRelay := outbox.NewRelay(store, messages)
+	background(outboxRelay.Run)
+
+	// Forget the messages the consumers processed once they can no longer be delivered again
+	inboxPruner := inbox.NewPruner(store, cfg.Inbox.Retention, cfg.Inbox.PruneInterval)
+	background(inboxPruner.Run)
+
+	// Start a goroutine for gRPC server to run in the background
 	go func() {
-		log.Printf("gRPC server running on port %s", cfg.GRPCPort)
-		if err := grpcServer.Serve(listener); err != nil {
-			log.Fatalf("Failed to serve gRPC server: %v", err)
+		log.Printf("Starting gRPC server on %s...", cfg.GRPCAddr)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("Failed to start gRPC server: %v", err)
 		}
 	}()
 
-	// If you're also running HTTP server using Echo, you can start it here
-	e.GET("/health", func(c echo.Context) error {
-		return c.String(200, "Service is running")
-	})
+	// One client connection, shared by every HTTP request, carries the gateway's calls to the gRPC server
+	gatewayConn, err := grpc.NewClient(dialTarget(cfg.GRPCAddr),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()), // Carries the HTTP request's trace on to the gRPC server
+	)
+	if err != nil {
+		log.Fatalf("Failed to create gRPC client for the HTTP gateway: %v", err)
+	}
+	defer gatewayConn.Close()
+
+	// Create and configure Echo HTTP server
+	e := echo.New()
+	e.Use(tracing.Middleware("/livez", "/readyz", "/metrics"))
+	e.Use(metrics.Middleware())
+	registerRoutes(e, gatewayConn, store, verifier)
+	checker.Register(e)
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler())) // Scraped by Prometheus, without authentication
 
-	// Start HTTP server (optional)
+	// Start the Echo HTTP server
 	go func() {
-		if err := e.Start(cfg.HTTPPort); err != nil {
+		log.Printf("Starting Echo HTTP server on %s...", cfg.HTTPAddr)
+		if err := e.Start(cfg.HTTPAddr); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Failed to start HTTP server: %v", err)
 		}
 	}()
 
-	// Block the main goroutine to keep both servers running
-	select {}
+	<-ctx.Done()
+	stop() // A second signal kills the process right away
+	shutdown(cfg.ShutdownTimeout, checker, healthServer, paymentHandler, e, grpcServer, &workers)
+}
+
+// shutdown stops the service in order, within timeout: it first reports itself not ready, then stops
+// accepting requests and waits for the in-flight ones (HTTP before gRPC, since the gateway calls the
+// gRPC server), and finally waits for the consumers to finish the messages they already received.
+// The consumers stopped receiving when the shutdown began. The caller closes the connections afterwards.
+func shutdown(timeout time.Duration, checker *health.Checker, healthServer *grpchealth.Server, handler *grpc_server.PaymentHandler, e *echo.Echo, grpcServer *grpc.Server, workers *sync.WaitGroup) {
+	log.Printf("Shutting down, waiting up to %s for in-flight work...", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	checker.Drain()
+	healthServer.Shutdown()
+	handler.Watchers.Close() // Ends WatchPayment streams, which would otherwise hold the servers open
+
+	if err := e.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server did not shut down cleanly: %v", err)
+		e.Close()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("Timed out draining gRPC calls, canceling them")
+		grpcServer.Stop()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("Shutdown complete")
+	case <-ctx.Done():
+		log.Println("Timed out waiting for consumers and relays to stop")
+	}
+}
+
+// rabbitOptions returns the publishing and consuming options configured for RabbitMQ
+func rabbitOptions(cfg config.RabbitMQConfig) rabbitmq.Options {
+	return rabbitmq.Options{
+		Prefetch:       cfg.Prefetch,
+		ConfirmTimeout: cfg.ConfirmTimeout,
+		MaxAttempts:    cfg.MaxAttempts,
+		RetryDelay:     cfg.RetryDelay,
+	}
+}
+
+// dialTarget turns a listen address into one the HTTP gateway can dial (e.g., ":50051" -> "localhost:50051")
+func dialTarget(listenAddr string) string {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return listenAddr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		return net.JoinHostPort("localhost", port)
+	}
+	return listenAddr
 }
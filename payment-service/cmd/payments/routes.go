@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	apierror "github.com/Go-payments/internal/api/error"
+	"github.com/Go-payments/internal/api/gateway"
+	middlewares "github.com/Go-payments/internal/api/middleware"
+	"github.com/Go-payments/internal/auth"
+	"github.com/Go-payments/internal/db"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+)
+
+// registerRoutes adds the HTTP routes: the gateway to the gRPC server behind conn, and the ledger reports
+func registerRoutes(e *echo.Echo, conn grpc.ClientConnInterface, store db.PaymentStore, verifier auth.Verifier) {
+	gateway.New(conn).Register(e)
+
+	// Trial balance of the payments ledger for the finance team; read straight from the store, so
+	// authentication and authorization happen here rather than in the gRPC service
+	e.GET("/v1/ledger/trial-balance", func(c echo.Context) error {
+		tb, err := store.TrialBalance(c.Request().Context())
+		if err != nil {
+			log.Printf("Error computing trial balance: %v", err)
+			return apierror.Database(err)
+		}
+
+		type accountLine struct {
+			Account  string `json:"account"`
+			Currency string `json:"currency"`
+			Debits   string `json:"debits"`
+			Credits  string `json:"credits"`
+			Balance  string `json:"balance"`
+		}
+		type currencyTotal struct {
+			Currency string `json:"currency"`
+			Debits   string `json:"debits"`
+			Credits  string `json:"credits"`
+			Balanced bool   `json:"balanced"`
+		}
+
+		accounts := make([]accountLine, 0, len(tb.Accounts))
+		for _, a := range tb.Accounts {
+			accounts = append(accounts, accountLine{a.Account.Code, a.Account.Currency, a.Debits.String(), a.Credits.String(), a.Balance().String()})
+		}
+		totals := make([]currencyTotal, 0, len(tb.Totals))
+		for _, t := range tb.Totals {
+			totals = append(totals, currencyTotal{t.Currency, t.Debits.String(), t.Credits.String(), t.Balanced()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"accounts": accounts,
+			"totals":   totals,
+			"balanced": tb.Check() == nil,
+		})
+	}, middlewares.AuthMiddleware(verifier), middlewares.RequirePermission(auth.PermissionReadLedger))
+}
@@ -1,10 +1,184 @@
-// grpc/errors.go (or wherever you want to define your errors)
-package grpc
+// Package apierror is the error model of the payment API. Domain errors map onto canonical gRPC
+// status codes, carrying google.rpc error details clients can act on:
+//
+//   - invalid input: InvalidArgument with a BadRequest listing the offending fields
+//   - unknown payments: NotFound with a ResourceInfo naming the payment
+//   - reused idempotency keys: AlreadyExists with a ResourceInfo
+//   - illegal status transitions: FailedPrecondition with a PreconditionFailure
+//   - amounts over a limit, such as what is left to refund: OutOfRange with a BadRequest
+//   - concurrent updates and database outages: Aborted or Unavailable with a RetryInfo
+//
+// Anything else is an internal error: it is logged, and clients only see a generic message.
+// The HTTP gateway translates the codes into HTTP statuses and renders the details as JSON.
+package apierror
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/money"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
 
 var (
 	ErrInvalidAmount = errors.New("invalid payment amount")
 	ErrDatabase      = errors.New("database error")
 	ErrInternal      = errors.New("internal server error")
-)
\ No newline at end of file
+)
+
+// RetryDelay is how long clients are asked to wait before retrying after a transient failure
+const RetryDelay = time.Second
+
+// ViolationStatus is the PreconditionFailure type of requests the payment's current status does not allow
+const ViolationStatus = "STATUS"
+
+// InvalidArgument rejects a request field; description says what is wrong with it
+func InvalidArgument(field, description string) error {
+	return newStatus(codes.InvalidArgument, description, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: description}},
+	})
+}
+
+// InvalidAmount rejects a Money field that could not be parsed, pointing at its currency or value
+func InvalidAmount(field string, err error) error {
+	switch {
+	case errors.Is(err, money.ErrUnknownCurrency):
+		field += ".currency"
+	case errors.Is(err, money.ErrInvalidAmount), errors.Is(err, money.ErrTooPrecise):
+		field += ".value"
+	}
+	return InvalidArgument(field, fmt.Sprintf("%v: %v", ErrInvalidAmount, err))
+}
+
+// NotFound reports that a resource, such as a payment, does not exist
+func NotFound(resourceType, name string) error {
+	return newStatus(codes.NotFound, fmt.Sprintf("%s %s not found", resourceType, name), &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: name,
+	})
+}
+
+// AlreadyExists reports that a resource the request would create, such as an idempotency key, exists already
+func AlreadyExists(resourceType, name, description string) error {
+	return newStatus(codes.AlreadyExists, description, &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: name,
+		Description:  description,
+	})
+}
+
+// FailedPrecondition reports that the state of subject (e.g., "payment/<id>") does not allow the request
+func FailedPrecondition(violationType, subject, description string) error {
+	return newStatus(codes.FailedPrecondition, description, &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{Type: violationType, Subject: subject, Description: description}},
+	})
+}
+
+// LimitExceeded rejects a field whose value is over a limit set by the current state, such as a refund
+// larger than what is left to refund. Unlike InvalidArgument, the same value may be fine later on.
+func LimitExceeded(field, description string) error {
+	return newStatus(codes.OutOfRange, description, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: description}},
+	})
+}
+
+// Aborted reports a conflict with a concurrent request; retrying the request is safe
+func Aborted(description string) error {
+	return newStatus(codes.Aborted, description, retryInfo())
+}
+
+// Database reports a failed database call. The cause is left out of the message, so callers log it.
+// Most database failures are transient, so clients are asked to retry.
+func Database(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return newStatus(codes.Unavailable, ErrDatabase.Error(), retryInfo())
+}
+
+// Internal reports a bug or an inconsistency clients cannot do anything about. The cause is left out
+// of the message, so callers log it.
+func Internal() error {
+	return status.Error(codes.Internal, ErrInternal.Error())
+}
+
+// FromError converts an error returned by a handler into a gRPC status. Errors that already are a
+// status are kept; known domain errors get their code; anything else is logged and becomes Internal.
+func FromError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, db.ErrNotFound), errors.Is(err, db.ErrRefundNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, db.ErrIdempotencyKeyExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, lifecycle.ErrIllegalTransition):
+		return FailedPrecondition(ViolationStatus, "", err.Error())
+	case errors.Is(err, db.ErrStatusConflict):
+		return Aborted(err.Error())
+	case errors.Is(err, ErrInvalidAmount), errors.Is(err, lifecycle.ErrUnknownStatus),
+		errors.Is(err, money.ErrInvalidAmount), errors.Is(err, money.ErrTooPrecise),
+		errors.Is(err, money.ErrUnknownCurrency), errors.Is(err, money.ErrCurrencyMismatch):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrDatabase):
+		return Database(err)
+	}
+
+	log.Printf("Unhandled error: %v", err)
+	return Internal()
+}
+
+// UnaryServerInterceptor converts the errors of unary handlers with FromError, so clients never see codes.Unknown
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, FromError(err)
+	}
+}
+
+// StreamServerInterceptor converts the errors of streaming handlers with FromError
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return FromError(handler(srv, ss))
+	}
+}
+
+// RetryDelayOf returns the delay a status asks clients to wait before retrying, if it has one
+func RetryDelayOf(st *status.Status) (time.Duration, bool) {
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			return info.RetryDelay.AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+func retryInfo() *errdetails.RetryInfo {
+	return &errdetails.RetryInfo{RetryDelay: durationpb.New(RetryDelay)}
+}
+
+// newStatus builds a status error with details, falling back to the bare status if they cannot be encoded
+func newStatus(c codes.Code, message string, details ...protoadapt.MessageV1) error {
+	st := status.New(c, message)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	apierror "github.com/Go-payments/internal/api/error"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// errorBody is the body of every error response:
+//
+//	{"error": {"code": "NOT_FOUND", "message": "payment 42 not found", "details": [
+//	  {"@type": "type.googleapis.com/google.rpc.ResourceInfo", "resource_type": "payment", "resource_name": "42"}]}}
+//
+// code is the gRPC status code name and details are the status details in their protobuf JSON form,
+// so HTTP and gRPC clients can handle errors the same way.
+type errorBody struct {
+	Error errorStatus `json:"error"`
+}
+
+type errorStatus struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// detailOptions encode error details without their unset fields, which say nothing here
+var detailOptions = protojson.MarshalOptions{UseProtoNames: true}
+
+// httpStatus maps gRPC codes to HTTP statuses, following google.rpc.Code
+var httpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499, // Client closed request
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusConflict,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatus returns the HTTP status matching a gRPC code
+func HTTPStatus(c codes.Code) int {
+	if s, ok := httpStatus[c]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// grpcCode maps HTTP statuses raised outside of RPCs (by Echo or middleware) back to gRPC codes
+func grpcCode(httpCode int) codes.Code {
+	switch httpCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if httpCode >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// writeError writes the error body for a gRPC (or any other) error
+func writeError(c echo.Context, err error) error {
+	st := status.Convert(err)
+	return writeStatus(c, HTTPStatus(st.Code()), st)
+}
+
+// writeStatus writes the error body for a status. A RetryInfo detail also sets the Retry-After header.
+func writeStatus(c echo.Context, httpCode int, st *status.Status) error {
+	body := errorStatus{
+		Code:    code.Code(st.Code()).String(),
+		Message: st.Message(),
+	}
+	for _, detail := range st.Proto().GetDetails() {
+		data, err := detailOptions.Marshal(detail)
+		if err != nil {
+			c.Logger().Errorf("failed to encode error detail %s: %v", detail.GetTypeUrl(), err)
+			continue
+		}
+		body.Details = append(body.Details, data)
+	}
+
+	if delay, ok := apierror.RetryDelayOf(st); ok {
+		seconds := int(math.Ceil(delay.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	}
+	return c.JSON(httpCode, errorBody{Error: body})
+}
+
+// HTTPErrorHandler renders errors returned by handlers and middleware with the gateway's error body
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	// Echo errors keep their HTTP status; anything else is reported as a gRPC status
+	var writeErr error
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		st := status.New(grpcCode(httpErr.Code), fmt.Sprint(httpErr.Message))
+		writeErr = writeStatus(c, httpErr.Code, st)
+	} else if _, ok := status.FromError(err); ok {
+		writeErr = writeError(c, err)
+	} else {
+		c.Logger().Error(err)
+		writeErr = writeError(c, status.Error(codes.Internal, http.StatusText(http.StatusInternalServerError)))
+	}
+	if writeErr != nil {
+		c.Logger().Error(writeErr)
+	}
+}
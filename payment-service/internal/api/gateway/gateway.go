@@ -0,0 +1,281 @@
+// Package gateway exposes the PaymentService RPCs as an HTTP/JSON API.
+//
+// Every route forwards to the gRPC server over one shared client connection, so authentication,
+// authorization and validation happen in exactly one place. Requests and responses are the RPC
+// messages in their protobuf JSON form, with snake_case field names. The same route table drives
+// the OpenAPI document served at /v1/openapi.json.
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Gateway translates HTTP requests into PaymentService calls
+type Gateway struct {
+	client pb.PaymentServiceClient
+}
+
+// New creates a gateway calling the PaymentService through conn, which is shared by all requests
+func New(conn grpc.ClientConnInterface) *Gateway {
+	return &Gateway{client: pb.NewPaymentServiceClient(conn)}
+}
+
+// route maps an HTTP endpoint onto an RPC. Path parameters (":transaction_id") fill the request
+// field of the same name; the other fields come from the JSON body or, without one, the query string.
+type route struct {
+	method    string
+	path      string
+	rpc       string            // PaymentService method name
+	body      bool              // Request fields are read from a JSON body
+	headers   map[string]string // HTTP headers mapped to request fields
+	stream    bool              // Server-streaming RPC, served as Server-Sent Events
+	successor string            // Route replacing this deprecated one, named in the OpenAPI document
+	handle    func(g *Gateway, c echo.Context, r route) error
+}
+
+var routes = []route{
+	{method: http.MethodPost, path: "/v1/payments", rpc: "MakePayment", body: true,
+		headers: map[string]string{"Idempotency-Key": "idempotency_key"},
+		handle:  unary(pb.PaymentServiceClient.MakePayment)},
+	{method: http.MethodGet, path: "/v1/payments", rpc: "ListPayments",
+		handle: unary(pb.PaymentServiceClient.ListPayments)},
+	{method: http.MethodGet, path: "/v1/payments/:transaction_id", rpc: "GetPaymentStatus",
+		handle: unary(pb.PaymentServiceClient.GetPaymentStatus)},
+	{method: http.MethodPost, path: "/v1/payments/:transaction_id/status", rpc: "UpdatePaymentStatus", body: true,
+		handle: unary(pb.PaymentServiceClient.UpdatePaymentStatus)},
+	{method: http.MethodPost, path: "/v1/payments/:transaction_id/refunds", rpc: "RefundPayment", body: true,
+		headers: map[string]string{"Idempotency-Key": "idempotency_key"},
+		handle:  unary(pb.PaymentServiceClient.RefundPayment)},
+	{method: http.MethodGet, path: "/v1/payments/:transaction_id/events", rpc: "WatchPayment", stream: true,
+		handle: (*Gateway).watchPayment},
+
+	// The routes served before /v1, kept for existing clients
+	{method: http.MethodPost, path: "/make-payment", rpc: "MakePayment", body: true,
+		headers:   map[string]string{"Idempotency-Key": "idempotency_key"},
+		successor: "POST /v1/payments",
+		handle:    unary(pb.PaymentServiceClient.MakePayment)},
+	{method: http.MethodPost, path: "/get-payment-status", rpc: "GetPaymentStatus", body: true,
+		successor: "GET /v1/payments/{transaction_id}",
+		handle:    unary(pb.PaymentServiceClient.GetPaymentStatus)},
+}
+
+// Register adds a route for every RPC, and the OpenAPI document, to e. It also installs an error
+// handler so errors raised by Echo itself (unknown routes, middleware) use the same error body.
+func (g *Gateway) Register(e *echo.Echo) {
+	e.HTTPErrorHandler = HTTPErrorHandler
+	for _, r := range routes {
+		r := r
+		e.Add(r.method, r.path, func(c echo.Context) error {
+			if r.successor != "" {
+				c.Response().Header().Set("Deprecation", "true")
+				c.Response().Header().Set("Link", `</v1/openapi.json>; rel="deprecation"`)
+			}
+			return r.handle(g, c, r)
+		})
+	}
+	e.GET("/v1/openapi.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, OpenAPI())
+	})
+}
+
+var (
+	unmarshalOptions = protojson.UnmarshalOptions{}
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+)
+
+// unary builds the handler of a unary RPC from its client method
+func unary[Req, Resp proto.Message](call func(pb.PaymentServiceClient, context.Context, Req, ...grpc.CallOption) (Resp, error)) func(*Gateway, echo.Context, route) error {
+	return func(g *Gateway, c echo.Context, r route) error {
+		var zero Req
+		req := zero.ProtoReflect().New().Interface().(Req)
+		if err := bind(c, r, req); err != nil {
+			return writeError(c, err)
+		}
+
+		resp, err := call(g.client, forwardAuth(c), req)
+		if err != nil {
+			return writeError(c, err)
+		}
+		return writeMessage(c, http.StatusOK, resp)
+	}
+}
+
+// watchPayment streams the payment's status changes as Server-Sent Events until it reaches a final
+// status or the client disconnects
+func (g *Gateway) watchPayment(c echo.Context, r route) error {
+	req := &pb.WatchPaymentRequest{}
+	if err := bind(c, r, req); err != nil {
+		return writeError(c, err)
+	}
+
+	stream, err := g.client.WatchPayment(forwardAuth(c), req)
+	if err != nil {
+		return writeError(c, err)
+	}
+
+	// Errors such as an unknown payment only arrive with the first message
+	event, err := stream.Recv()
+	if err != nil {
+		return writeError(c, err)
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		data, err := marshalOptions.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return nil
+		}
+		w.Flush()
+
+		if event, err = stream.Recv(); err != nil {
+			// io.EOF means the payment reached a final status; anything else ends the stream too
+			return nil
+		}
+	}
+}
+
+// bind fills req from the body or query string, the headers and the path parameters of the request
+func bind(c echo.Context, r route, req proto.Message) error {
+	msg := req.ProtoReflect()
+	fields := msg.Descriptor().Fields()
+
+	if r.body {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to read request body: %v", err)
+		}
+		if len(strings.TrimSpace(string(body))) > 0 {
+			if err := unmarshalOptions.Unmarshal(body, req); err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+			}
+		}
+	} else {
+		for name, values := range c.QueryParams() {
+			fd := fields.ByName(protoreflect.Name(name))
+			if fd == nil || len(values) == 0 {
+				continue // e.g., access_token, which forwardAuth handles
+			}
+			if err := setField(msg, fd, values[0]); err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid %s: %v", name, err)
+			}
+		}
+	}
+
+	for header, name := range r.headers {
+		if err := bindValue(msg, fields.ByName(protoreflect.Name(name)), header+" header", c.Request().Header.Get(header)); err != nil {
+			return err
+		}
+	}
+	for _, name := range c.ParamNames() {
+		if err := bindValue(msg, fields.ByName(protoreflect.Name(name)), name, c.Param(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindValue sets a field from a header or path parameter, which must agree with the body if both are given
+func bindValue(msg protoreflect.Message, fd protoreflect.FieldDescriptor, source, value string) error {
+	if fd == nil || value == "" {
+		return nil
+	}
+	if msg.Has(fd) && msg.Get(fd).String() != value {
+		return status.Errorf(codes.InvalidArgument, "%s does not match %s in the body", source, fd.Name())
+	}
+	if err := setField(msg, fd, value); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid %s: %v", source, err)
+	}
+	return nil
+}
+
+// setField parses a string into a singular scalar or timestamp field
+func setField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, value string) error {
+	if fd.IsList() || fd.IsMap() {
+		return fmt.Errorf("repeated fields are not supported here")
+	}
+
+	var v protoreflect.Value
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(value)
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		v = protoreflect.ValueOfInt32(int32(n))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		v = protoreflect.ValueOfInt64(n)
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() != "google.protobuf.Timestamp" {
+			return fmt.Errorf("must be given in the request body")
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("%q is not an RFC 3339 timestamp", value)
+		}
+		v = protoreflect.ValueOfMessage(timestamppb.New(t).ProtoReflect())
+	default:
+		return fmt.Errorf("unsupported field type %s", fd.Kind())
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+// writeMessage writes a response message in its protobuf JSON form
+func writeMessage(c echo.Context, code int, msg proto.Message) error {
+	data, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return writeError(c, status.Errorf(codes.Internal, "failed to encode response: %v", err))
+	}
+	return c.JSONBlob(code, data)
+}
+
+// forwardAuth passes the caller's bearer token on to the gRPC server, which authenticates every call.
+// Browsers cannot set headers on EventSource requests, so an access_token query parameter is accepted too.
+func forwardAuth(c echo.Context) context.Context {
+	ctx := c.Request().Context()
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if header == "" && c.QueryParam("access_token") != "" {
+		header = "Bearer " + c.QueryParam("access_token")
+	}
+	if header == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", header)
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	grpc_server "github.com/Go-payments/internal/api/grpc"
+	"github.com/Go-payments/internal/auth"
+	"github.com/Go-payments/internal/db/memory"
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestGateway serves the gateway in front of a payment service on an in-memory store, with every
+// call authenticated as alice
+func newTestGateway(t *testing.T) *echo.Echo {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(auth.NewContext(ctx, auth.Principal{UserID: "alice"}), req)
+	}))
+	pb.RegisterPaymentServiceServer(server, grpc_server.NewPaymentHandler(memory.NewStore(), nil))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	e := echo.New()
+	New(conn).Register(e)
+	return e
+}
+
+// post sends a JSON body to the gateway and decodes the JSON response
+func post(t *testing.T, e *echo.Echo, path, body string, headers map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("POST %s returned %d with invalid JSON %q: %v", path, rec.Code, rec.Body, err)
+	}
+	return rec, resp
+}
+
+func TestDeprecatedRoutes(t *testing.T) {
+	e := newTestGateway(t)
+	payment := `{"receiver_id": "bob", "amount": {"currency": "USD", "value": "12.50"}}`
+	key := map[string]string{"Idempotency-Key": "order-1"}
+
+	rec, first := post(t, e, "/make-payment", payment, key)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /make-payment = %d %v", rec.Code, first)
+	}
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Error("POST /make-payment does not announce its deprecation")
+	}
+
+	// The old route shares the idempotency keys of the new one
+	rec, retry := post(t, e, "/v1/payments", payment, key)
+	if rec.Code != http.StatusOK || retry["transaction_id"] != first["transaction_id"] {
+		t.Errorf("POST /v1/payments with the same key = %d %v, want transaction %v", rec.Code, retry, first["transaction_id"])
+	}
+	rec, conflict := post(t, e, "/make-payment", `{"receiver_id": "bob", "amount": {"currency": "USD", "value": "99.00"}}`, key)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("POST /make-payment reusing the key = %d %v, want %d", rec.Code, conflict, http.StatusConflict)
+	}
+
+	rec, status := post(t, e, "/get-payment-status", `{"transaction_id": "`+first["transaction_id"].(string)+`"}`, nil)
+	if rec.Code != http.StatusOK || status["status"] != "PENDING" {
+		t.Errorf("POST /get-payment-status = %d %v, want PENDING", rec.Code, status)
+	}
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Error("POST /get-payment-status does not announce its deprecation")
+	}
+}
+
+func TestOpenAPIOperationIDsAreUnique(t *testing.T) {
+	seen := map[string]string{}
+	for path, item := range OpenAPI()["paths"].(map[string]interface{}) {
+		for method, op := range item.(map[string]interface{}) {
+			id := op.(map[string]interface{})["operationId"].(string)
+			if other, ok := seen[id]; ok {
+				t.Errorf("operation ID %s used by %s %s and %s", id, method, path, other)
+			}
+			seen[id] = method + " " + path
+		}
+	}
+}
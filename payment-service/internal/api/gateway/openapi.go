@@ -0,0 +1,296 @@
+package gateway
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	grpc_server "github.com/Go-payments/internal/api/grpc"
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// OpenAPI returns the OpenAPI 3 document of the gateway. Schemas come from the compiled descriptors
+// of payments.proto and descriptions from its comments, so the document follows the proto file.
+var OpenAPI = sync.OnceValue(func() map[string]interface{} {
+	return buildOpenAPI(pb.File_internal_api_grpc_payments_proto.Services().ByName("PaymentService"), parseProtoDocs(grpc_server.ProtoSource))
+})
+
+func buildOpenAPI(service protoreflect.ServiceDescriptor, docs map[string]string) map[string]interface{} {
+	b := &schemaBuilder{docs: docs, schemas: map[string]interface{}{
+		"Error": map[string]interface{}{
+			"type":        "object",
+			"description": "Body of every error response; code is the gRPC status code name (e.g., NOT_FOUND)",
+			"properties": map[string]interface{}{
+				"error": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"code":    map[string]interface{}{"type": "string"},
+						"message": map[string]interface{}{"type": "string"},
+						"details": map[string]interface{}{
+							"type":        "array",
+							"description": "google.rpc error details (BadRequest, ResourceInfo, PreconditionFailure, RetryInfo), named by @type",
+							"items": map[string]interface{}{
+								"type":                 "object",
+								"properties":           map[string]interface{}{"@type": map[string]interface{}{"type": "string"}},
+								"additionalProperties": true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	paths := map[string]interface{}{}
+	for _, r := range routes {
+		method := service.Methods().ByName(protoreflect.Name(r.rpc))
+		path, pathParams := openAPIPath(r.path)
+
+		var params []interface{}
+		for _, name := range pathParams {
+			params = append(params, b.parameter("path", name, method.Input().Fields().ByName(protoreflect.Name(name)), method.Input(), true))
+		}
+		for header, name := range r.headers {
+			params = append(params, b.parameter("header", header, method.Input().Fields().ByName(protoreflect.Name(name)), method.Input(), false))
+		}
+
+		op := map[string]interface{}{
+			"operationId": r.rpc,
+			"summary":     docs[string(service.Name())+"."+r.rpc],
+			"responses": map[string]interface{}{
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     jsonContent(map[string]interface{}{"$ref": "#/components/schemas/Error"}),
+				},
+			},
+		}
+		if r.successor != "" {
+			op["operationId"] = r.rpc + "Deprecated" // Operation IDs must be unique
+			op["deprecated"] = true
+			op["description"] = "Deprecated: use " + r.successor + " instead."
+		}
+
+		skip := map[string]bool{}
+		for _, name := range pathParams {
+			skip[name] = true
+		}
+		if r.body {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(b.object(method.Input(), skip)),
+			}
+		} else {
+			fields := method.Input().Fields()
+			for i := 0; i < fields.Len(); i++ {
+				fd := fields.Get(i)
+				if skip[string(fd.Name())] || fd.IsList() || (fd.Kind() == protoreflect.MessageKind && fd.Message().FullName() != "google.protobuf.Timestamp") {
+					continue
+				}
+				params = append(params, b.parameter("query", string(fd.Name()), fd, method.Input(), false))
+			}
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		var ok map[string]interface{}
+		if !r.stream {
+			ok = map[string]interface{}{"description": "OK", "content": jsonContent(b.ref(method.Output()))}
+		} else {
+			b.ref(method.Output()) // The events are described in the components all the same
+			ok = map[string]interface{}{
+				"description": "Server-Sent Events named \"status\", each carrying a " + string(method.Output().Name()) + " as JSON",
+				"content": map[string]interface{}{
+					"text/event-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+				},
+			}
+		}
+		op["responses"].(map[string]interface{})["200"] = ok
+
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(r.method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       string(service.Name()),
+			"version":     "v1",
+			"description": docs[string(service.Name())],
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}},
+	}
+}
+
+// openAPIPath converts an Echo path ("/v1/payments/:transaction_id") to OpenAPI form and lists its parameters
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			params = append(params, s[1:])
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// schemaBuilder collects the schemas of the messages referenced by the document
+type schemaBuilder struct {
+	docs    map[string]string
+	schemas map[string]interface{}
+}
+
+// ref returns a reference to a message's schema, adding the schema on first use
+func (b *schemaBuilder) ref(md protoreflect.MessageDescriptor) map[string]interface{} {
+	if md.FullName() == "google.protobuf.Timestamp" {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	name := string(md.Name())
+	if _, ok := b.schemas[name]; !ok {
+		b.schemas[name] = nil // Guards against recursion
+		b.schemas[name] = b.object(md, nil)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// object returns the schema of a message, leaving out the skipped fields
+func (b *schemaBuilder) object(md protoreflect.MessageDescriptor, skip map[string]bool) map[string]interface{} {
+	properties := map[string]interface{}{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if skip[string(fd.Name())] {
+			continue
+		}
+		properties[string(fd.Name())] = b.field(fd, md)
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if doc := b.docs[string(md.Name())]; doc != "" {
+		schema["description"] = doc
+	}
+	return schema
+}
+
+// field returns the schema of a field as protojson encodes it
+func (b *schemaBuilder) field(fd protoreflect.FieldDescriptor, parent protoreflect.MessageDescriptor) map[string]interface{} {
+	var schema map[string]interface{}
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		schema = map[string]interface{}{"type": "string"}
+	case protoreflect.BoolKind:
+		schema = map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		schema = map[string]interface{}{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		schema = map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		schema = map[string]interface{}{"type": "string", "format": "int64"} // protojson encodes 64-bit integers as strings
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		schema = map[string]interface{}{"type": "number"}
+	case protoreflect.BytesKind:
+		schema = map[string]interface{}{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		var values []interface{}
+		for i := 0; i < fd.Enum().Values().Len(); i++ {
+			values = append(values, string(fd.Enum().Values().Get(i).Name()))
+		}
+		schema = map[string]interface{}{"type": "string", "enum": values}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		schema = b.ref(fd.Message())
+	}
+
+	if fd.IsList() {
+		schema = map[string]interface{}{"type": "array", "items": schema}
+	}
+	if doc := b.docs[string(parent.Name())+"."+string(fd.Name())]; doc != "" {
+		if _, isRef := schema["$ref"]; isRef {
+			schema = map[string]interface{}{"allOf": []interface{}{schema}} // Siblings of $ref are ignored
+		}
+		schema["description"] = doc
+	}
+	return schema
+}
+
+// parameter describes a path, query or header parameter filling a request field
+func (b *schemaBuilder) parameter(in, name string, fd protoreflect.FieldDescriptor, parent protoreflect.MessageDescriptor, required bool) map[string]interface{} {
+	schema := b.field(fd, parent)
+	param := map[string]interface{}{"name": name, "in": in, "required": required, "schema": schema}
+	if doc, ok := schema["description"]; ok {
+		param["description"] = doc
+		delete(schema, "description")
+	}
+	return param
+}
+
+var (
+	protoComment = regexp.MustCompile(`^\s*//\s?(.*)$`)
+	protoBlock   = regexp.MustCompile(`^\s*(service|message)\s+(\w+)\s*\{`)
+	protoRPC     = regexp.MustCompile(`^\s*rpc\s+(\w+)\s*\(`)
+	protoField   = regexp.MustCompile(`^\s*(?:repeated\s+)?[\w.]+\s+(\w+)\s*=\s*\d+\s*;\s*(?://\s?(.*))?$`)
+)
+
+// parseProtoDocs collects the comments of a proto file: the comments above services, messages and
+// rpcs, keyed "Service", "Message" and "Service.Method", and the comments next to (or above) fields,
+// keyed "Message.field". It understands the subset of the syntax payments.proto uses.
+func parseProtoDocs(src string) map[string]string {
+	docs := map[string]string{}
+	var pending []string
+	var scope []string
+	take := func() string {
+		doc := strings.Join(pending, " ")
+		pending = nil
+		return strings.TrimSpace(doc)
+	}
+	set := func(key, doc string) {
+		if doc != "" {
+			docs[key] = doc
+		}
+	}
+
+	for _, line := range strings.Split(src, "\n") {
+		if m := protoComment.FindStringSubmatch(line); m != nil {
+			pending = append(pending, strings.TrimSpace(m[1]))
+			continue
+		}
+		if m := protoBlock.FindStringSubmatch(line); m != nil {
+			set(m[2], take())
+			scope = append(scope, m[2])
+			continue
+		}
+		if m := protoRPC.FindStringSubmatch(line); m != nil && len(scope) > 0 {
+			set(scope[len(scope)-1]+"."+m[1], take())
+			continue
+		}
+		if m := protoField.FindStringSubmatch(line); m != nil && len(scope) > 0 {
+			doc := take()
+			if strings.TrimSpace(m[2]) != "" {
+				doc = strings.TrimSpace(m[2])
+			}
+			set(scope[len(scope)-1]+"."+m[1], doc)
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "}") && len(scope) > 0 {
+			scope = scope[:len(scope)-1]
+		}
+		pending = nil
+	}
+	return docs
+}
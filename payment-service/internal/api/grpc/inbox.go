@@ -0,0 +1,49 @@
+package grpc_server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+
+	"github.com/Go-payments/bus"
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/metrics"
+)
+
+// inboxMessage identifies a message received from a queue in the inbox by its event ID. A message
+// without one, published before the event envelope by a publisher that set no message ID, is logged,
+// counted and identified by the SHA-256 of its body instead, which every redelivery keeps.
+func inboxMessage(queue string, msg bus.Message, messageID string) *db.InboxMessage {
+	if messageID == "" {
+		sum := sha256.Sum256(msg.Body)
+		messageID = "sha256:" + hex.EncodeToString(sum[:])
+		log.Printf("Message from %s has no ID, deduplicating it by its content as %s", queue, messageID)
+		metrics.QueueMissingIDs.WithLabelValues(queue).Inc()
+	}
+	return &db.InboxMessage{Consumer: queue, MessageID: messageID}
+}
+
+// alreadyProcessed reports whether a received message was already processed, in which case it is
+// acknowledged without being handled again. Recording the message with its changes is what guarantees
+// it is applied once; this check spares a redelivery the failures of reapplying it, such as an illegal
+// transition from a status the payment has left since.
+func (h *PaymentHandler) alreadyProcessed(ctx context.Context, inbox *db.InboxMessage) (bool, error) {
+	if inbox == nil {
+		return false, nil
+	}
+	processed, err := h.DB.HasProcessedMessage(ctx, *inbox)
+	if err != nil {
+		return false, err
+	}
+	if processed {
+		skipDuplicate(inbox)
+	}
+	return processed, nil
+}
+
+// skipDuplicate logs and counts a message acknowledged without being handled again
+func skipDuplicate(inbox *db.InboxMessage) {
+	log.Printf("Skipping message %s from %s, already processed", inbox.MessageID, inbox.Consumer)
+	metrics.QueueDuplicates.WithLabelValues(inbox.Consumer).Inc()
+}
@@ -0,0 +1,155 @@
+package grpc_server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	apierror "github.com/Go-payments/internal/api/error"
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/lifecycle"
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pageToken is the decoded form of the opaque page tokens handed to clients
+type pageToken struct {
+	CreatedAt     time.Time `json:"c"`
+	TransactionID string    `json:"t"`
+	Filter        string    `json:"f"` // Fingerprint of the filters the token was issued for
+}
+
+// ListPayments returns a page of the payments the caller sent or received
+func (h *PaymentHandler) ListPayments(ctx context.Context, req *pb.ListPaymentsRequest) (*pb.ListPaymentsResponse, error) {
+	// Callers can only list their own payments, unless they may read everyone's
+	partyID, err := readingAs(ctx, "party_id", req.PartyId)
+	if err != nil {
+		return nil, err
+	}
+	req.PartyId = partyID
+
+	filter := db.PaymentFilter{
+		PartyID:     req.PartyId,
+		SenderID:    req.SenderId,
+		ReceiverID:  req.ReceiverId,
+		Currency:    strings.ToUpper(req.Currency),
+		OldestFirst: req.OldestFirst,
+	}
+	if req.Status != "" {
+		s, err := lifecycle.ParseStatus(req.Status)
+		if err != nil {
+			return nil, apierror.InvalidArgument("status", err.Error())
+		}
+		filter.Status = string(s)
+	}
+	if req.CreatedAfter != nil {
+		filter.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+	if req.CreatedBefore != nil {
+		filter.CreatedBefore = req.CreatedBefore.AsTime()
+	}
+
+	switch {
+	case req.PageSize < 0:
+		return nil, apierror.InvalidArgument("page_size", "page_size must not be negative")
+	case req.PageSize == 0:
+		filter.Limit = defaultPageSize
+	case req.PageSize > maxPageSize:
+		filter.Limit = maxPageSize
+	default:
+		filter.Limit = int(req.PageSize)
+	}
+
+	fingerprint := listFingerprint(req)
+	if req.PageToken != "" {
+		cursor, err := decodePageToken(req.PageToken, fingerprint)
+		if err != nil {
+			return nil, apierror.InvalidArgument("page_token", fmt.Sprintf("invalid page_token: %v", err))
+		}
+		filter.After = cursor
+	}
+
+	// Fetch one extra payment to learn whether there is another page
+	limit := filter.Limit
+	filter.Limit++
+	payments, err := h.DB.ListPayments(ctx, filter)
+	if err != nil {
+		log.Printf("Error listing payments for %s: %v", req.PartyId, err)
+		return nil, apierror.Database(err)
+	}
+
+	resp := &pb.ListPaymentsResponse{}
+	if len(payments) > limit {
+		payments = payments[:limit]
+		last := payments[limit-1]
+		resp.NextPageToken = encodePageToken(pageToken{
+			CreatedAt:     last.CreatedAt,
+			TransactionID: last.TransactionID,
+			Filter:        fingerprint,
+		})
+	}
+	for _, p := range payments {
+		resp.Payments = append(resp.Payments, paymentToProto(p))
+	}
+	return resp, nil
+}
+
+// paymentToProto converts a stored payment into its wire representation
+func paymentToProto(p *db.Payment) *pb.Payment {
+	return &pb.Payment{
+		TransactionId: p.TransactionID,
+		SenderId:      p.SenderID,
+		ReceiverId:    p.ReceiverID,
+		Amount:        moneyToProto(p.Amount),
+		Refunded:      moneyToProto(p.Refunded),
+		Status:        p.Status,
+		ChainTxHash:   p.ChainTxHash,
+		CreatedAt:     timestamppb.New(p.CreatedAt),
+		UpdatedAt:     timestamppb.New(p.UpdatedAt),
+	}
+}
+
+// listFingerprint hashes the filters of a list request so a page token cannot be replayed with different ones
+func listFingerprint(req *pb.ListPaymentsRequest) string {
+	clone := proto.Clone(req).(*pb.ListPaymentsRequest)
+	clone.PageSize = 0
+	clone.PageToken = ""
+
+	body, _ := proto.MarshalOptions{Deterministic: true}.Marshal(clone)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:8])
+}
+
+// encodePageToken turns a cursor into an opaque, URL-safe token
+func encodePageToken(t pageToken) string {
+	body, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+// decodePageToken reverses encodePageToken and checks the token belongs to the same filters
+func decodePageToken(token, fingerprint string) (*db.PaymentCursor, error) {
+	body, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var t pageToken
+	if err := json.Unmarshal(body, &t); err != nil || t.TransactionID == "" {
+		return nil, fmt.Errorf("malformed token")
+	}
+	if t.Filter != fingerprint {
+		return nil, fmt.Errorf("token was issued for different filters")
+	}
+	return &db.PaymentCursor{CreatedAt: t.CreatedAt, TransactionID: t.TransactionID}, nil
+}
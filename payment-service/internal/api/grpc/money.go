@@ -0,0 +1,24 @@
+package grpc_server
+
+import (
+	"fmt"
+
+	"github.com/Go-payments/internal/money"
+	pb "github.com/Go-payments/internal/proto/grpc"
+)
+
+// moneyFromProto converts a Money message into an exact amount, rejecting missing or malformed values
+func moneyFromProto(m *pb.Money) (money.Amount, error) {
+	if m == nil {
+		return money.Amount{}, fmt.Errorf("amount is required")
+	}
+	return money.Parse(m.Value, m.Currency)
+}
+
+// moneyToProto converts an exact amount into its wire representation
+func moneyToProto(a money.Amount) *pb.Money {
+	return &pb.Money{
+		Currency: a.Currency(),
+		Value:    a.String(),
+	}
+}
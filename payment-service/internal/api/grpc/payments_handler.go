@@ -2,160 +2,436 @@ package grpc_server
 
 import (
 	"context"
-	"database/sql" // Importing the SQL package to handle database queries
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"time"
+	"github.com/Go-payments/bus"
+	apierror "github.com/Go-payments/internal/api/error"
+	"github.com/Go-payments/internal/auth"
 	"github.com/Go-payments/internal/db"
-	"github.com/Go-payments/internal/rabbitmq"
+	"github.com/Go-payments/internal/events"
+	"github.com/Go-payments/internal/events/eventspb"
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/metrics"
+	"github.com/Go-payments/internal/tracing"
+	"github.com/Go-payments/internal/watch"
 	"github.com/google/uuid" // For generating unique transaction IDs
+	"google.golang.org/grpc/peer"
 	"google.golang.org/protobuf/proto" // Import the proto package for unmarshalling
 	pb "github.com/Go-payments/internal/proto/grpc" // Import the generated proto package
 )
 
+// errRefundOnly is returned when a status update tries to mark a payment as refunded directly
+var errRefundOnly = errors.New("refund statuses can only be set by RefundPayment")
+
 // PaymentHandler structure to handle payment logic
 type PaymentHandler struct {
 	pb.UnimplementedPaymentServiceServer // Embeds the unimplemented methods to allow for graceful upgrades
-	DB         *db.DB
-	RabbitConn *rabbitmq.Connection
+	DB       db.PaymentStore
+	Messages bus.Subscriber     // Delivers the status updates and blockchain events the handler applies
+	Fees     ledger.FeeSchedule // Fee charged when a payment settles
+	Watchers *watch.Hub         // Receives every status change made by the handler, waking its watchers
+
+	// WatchPollInterval is how often WatchPayment reads the status history, for the changes made by
+	// other replicas
+	WatchPollInterval time.Duration
+
+	// ChainEventMatchWindow is how long after it was published a contract event for an unknown
+	// transaction is retried, in case the transaction's payment is not recorded yet. After that the
+	// event is taken to be another caller's and acknowledged; the window must end before the retries
+	// do, or the event is dead-lettered instead.
+	ChainEventMatchWindow time.Duration
 }
 
+// DefaultWatchPollInterval bounds how late WatchPayment streams a change made by another replica
+const DefaultWatchPollInterval = 2 * time.Second
+
+// DefaultChainEventMatchWindow suits the default retry schedule (5 attempts, 1s doubling), whose last
+// attempt comes 15s after the first
+const DefaultChainEventMatchWindow = 8 * time.Second
+
 // NewPaymentHandler creates and returns a new PaymentHandler instance
-func NewPaymentHandler(dbConn *db.DB, rabbitConn *rabbitmq.Connection) *PaymentHandler {
+func NewPaymentHandler(store db.PaymentStore, messages bus.Subscriber) *PaymentHandler {
 	return &PaymentHandler{
-		DB:         dbConn,
-		RabbitConn: rabbitConn,
+		DB:       store,
+		Messages: messages,
+		Watchers: watch.NewHub(),
+
+		WatchPollInterval:     DefaultWatchPollInterval,
+		ChainEventMatchWindow: DefaultChainEventMatchWindow,
 	}
 }
 
 // MakePayment processes a payment request and generates a transaction ID
 func (h *PaymentHandler) MakePayment(ctx context.Context, req *pb.PaymentRequest) (*pb.PaymentResponse, error) {
-	log.Printf("Processing payment from %s to %s with amount %f", req.SenderId, req.ReceiverId, req.Amount)
+	// Payments can only be made from the caller's own account
+	senderID, err := actingAs(ctx, "sender_id", req.SenderId)
+	if err != nil {
+		return nil, err
+	}
+	req.SenderId = senderID
+
+	// Parse the amount exactly; values with more precision than the currency allows are rejected, not rounded
+	amount, err := moneyFromProto(req.Amount)
+	if err != nil {
+		log.Printf("Invalid payment amount: %v", err)
+		return nil, apierror.InvalidAmount("amount", err)
+	}
+
+	log.Printf("Processing payment from %s to %s with amount %s %s", req.SenderId, req.ReceiverId, amount, amount.Currency())
 
 	// Validate input (e.g., check if amount is greater than zero)
-	if req.Amount <= 0 {
-		return nil, fmt.Errorf("invalid payment amount")
+	if amount.Sign() <= 0 {
+		return nil, apierror.InvalidArgument("amount.value", "payment amount must be greater than zero")
+	}
+
+	// A retried request with a known idempotency key returns the original outcome
+	var fingerprint string
+	if req.IdempotencyKey != "" {
+		fingerprint = requestFingerprint(req)
+		rec, err := h.DB.GetIdempotencyRecord(ctx, req.SenderId, req.IdempotencyKey)
+		if err == nil {
+			var response pb.PaymentResponse
+			if err := replayIdempotentResponse(rec, fingerprint, &response); err != nil {
+				return nil, err
+			}
+			return &response, nil
+		}
+		if !errors.Is(err, db.ErrNotFound) {
+			log.Printf("Error fetching idempotency key: %v", err)
+			return nil, apierror.Database(err)
+		}
 	}
 
 	// Generate a unique transaction ID using UUID
 	transactionID := uuid.New().String()
 
-	// Save payment in the database along with the transaction ID
-	err := h.DB.SavePayment(req.SenderId, req.ReceiverId, float64(req.Amount), transactionID)
-	if err != nil {
-		log.Printf("Error saving payment: %v", err)
-		return nil, fmt.Errorf("database error")
+	// The response is fixed up front so it can be stored alongside the idempotency key
+	response := &pb.PaymentResponse{
+		TransactionId: transactionID, // Include the transaction ID in the response
+		Status:        string(lifecycle.Pending), // Initial status set to PENDING
+		Message:       "Payment processing, please check status later.",
 	}
 
-	// Publish payment event to RabbitMQ
-	paymentUpdate := &pb.PaymentUpdateRequest{
+	// Announce the new payment through the outbox; the relay publishes it once the payment is committed
+	body, err := events.Marshal(events.TypePaymentStatusUpdate, transactionID, &eventspb.PaymentStatusUpdate{
 		TransactionId: transactionID, // Use the actual transaction ID
-		Status:        "PENDING",     // Initially set to PENDING
-	}
-
-	// Marshal the payment update into a byte slice (for logging or processing if needed)
-	body, err := proto.Marshal(paymentUpdate)
+		Status:        string(lifecycle.Pending), // Initially set to PENDING
+	})
 	if err != nil {
 		log.Printf("Error marshaling payment event: %v", err)
-		return nil, fmt.Errorf("internal error")
+		return nil, apierror.Internal()
 	}
 
-	// Log the marshaled data for debugging (optional)
-	log.Printf("Marshalled payment update: %x", body)
+	payment := db.NewPayment{
+		TransactionID: transactionID,
+		SenderID:      req.SenderId,
+		ReceiverID:    req.ReceiverId,
+		Amount:        amount,
+		Entries: []ledger.Entry{ledger.PaymentAccepted(ledger.Payment{
+			TransactionID: transactionID,
+			SenderID:      req.SenderId,
+			ReceiverID:    req.ReceiverId,
+			Amount:        amount,
+		})},
+		Events: []db.OutboxMessage{{
+			Queue:        "payment_updates",
+			ContentType:  events.ContentType,
+			Body:         body,
+			TraceContext: tracing.Inject(ctx), // Consumers continue this request's trace
+		}},
+	}
 
-	// Publish the original paymentUpdate object to RabbitMQ (not the marshaled body)
-	err = h.RabbitConn.Publish("payment_updates", paymentUpdate)
+	// Store the response with the idempotency key so retries can replay it
+	if req.IdempotencyKey != "" {
+		stored, err := proto.Marshal(response)
+		if err != nil {
+			log.Printf("Error marshaling payment response: %v", err)
+			return nil, apierror.Internal()
+		}
+		payment.Idempotency = &db.IdempotencyRecord{
+			SenderID:      req.SenderId,
+			Key:           req.IdempotencyKey,
+			Fingerprint:   fingerprint,
+			TransactionID: transactionID,
+			Response:      stored,
+		}
+	}
+
+	// Save payment, idempotency key, ledger entry and outbox event in a single database transaction
+	err = h.DB.CreatePayment(ctx, payment)
+	if errors.Is(err, db.ErrIdempotencyKeyExists) {
+		// A concurrent request claimed the key first, so answer with its outcome
+		rec, getErr := h.DB.GetIdempotencyRecord(ctx, req.SenderId, req.IdempotencyKey)
+		if getErr != nil {
+			log.Printf("Error fetching idempotency key: %v", getErr)
+			return nil, apierror.Database(getErr)
+		}
+		var response pb.PaymentResponse
+		if err := replayIdempotentResponse(rec, fingerprint, &response); err != nil {
+			return nil, err
+		}
+		return &response, nil
+	}
 	if err != nil {
-		log.Printf("Error publishing payment event: %v", err)
-		return nil, fmt.Errorf("internal error")
+		log.Printf("Error saving payment: %v", err)
+		return nil, apierror.Database(err)
 	}
+	metrics.PaymentsCreated.WithLabelValues(amount.Currency()).Inc()
 
 	// Return response with the transaction ID and payment status
-	return &pb.PaymentResponse{
-		TransactionId: transactionID, // Include the transaction ID in the response
-		Status:        "PENDING",     // Initial status set to PENDING
-		Message:       "Payment processing, please check status later.",
-	}, nil
+	return response, nil
+}
+
+// replayIdempotentResponse reads the stored response into response, or rejects the replay if its body
+// differs from the original
+func replayIdempotentResponse(rec *db.IdempotencyRecord, fingerprint string, response proto.Message) error {
+	if rec.Fingerprint != fingerprint {
+		log.Printf("Idempotency key %s reused with a different request", rec.Key)
+		return apierror.AlreadyExists("idempotency_key", rec.Key,
+			fmt.Sprintf("idempotency key %q was already used with a different request", rec.Key))
+	}
+
+	if err := proto.Unmarshal(rec.Response, response); err != nil {
+		log.Printf("Error unmarshalling stored response: %v", err)
+		return apierror.Internal()
+	}
+
+	log.Printf("Replaying response for idempotency key %s (transaction %s)", rec.Key, rec.TransactionID)
+	return nil
+}
+
+// requestFingerprint hashes a request without its idempotency_key field,
+// so replays can be compared against the request that first used the key
+func requestFingerprint(req proto.Message) string {
+	clone := proto.Clone(req).ProtoReflect()
+	clone.Clear(clone.Descriptor().Fields().ByName("idempotency_key"))
+
+	// Deterministic marshaling keeps the hash stable for equal requests
+	body, _ := proto.MarshalOptions{Deterministic: true}.Marshal(clone.Interface())
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
 }
 
 // GetPaymentStatus retrieves the payment status for a given payment ID
 func (h *PaymentHandler) GetPaymentStatus(ctx context.Context, req *pb.PaymentStatusRequest) (*pb.PaymentStatusResponse, error) {
 	log.Printf("Fetching payment status for transaction ID: %s", req.TransactionId)
 
-	// Fetch payment status from the database
-	status, err := h.DB.GetPaymentStatus(req.TransactionId)
+	// Fetch the payment from the database; only its parties may see it
+	payment, err := h.DB.GetPayment(ctx, req.TransactionId)
 	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, apierror.NotFound("payment", req.TransactionId)
+		}
 		log.Printf("Error fetching payment status: %v", err)
-		return nil, fmt.Errorf("failed to fetch payment status")
+		return nil, apierror.Database(err)
+	}
+	if err := authorizeParty(ctx, payment); err != nil {
+		return nil, err
 	}
 
 	// Return the payment status in the response
 	return &pb.PaymentStatusResponse{
 		TransactionId: req.TransactionId,
-		Status:        status,
+		Status:        payment.Status,
 		Message:       "Payment status retrieved successfully",
 	}, nil
 }
 
-// UpdatePaymentStatus updates the status of a payment in the database and returns a response
+// UpdatePaymentStatus moves a payment to a new status if the payment lifecycle allows it
 func (h *PaymentHandler) UpdatePaymentStatus(ctx context.Context, req *pb.PaymentUpdateRequest) (*pb.PaymentUpdateResponse, error) {
 	log.Printf("Updating payment status for transaction ID: %s to status: %s", req.TransactionId, req.Status)
 
-	// Check if the payment exists in the database before updating
-	var existingStatus string
-	err := h.DB.QueryRow("SELECT status FROM payments WHERE transaction_id = $1", req.TransactionId).Scan(&existingStatus)
+	target, err := lifecycle.ParseStatus(req.Status)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("No payment found with transaction ID: %s", req.TransactionId)
-		}
-		log.Printf("Error fetching payment for transaction ID %s: %v", req.TransactionId, err)
-		return nil, fmt.Errorf("failed to fetch payment status for transaction ID %s", req.TransactionId)
+		return nil, apierror.InvalidArgument("status", err.Error())
 	}
 
-	// Update the payment status in the database
-	err = h.DB.UpdatePaymentStatus(req.TransactionId, req.Status)
-	if err != nil {
-		log.Printf("Error updating payment status: %v", err)
-		return nil, fmt.Errorf("failed to update payment status")
+	if err := h.transitionPayment(ctx, req.TransactionId, target, callerActor(ctx), req.Reason, req.ChainTxHash, nil); err != nil {
+		return nil, transitionStatusError(req.TransactionId, err)
 	}
 
 	// Return the response indicating successful status update
 	return &pb.PaymentUpdateResponse{
 		TransactionId: req.TransactionId,
-		Status:        req.Status,
+		Status:        string(target),
 		Message:       "Payment status updated successfully",
 	}, nil
 }
 
-// Listen for updates from RabbitMQ and update the payment status in the database
-func (h *PaymentHandler) ListenForPaymentStatusUpdates() {
-	// Consume messages from the "payment_updates" queue
-	msgs, err := h.RabbitConn.Consume("payment_updates")
+// callerActor identifies who made an RPC for audit records: the authenticated user, or the
+// caller's address if the request was not authenticated
+func callerActor(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return "user:" + p.UserID
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		return "grpc:" + p.Addr.String()
+	}
+	return "grpc"
+}
+
+// transitionPayment moves a payment from its current status to the target status and posts the
+// ledger entries for the move. Re-applying the current status is a no-op, so duplicate updates are harmless.
+// The received message that caused the move, if any, is recorded with it in inbox, and
+// db.ErrDuplicateMessage is returned if it was already processed.
+func (h *PaymentHandler) transitionPayment(ctx context.Context, transactionID string, target lifecycle.Status, actor, reason, chainTxHash string, inbox *db.InboxMessage) error {
+	// Refunded statuses carry refund amounts, so they can only be reached through RefundPayment
+	if target.IsRefund() {
+		return errRefundOnly
+	}
+
+	payment, err := h.DB.GetPayment(ctx, transactionID)
+	if err != nil {
+		return err
+	}
+
+	from, err := lifecycle.ParseStatus(payment.Status)
+	if err != nil {
+		return err
+	}
+	if from == target {
+		log.Printf("Payment %s is already %s, nothing to do", transactionID, target)
+		return nil
+	}
+	if err := lifecycle.ValidateTransition(from, target); err != nil {
+		return err
+	}
+
+	entries, err := ledger.ForTransition(ledger.Payment{
+		TransactionID: payment.TransactionID,
+		SenderID:      payment.SenderID,
+		ReceiverID:    payment.ReceiverID,
+		Amount:        payment.Amount,
+	}, from, target, h.Fees)
+	if err != nil {
+		return fmt.Errorf("failed to build ledger entries: %v", err)
+	}
+
+	// The database re-checks the transition and only applies it if the status is still the one we read
+	err = h.DB.TransitionPaymentStatus(ctx, db.StatusTransition{
+		TransactionID: transactionID,
+		From:          from,
+		To:            target,
+		Actor:         actor,
+		Reason:        reason,
+		ChainTxHash:   chainTxHash,
+		Entries:       entries,
+		Inbox:         inbox,
+	})
+	if err != nil {
+		return err
+	}
+	metrics.PaymentStatusChanges.WithLabelValues(string(target), payment.Amount.Currency()).Inc()
+
+	h.Watchers.Publish(watch.Event{
+		TransactionID: transactionID,
+		From:          from,
+		To:            target,
+		Reason:        reason,
+		ChainTxHash:   chainTxHash,
+		OccurredAt:    time.Now(),
+	})
+	return nil
+}
+
+// transitionStatusError maps a failed status transition onto a gRPC status
+func transitionStatusError(transactionID string, err error) error {
+	var transitionErr *lifecycle.TransitionError
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return apierror.NotFound("payment", transactionID)
+	case errors.Is(err, errRefundOnly):
+		return apierror.InvalidArgument("status", "use RefundPayment to refund a payment")
+	case errors.As(err, &transitionErr):
+		return apierror.FailedPrecondition(apierror.ViolationStatus, "payment/"+transactionID,
+			fmt.Sprintf("payment %s cannot move from %s to %s", transactionID, transitionErr.From, transitionErr.To))
+	case errors.Is(err, db.ErrStatusConflict):
+		return apierror.Aborted(fmt.Sprintf("payment %s was updated concurrently, retry the request", transactionID))
+	default:
+		log.Printf("Error updating payment status for transaction %s: %v", transactionID, err)
+		return apierror.Internal()
+	}
+}
+
+// Listen for updates from the "payment_updates" queue and update the payment status in the database.
+// Returns once ctx is canceled and the messages already received are handled.
+func (h *PaymentHandler) ListenForPaymentStatusUpdates(ctx context.Context) {
+	err := h.Messages.Subscribe(ctx, "payment_updates", func(ctx context.Context, msg bus.Message) error {
+		return h.applyStatusUpdate(ctx, msg)
+	})
 	if err != nil {
 		log.Fatalf("Failed to start consuming messages: %v", err)
 	}
+}
 
-	// Process the messages
-	for msg := range msgs {
-		// Log the raw message for debugging
-		log.Printf("Received message: %s", msg.Body)
+// messageError marks the failures to handle a message that no retry can fix (e.g., an unknown payment
+// or an illegal transition) as permanent, so the message is dead-lettered right away. Other failures,
+// such as the database being briefly unavailable, are retried.
+func messageError(err error) error {
+	var transitionErr *lifecycle.TransitionError
+	switch {
+	case errors.Is(err, db.ErrNotFound), errors.Is(err, db.ErrRefundNotFound), errors.Is(err, errRefundOnly), errors.As(err, &transitionErr):
+		return bus.Permanent(err)
+	default:
+		return err
+	}
+}
 
-		// Unmarshal the Protobuf message into a PaymentUpdateRequest
-		var statusUpdate pb.PaymentUpdateRequest
-		err := proto.Unmarshal(msg.Body, &statusUpdate)
-		if err != nil {
-			log.Printf("Error unmarshalling payment status update message: %v", err)
-			continue
-		}
+// decodeStatusUpdate decodes a status update, either in an event envelope or as the bare
+// PaymentUpdateRequest published before the envelope, whose fields PaymentStatusUpdate shares. It
+// returns the ID of the event, or of the message for a bare update, empty if the publisher set none.
+func decodeStatusUpdate(msg bus.Message) (*eventspb.PaymentStatusUpdate, string, error) {
+	statusUpdate := &eventspb.PaymentStatusUpdate{}
+	if events.IsEnvelope(msg) {
+		event, err := events.Unmarshal(msg, events.TypePaymentStatusUpdate, statusUpdate)
+		return statusUpdate, event.ID, err
+	}
+	return statusUpdate, msg.ID, proto.Unmarshal(msg.Body, statusUpdate)
+}
 
-		// Log the unmarshalled data
-		log.Printf("Received payment status update: Transaction ID: %s, Status: %s", statusUpdate.TransactionId, statusUpdate.Status)
+// applyStatusUpdate applies one status update received from the "payment_updates" queue, once: an
+// update delivered again is acknowledged without being applied. A failed update is retried, or
+// dead-lettered if it cannot succeed.
+func (h *PaymentHandler) applyStatusUpdate(ctx context.Context, msg bus.Message) error {
+	// Log the raw message for debugging
+	log.Printf("Received message: %q", msg.Body)
 
-		// Update the payment status in the database
-		err = h.DB.UpdatePaymentStatus(statusUpdate.TransactionId, "SUCCESSFUL")//statusUpdate.Status
-		if err != nil {
-			log.Printf("Error updating payment status for transaction %s: %v", statusUpdate.TransactionId, err)
-		} else {
-			log.Printf("Successfully updated payment status for transaction %s: %s", statusUpdate.TransactionId, statusUpdate.Status)
-		}
+	statusUpdate, messageID, err := decodeStatusUpdate(msg)
+	if err != nil {
+		log.Printf("Error unmarshalling payment status update message: %v", err)
+		return bus.Permanent(fmt.Errorf("malformed status update: %v", err))
+	}
+
+	inbox := inboxMessage("payment_updates", msg, messageID)
+	if processed, err := h.alreadyProcessed(ctx, inbox); err != nil || processed {
+		return err
+	}
+
+	// Log the unmarshalled data
+	log.Printf("Received payment status update: Transaction ID: %s, Status: %s", statusUpdate.TransactionId, statusUpdate.Status)
+
+	target, err := lifecycle.ParseStatus(statusUpdate.Status)
+	if err != nil {
+		log.Printf("Ignoring status update for transaction %s: %v", statusUpdate.TransactionId, err)
+		return bus.Permanent(err)
+	}
+
+	// Apply the transition; illegal transitions are rejected by the state machine
+	err = h.transitionPayment(ctx, statusUpdate.TransactionId, target, "rabbitmq:payment_updates", statusUpdate.Reason, statusUpdate.ChainTxHash, inbox)
+	if errors.Is(err, db.ErrDuplicateMessage) {
+		// Another delivery of the update was applied concurrently
+		skipDuplicate(inbox)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error updating payment status for transaction %s: %v", statusUpdate.TransactionId, err)
+		return messageError(err)
 	}
+	log.Printf("Successfully updated payment status for transaction %s: %s", statusUpdate.TransactionId, statusUpdate.Status)
+	return nil
 }
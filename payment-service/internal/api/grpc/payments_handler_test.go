@@ -0,0 +1,210 @@
+package grpc_server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Go-payments/internal/auth"
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/db/memory"
+	"github.com/Go-payments/internal/lifecycle"
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// as returns a context authenticated as userID, the way the auth interceptors leave it
+func as(userID string) context.Context {
+	return auth.NewContext(context.Background(), auth.Principal{UserID: userID})
+}
+
+func usd(value string) *pb.Money {
+	return &pb.Money{Currency: "USD", Value: value}
+}
+
+// pay makes a payment from alice to bob and returns its transaction ID
+func pay(t *testing.T, h *PaymentHandler, value string) string {
+	t.Helper()
+	resp, err := h.MakePayment(as("alice"), &pb.PaymentRequest{ReceiverId: "bob", Amount: usd(value)})
+	if err != nil {
+		t.Fatalf("MakePayment: %v", err)
+	}
+	return resp.TransactionId
+}
+
+// moveTo moves a payment through the given statuses as the settlement service would
+func moveTo(t *testing.T, h *PaymentHandler, transactionID string, statuses ...lifecycle.Status) {
+	t.Helper()
+	for _, to := range statuses {
+		_, err := h.UpdatePaymentStatus(as("settlement"), &pb.PaymentUpdateRequest{TransactionId: transactionID, Status: string(to)})
+		if err != nil {
+			t.Fatalf("UpdatePaymentStatus(%s): %v", to, err)
+		}
+	}
+}
+
+func TestMakePaymentReplaysIdempotentRequests(t *testing.T) {
+	store := memory.NewStore()
+	h := NewPaymentHandler(store, nil)
+	req := &pb.PaymentRequest{ReceiverId: "bob", Amount: usd("25.00"), IdempotencyKey: "order-1"}
+
+	first, err := h.MakePayment(as("alice"), req)
+	if err != nil {
+		t.Fatalf("MakePayment: %v", err)
+	}
+	retry, err := h.MakePayment(as("alice"), req)
+	if err != nil {
+		t.Fatalf("MakePayment retry: %v", err)
+	}
+	if retry.TransactionId != first.TransactionId {
+		t.Errorf("retry created transaction %s, want the original %s", retry.TransactionId, first.TransactionId)
+	}
+
+	payments, err := store.ListPayments(context.Background(), db.PaymentFilter{PartyID: "alice", Limit: 10})
+	if err != nil {
+		t.Fatalf("ListPayments: %v", err)
+	}
+	if len(payments) != 1 {
+		t.Errorf("%d payments stored, want 1", len(payments))
+	}
+
+	// The key belongs to the sender, so another sender may use it for a payment of their own
+	other, err := h.MakePayment(as("carol"), &pb.PaymentRequest{ReceiverId: "bob", Amount: usd("25.00"), IdempotencyKey: "order-1"})
+	if err != nil {
+		t.Fatalf("MakePayment by another sender: %v", err)
+	}
+	if other.TransactionId == first.TransactionId {
+		t.Error("another sender's request replayed alice's payment")
+	}
+}
+
+func TestMakePaymentRejectsReusedIdempotencyKey(t *testing.T) {
+	h := NewPaymentHandler(memory.NewStore(), nil)
+
+	_, err := h.MakePayment(as("alice"), &pb.PaymentRequest{ReceiverId: "bob", Amount: usd("25.00"), IdempotencyKey: "order-1"})
+	if err != nil {
+		t.Fatalf("MakePayment: %v", err)
+	}
+	_, err = h.MakePayment(as("alice"), &pb.PaymentRequest{ReceiverId: "bob", Amount: usd("30.00"), IdempotencyKey: "order-1"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("MakePayment with a reused key = %v, want AlreadyExists", err)
+	}
+}
+
+func TestUpdatePaymentStatusRejectsIllegalTransitions(t *testing.T) {
+	h := NewPaymentHandler(memory.NewStore(), nil)
+	pending := pay(t, h, "10.00")
+	completed := pay(t, h, "10.00")
+	moveTo(t, h, completed, lifecycle.Submitted, lifecycle.Completed)
+
+	tests := []struct {
+		name          string
+		transactionID string
+		status        string
+		want          codes.Code
+	}{
+		{name: "skipping settlement", transactionID: pending, status: string(lifecycle.Completed), want: codes.FailedPrecondition},
+		{name: "back from a completed payment", transactionID: completed, status: string(lifecycle.Pending), want: codes.FailedPrecondition},
+		{name: "failing a completed payment", transactionID: completed, status: string(lifecycle.Failed), want: codes.FailedPrecondition},
+		{name: "refund without RefundPayment", transactionID: completed, status: string(lifecycle.Refunded), want: codes.InvalidArgument},
+		{name: "unknown status", transactionID: pending, status: "SETTLED", want: codes.InvalidArgument},
+		{name: "unknown payment", transactionID: "missing", status: string(lifecycle.Submitted), want: codes.NotFound},
+		{name: "current status again", transactionID: completed, status: string(lifecycle.Completed), want: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.UpdatePaymentStatus(as("settlement"), &pb.PaymentUpdateRequest{TransactionId: tt.transactionID, Status: tt.status})
+			if status.Code(err) != tt.want {
+				t.Errorf("UpdatePaymentStatus(%s) = %v, want %s", tt.status, err, tt.want)
+			}
+		})
+	}
+
+	// Rejected transitions leave the payments as they were
+	for id, want := range map[string]lifecycle.Status{pending: lifecycle.Pending, completed: lifecycle.Completed} {
+		resp, err := h.GetPaymentStatus(as("alice"), &pb.PaymentStatusRequest{TransactionId: id})
+		if err != nil {
+			t.Fatalf("GetPaymentStatus: %v", err)
+		}
+		if resp.Status != string(want) {
+			t.Errorf("payment %s is %s, want %s", id, resp.Status, want)
+		}
+	}
+}
+
+func TestRefundPaymentRejectsOverRefund(t *testing.T) {
+	h := NewPaymentHandler(memory.NewStore(), nil)
+	id := pay(t, h, "100.00")
+	moveTo(t, h, id, lifecycle.Submitted, lifecycle.Completed)
+
+	tests := []struct {
+		name       string
+		amount     *pb.Money
+		want       codes.Code
+		wantStatus lifecycle.Status
+	}{
+		{name: "partial refund", amount: usd("60.00"), wantStatus: lifecycle.PartiallyRefunded},
+		{name: "more than is left", amount: usd("40.01"), want: codes.OutOfRange},
+		{name: "other currency", amount: &pb.Money{Currency: "EUR", Value: "10.00"}, want: codes.InvalidArgument},
+		{name: "zero", amount: usd("0"), want: codes.InvalidArgument},
+		{name: "the rest", wantStatus: lifecycle.Refunded},
+		{name: "fully refunded", amount: usd("0.01"), want: codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := h.RefundPayment(as("bob"), &pb.RefundRequest{TransactionId: id, Amount: tt.amount})
+			if status.Code(err) != tt.want {
+				t.Fatalf("RefundPayment = %v, want %s", err, tt.want)
+			}
+			if err == nil && resp.Status != string(tt.wantStatus) {
+				t.Errorf("payment is %s after the refund, want %s", resp.Status, tt.wantStatus)
+			}
+		})
+	}
+
+	resp, err := h.GetPaymentStatus(as("alice"), &pb.PaymentStatusRequest{TransactionId: id})
+	if err != nil {
+		t.Fatalf("GetPaymentStatus: %v", err)
+	}
+	if resp.Status != string(lifecycle.Refunded) {
+		t.Errorf("payment is %s, want %s", resp.Status, lifecycle.Refunded)
+	}
+}
+
+func TestRefundPaymentReplaysIdempotentRequests(t *testing.T) {
+	h := NewPaymentHandler(memory.NewStore(), nil)
+	id := pay(t, h, "100.00")
+	moveTo(t, h, id, lifecycle.Submitted, lifecycle.Completed)
+	req := &pb.RefundRequest{TransactionId: id, IdempotencyKey: "refund-1"}
+
+	first, err := h.RefundPayment(as("bob"), req)
+	if err != nil {
+		t.Fatalf("RefundPayment: %v", err)
+	}
+	// The payment is fully refunded now, yet the retry still gets the original answer
+	retry, err := h.RefundPayment(as("bob"), req)
+	if err != nil {
+		t.Fatalf("RefundPayment retry: %v", err)
+	}
+	if retry.RefundId != first.RefundId || retry.Status != string(lifecycle.Refunded) {
+		t.Errorf("retry returned refund %s (%s), want the original %s (%s)", retry.RefundId, retry.Status, first.RefundId, lifecycle.Refunded)
+	}
+
+	_, err = h.RefundPayment(as("bob"), &pb.RefundRequest{TransactionId: id, Amount: usd("10.00"), IdempotencyKey: "refund-1"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("RefundPayment with a reused key = %v, want AlreadyExists", err)
+	}
+}
+
+func TestRefundPaymentOnlyByReceiver(t *testing.T) {
+	h := NewPaymentHandler(memory.NewStore(), nil)
+	id := pay(t, h, "100.00")
+	moveTo(t, h, id, lifecycle.Submitted, lifecycle.Completed)
+
+	_, err := h.RefundPayment(as("alice"), &pb.RefundRequest{TransactionId: id})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RefundPayment by the sender = %v, want PermissionDenied", err)
+	}
+}
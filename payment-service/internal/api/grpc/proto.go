@@ -0,0 +1,9 @@
+package grpc_server
+
+import _ "embed"
+
+// ProtoSource is payments.proto itself. The compiled descriptors drop comments, so the HTTP gateway
+// reads the API documentation from here.
+//
+//go:embed payments.proto
+var ProtoSource string
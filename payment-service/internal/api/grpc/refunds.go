@@ -0,0 +1,314 @@
+package grpc_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Go-payments/bus"
+	apierror "github.com/Go-payments/internal/api/error"
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/events"
+	"github.com/Go-payments/internal/events/eventspb"
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/metrics"
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"github.com/Go-payments/internal/tracing"
+	"github.com/Go-payments/internal/watch"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// chainRefundQueue carries compensating transfer commands to the blockchain service
+	chainRefundQueue = "blockchain_refunds"
+
+	// chainRefundResultQueue carries the outcome of compensating transfers back from the blockchain service
+	chainRefundResultQueue = "blockchain_refund_results"
+)
+
+// chainRefundResult reports the outcome of a compensating transfer, as the blockchain service published it
+// before the event envelope
+type chainRefundResult struct {
+	RefundID    string `json:"refund_id"`
+	ChainTxHash string `json:"chain_tx_hash"` // Compensating transfer, if one was sent
+	Error       string `json:"error"`         // Why the transfer failed, empty on success
+}
+
+// RefundPayment returns all or part of a completed payment to its sender. Partial refunds may be
+// repeated until the whole amount is refunded; asking for more than is left is rejected.
+func (h *PaymentHandler) RefundPayment(ctx context.Context, req *pb.RefundRequest) (*pb.RefundResponse, error) {
+	log.Printf("Refunding payment %s", req.TransactionId)
+
+	payment, err := h.DB.GetPayment(ctx, req.TransactionId)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, apierror.NotFound("payment", req.TransactionId)
+		}
+		log.Printf("Error fetching payment %s: %v", req.TransactionId, err)
+		return nil, apierror.Database(err)
+	}
+
+	// Refunds return the receiver's money, so only the receiver can issue them
+	if _, err := actingAs(ctx, "receiver", payment.ReceiverID); err != nil {
+		return nil, err
+	}
+
+	// A retried request with a known idempotency key returns the original outcome, even once the
+	// payment has nothing left to refund. Keys are scoped to the receiver, who issues the refund.
+	var fingerprint string
+	if req.IdempotencyKey != "" {
+		fingerprint = requestFingerprint(req)
+		rec, err := h.DB.GetIdempotencyRecord(ctx, payment.ReceiverID, req.IdempotencyKey)
+		if err == nil {
+			var response pb.RefundResponse
+			if err := replayIdempotentResponse(rec, fingerprint, &response); err != nil {
+				return nil, err
+			}
+			return &response, nil
+		}
+		if !errors.Is(err, db.ErrNotFound) {
+			log.Printf("Error fetching idempotency key: %v", err)
+			return nil, apierror.Database(err)
+		}
+	}
+
+	from, err := lifecycle.ParseStatus(payment.Status)
+	if err != nil {
+		log.Printf("Payment %s has an unknown status: %v", req.TransactionId, err)
+		return nil, apierror.Internal()
+	}
+	if from != lifecycle.Completed && from != lifecycle.PartiallyRefunded {
+		return nil, apierror.FailedPrecondition(apierror.ViolationStatus, "payment/"+req.TransactionId,
+			fmt.Sprintf("payment %s is %s; only completed payments can be refunded", req.TransactionId, from))
+	}
+
+	refundable, err := payment.Amount.Sub(payment.Refunded)
+	if err != nil {
+		log.Printf("Payment %s has inconsistent refund totals: %v", req.TransactionId, err)
+		return nil, apierror.Internal()
+	}
+
+	// Without an amount, refund whatever has not been refunded yet
+	amount := refundable
+	if req.Amount != nil {
+		if amount, err = moneyFromProto(req.Amount); err != nil {
+			return nil, apierror.InvalidAmount("amount", err)
+		}
+		if amount.Currency() != payment.Amount.Currency() {
+			return nil, apierror.InvalidArgument("amount.currency",
+				fmt.Sprintf("refund currency %s does not match payment currency %s", amount.Currency(), payment.Amount.Currency()))
+		}
+	}
+	if amount.Sign() <= 0 {
+		return nil, apierror.InvalidArgument("amount.value", "refund amount must be greater than zero")
+	}
+	if cmp, _ := amount.Cmp(refundable); cmp > 0 {
+		return nil, apierror.LimitExceeded("amount.value",
+			fmt.Sprintf("refund of %s %s exceeds the refundable %s %s", amount, amount.Currency(), refundable, refundable.Currency()))
+	}
+
+	remaining, _ := refundable.Sub(amount)
+	target := lifecycle.PartiallyRefunded
+	if remaining.IsZero() {
+		target = lifecycle.Refunded
+	}
+
+	refund := db.NewRefund{
+		RefundID:         uuid.New().String(),
+		TransactionID:    payment.TransactionID,
+		Amount:           amount,
+		PreviousRefunded: payment.Refunded,
+		From:             from,
+		To:               target,
+		Status:           db.RefundCompleted,
+		Actor:            callerActor(ctx),
+		Reason:           req.Reason,
+		Entries: []ledger.Entry{ledger.Refund(ledger.Payment{
+			TransactionID: payment.TransactionID,
+			SenderID:      payment.SenderID,
+			ReceiverID:    payment.ReceiverID,
+			Amount:        payment.Amount,
+		}, amount)},
+	}
+
+	// On-chain payments also need a compensating transfer, which the blockchain service makes
+	if payment.ChainTxHash != "" {
+		event, err := newChainRefundEvent(ctx, refund, payment)
+		if err != nil {
+			log.Printf("Error building refund command: %v", err)
+			return nil, apierror.Internal()
+		}
+		refund.Status = db.RefundPending
+		refund.Events = []db.OutboxMessage{event}
+	}
+
+	// The response is fixed up front so it can be stored alongside the idempotency key
+	refundedTotal, _ := payment.Refunded.Add(amount)
+	response := &pb.RefundResponse{
+		RefundId:      refund.RefundID,
+		TransactionId: payment.TransactionID,
+		Status:        string(target),
+		Refunded:      moneyToProto(amount),
+		RefundedTotal: moneyToProto(refundedTotal),
+		Refundable:    moneyToProto(remaining),
+		RefundStatus:  refund.Status,
+		Message:       "Refund processed successfully",
+	}
+	if req.IdempotencyKey != "" {
+		stored, err := proto.Marshal(response)
+		if err != nil {
+			log.Printf("Error marshaling refund response: %v", err)
+			return nil, apierror.Internal()
+		}
+		refund.Idempotency = &db.IdempotencyRecord{
+			SenderID:      payment.ReceiverID,
+			Key:           req.IdempotencyKey,
+			Fingerprint:   fingerprint,
+			TransactionID: payment.TransactionID,
+			Response:      stored,
+		}
+	}
+
+	err = h.DB.CreateRefund(ctx, refund)
+	if errors.Is(err, db.ErrIdempotencyKeyExists) {
+		// A concurrent retry claimed the key first, so answer with its outcome
+		rec, getErr := h.DB.GetIdempotencyRecord(ctx, payment.ReceiverID, req.IdempotencyKey)
+		if getErr != nil {
+			log.Printf("Error fetching idempotency key: %v", getErr)
+			return nil, apierror.Database(getErr)
+		}
+		var replayed pb.RefundResponse
+		if err := replayIdempotentResponse(rec, fingerprint, &replayed); err != nil {
+			return nil, err
+		}
+		return &replayed, nil
+	}
+	if err != nil {
+		if errors.Is(err, db.ErrStatusConflict) {
+			return nil, apierror.Aborted(fmt.Sprintf("payment %s was updated concurrently, retry the request", req.TransactionId))
+		}
+		log.Printf("Error saving refund for payment %s: %v", req.TransactionId, err)
+		return nil, apierror.Database(err)
+	}
+
+	if target != from {
+		metrics.PaymentStatusChanges.WithLabelValues(string(target), payment.Amount.Currency()).Inc()
+		h.Watchers.Publish(watch.Event{
+			TransactionID: payment.TransactionID,
+			From:          from,
+			To:            target,
+			Reason:        req.Reason,
+			OccurredAt:    time.Now(),
+		})
+	}
+
+	return response, nil
+}
+
+// newChainRefundEvent builds the outbox message asking the blockchain service for a compensating transfer.
+// The service scales what the original transaction paid by the refund amount / the payment amount.
+func newChainRefundEvent(ctx context.Context, refund db.NewRefund, payment *db.Payment) (db.OutboxMessage, error) {
+	body, err := events.Marshal(events.TypeRefundRequested, payment.TransactionID, &eventspb.RefundRequested{
+		RefundId:      refund.RefundID,
+		TransactionId: payment.TransactionID,
+		ChainTxHash:   payment.ChainTxHash,
+		RefundAmount:  refund.Amount.String(),
+		PaymentAmount: payment.Amount.String(),
+		Currency:      payment.Amount.Currency(),
+	})
+	if err != nil {
+		return db.OutboxMessage{}, err
+	}
+
+	return db.OutboxMessage{
+		Queue:        chainRefundQueue,
+		ContentType:  events.ContentType,
+		Body:         body,
+		TraceContext: tracing.Inject(ctx), // The blockchain service continues this request's trace
+	}, nil
+}
+
+// ListenForChainRefundResults records the outcome of on-chain compensating transfers reported by the blockchain service
+// until ctx is canceled and the results already received are recorded
+func (h *PaymentHandler) ListenForChainRefundResults(ctx context.Context) {
+	err := h.Messages.Subscribe(ctx, chainRefundResultQueue, func(ctx context.Context, msg bus.Message) error {
+		return h.recordChainRefundResult(ctx, msg)
+	})
+	if err != nil {
+		log.Fatalf("Failed to start consuming refund results: %v", err)
+	}
+}
+
+// decodeChainRefundResult decodes a refund result, either in an event envelope or as the JSON the
+// blockchain service published before the envelope. It returns the ID of the event, or of the message
+// for a JSON result, empty if the publisher set none.
+func decodeChainRefundResult(msg bus.Message) (*eventspb.RefundResult, string, error) {
+	result := &eventspb.RefundResult{}
+	if events.IsEnvelope(msg) {
+		event, err := events.Unmarshal(msg, events.TypeRefundResult, result)
+		return result, event.ID, err
+	}
+
+	var legacy chainRefundResult
+	if err := json.Unmarshal(msg.Body, &legacy); err != nil {
+		return nil, "", err
+	}
+	return &eventspb.RefundResult{RefundId: legacy.RefundID, ChainTxHash: legacy.ChainTxHash, Error: legacy.Error}, msg.ID, nil
+}
+
+// recordChainRefundResult records the outcome of one compensating transfer, once: a result delivered
+// again is acknowledged without being recorded. A result that failed to be recorded is retried, or
+// dead-lettered if it cannot succeed.
+func (h *PaymentHandler) recordChainRefundResult(ctx context.Context, msg bus.Message) error {
+	result, messageID, err := decodeChainRefundResult(msg)
+	if err != nil {
+		log.Printf("Error unmarshalling refund result: %v", err)
+		return bus.Permanent(fmt.Errorf("malformed refund result: %v", err))
+	}
+
+	inbox := inboxMessage(chainRefundResultQueue, msg, messageID)
+	if processed, err := h.alreadyProcessed(ctx, inbox); err != nil || processed {
+		return err
+	}
+
+	refundStatus := db.RefundCompleted
+	if result.Error != "" {
+		refundStatus = db.RefundFailed
+	}
+
+	// A failed transfer also undoes the refund, so the sender can be refunded again
+	reversal, err := h.DB.CompleteChainRefund(ctx, db.ChainRefundOutcome{
+		RefundID:    result.RefundId,
+		Status:      refundStatus,
+		ChainTxHash: result.ChainTxHash,
+		Failure:     result.Error,
+		Actor:       "rabbitmq:" + chainRefundResultQueue,
+		Inbox:       inbox,
+	})
+	if errors.Is(err, db.ErrDuplicateMessage) {
+		skipDuplicate(inbox)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error recording refund result for refund %s: %v", result.RefundId, err)
+		return messageError(err)
+	}
+	log.Printf("Refund %s is %s (chain transaction %s)", result.RefundId, refundStatus, result.ChainTxHash)
+
+	if reversal != nil && reversal.From != reversal.To {
+		metrics.PaymentStatusChanges.WithLabelValues(string(reversal.To), reversal.Amount.Currency()).Inc()
+		h.Watchers.Publish(watch.Event{
+			TransactionID: reversal.TransactionID,
+			From:          reversal.From,
+			To:            reversal.To,
+			Reason:        fmt.Sprintf("refund %s failed: %s", result.RefundId, result.Error),
+			OccurredAt:    time.Now(),
+		})
+	}
+	return nil
+}
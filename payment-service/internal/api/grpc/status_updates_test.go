@@ -0,0 +1,169 @@
+package grpc_server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Go-payments/bus"
+	membus "github.com/Go-payments/bus/memory"
+	"github.com/Go-payments/internal/db/memory"
+	"github.com/Go-payments/internal/events"
+	"github.com/Go-payments/internal/events/eventspb"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/outbox"
+	"google.golang.org/protobuf/proto"
+)
+
+// eventually polls cond until it holds or a second has passed
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestOutboxRelaysPaymentEventsToPaymentUpdates(t *testing.T) {
+	store := memory.NewStore()
+	messages := membus.NewBus(3, time.Millisecond)
+	h := NewPaymentHandler(store, messages)
+	id := pay(t, h, "10.00")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relay := outbox.NewRelay(store, messages)
+	relay.Interval = 10 * time.Millisecond
+	go relay.Run(ctx)
+
+	// The event MakePayment wrote to the outbox arrives on payment_updates once
+	received := make(chan bus.Message, 10)
+	go messages.Subscribe(ctx, "payment_updates", func(ctx context.Context, msg bus.Message) error {
+		received <- msg
+		return nil
+	})
+	var msg bus.Message
+	select {
+	case msg = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("payment event was not relayed to payment_updates")
+	}
+
+	update := &eventspb.PaymentStatusUpdate{}
+	event, err := events.Unmarshal(msg, events.TypePaymentStatusUpdate, update)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if update.TransactionId != id || update.Status != string(lifecycle.Pending) || event.CorrelationID != id {
+		t.Errorf("relayed %+v correlated with %s, want PENDING for %s", update, event.CorrelationID, id)
+	}
+
+	// Applying it changes nothing, since the payment is already pending
+	if err := h.applyStatusUpdate(context.Background(), msg); err != nil {
+		t.Errorf("applyStatusUpdate: %v", err)
+	}
+
+	time.Sleep(5 * relay.Interval)
+	select {
+	case msg := <-received:
+		t.Errorf("outbox message relayed again: %q", msg.Body)
+	default:
+	}
+}
+
+func TestStatusUpdatesFromPaymentUpdates(t *testing.T) {
+	store := memory.NewStore()
+	messages := membus.NewBus(3, time.Millisecond)
+	h := NewPaymentHandler(store, messages)
+	id := pay(t, h, "10.00")
+
+	publish := func(transactionID string, status lifecycle.Status) {
+		t.Helper()
+		body, err := events.Marshal(events.TypePaymentStatusUpdate, transactionID, &eventspb.PaymentStatusUpdate{
+			TransactionId: transactionID,
+			Status:        string(status),
+		})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		err = messages.Publish(context.Background(), "payment_updates", bus.Message{ContentType: events.ContentType, Body: body})
+		if err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.ListenForPaymentStatusUpdates(ctx)
+
+	publish(id, lifecycle.Submitted)
+	eventually(t, "the payment is submitted", func() bool {
+		p, err := store.GetPayment(context.Background(), id)
+		return err == nil && p.Status == string(lifecycle.Submitted)
+	})
+
+	// Updates that can never apply are dead-lettered without being retried
+	publish("missing", lifecycle.Submitted)
+	publish(id, lifecycle.Pending)
+	messages.Publish(context.Background(), "payment_updates", bus.Message{ContentType: events.ContentType, Body: []byte("not an event")})
+	eventually(t, "the bad updates are dead-lettered", func() bool {
+		return len(messages.DeadLetters("payment_updates")) == 3
+	})
+	for _, dead := range messages.DeadLetters("payment_updates") {
+		if dead.Attempts != 1 {
+			t.Errorf("dead letter failing with %q took %d attempts, want 1", dead.LastError, dead.Attempts)
+		}
+	}
+
+	p, _ := store.GetPayment(context.Background(), id)
+	if p.Status != string(lifecycle.Submitted) {
+		t.Errorf("payment is %s, want %s", p.Status, lifecycle.Submitted)
+	}
+}
+
+func TestStatusUpdatesWithoutAnIDAreDeduplicatedByContent(t *testing.T) {
+	store := memory.NewStore()
+	h := NewPaymentHandler(store, membus.NewBus(3, time.Millisecond))
+	id := pay(t, h, "10.00")
+
+	// A bare update, as published before the envelope, by a publisher that set no message ID
+	body, err := proto.Marshal(&eventspb.PaymentStatusUpdate{TransactionId: id, Status: string(lifecycle.Submitted)})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	msg := bus.Message{Body: body}
+	if err := h.applyStatusUpdate(context.Background(), msg); err != nil {
+		t.Fatalf("applyStatusUpdate: %v", err)
+	}
+
+	processed, err := store.HasProcessedMessage(context.Background(), *inboxMessage("payment_updates", msg, ""))
+	if err != nil {
+		t.Fatalf("HasProcessedMessage: %v", err)
+	}
+	if !processed {
+		t.Error("update without an ID was applied without being recorded in the inbox")
+	}
+}
+
+func TestChainEventsForUnknownTransactionsAreRetriedWithinTheMatchWindow(t *testing.T) {
+	h := NewPaymentHandler(memory.NewStore(), membus.NewBus(3, time.Millisecond))
+	body, err := events.Marshal(events.TypeChainPaymentSent, "0xabc", &eventspb.ChainPaymentSent{TxHash: "0xabc"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// A recent event may be for a payment whose transaction hash is not recorded yet
+	recent := bus.Message{ID: "recent", ContentType: events.ContentType, Body: body, PublishedAt: time.Now()}
+	if err := h.applyChainPaymentEvent(context.Background(), recent); err == nil || bus.IsPermanent(err) {
+		t.Errorf("applyChainPaymentEvent of a recent event for an unknown transaction = %v, want a retryable error", err)
+	}
+
+	// Past the window it is another caller's, and acknowledged rather than dead-lettered
+	old := bus.Message{ID: "old", ContentType: events.ContentType, Body: body, PublishedAt: time.Now().Add(-h.ChainEventMatchWindow)}
+	if err := h.applyChainPaymentEvent(context.Background(), old); err != nil {
+		t.Errorf("applyChainPaymentEvent of an old event for an unknown transaction: %v", err)
+	}
+}
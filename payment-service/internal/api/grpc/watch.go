@@ -0,0 +1,235 @@
+package grpc_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Go-payments/bus"
+	apierror "github.com/Go-payments/internal/api/error"
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/events"
+	"github.com/Go-payments/internal/events/eventspb"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/metrics"
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// chainEventQueue carries the payment contract's events from the blockchain service
+const chainEventQueue = "payment_events"
+
+// chainPaymentEvent is a payment contract event as the blockchain service forwarded it before the event
+// envelope
+type chainPaymentEvent struct {
+	TransactionID string `json:"transaction_id"` // Hash of the on-chain transaction that emitted the event
+	Sender        string `json:"sender"`
+	Receiver      string `json:"receiver"`
+	Amount        string `json:"amount"` // In Wei
+}
+
+// WatchPayment streams the payment's current status, then every status change until the payment
+// reaches a terminal status or the client goes away. The changes are read from the payment's status
+// history, whenever this process changes the payment and every WatchPollInterval, so changes made by
+// other replicas of the service are streamed too.
+func (h *PaymentHandler) WatchPayment(req *pb.WatchPaymentRequest, stream pb.PaymentService_WatchPaymentServer) error {
+	log.Printf("Watching payment %s", req.TransactionId)
+	ctx := stream.Context()
+
+	// Only the parties may watch, so nothing of the payment is read for anyone else; the parties of a
+	// payment never change, so this read only serves the check
+	payment, err := h.getPayment(ctx, req.TransactionId)
+	if err != nil {
+		return err
+	}
+	if err := authorizeParty(ctx, payment); err != nil {
+		return err
+	}
+
+	// Subscribe before reading the current status so no change can slip in between
+	events, unsubscribe := h.Watchers.Subscribe(req.TransactionId)
+	defer unsubscribe()
+
+	// Mark where the history stands before the snapshot; a change made in between is listed again
+	// later, and skipped since the snapshot already shows it
+	changes, err := h.DB.ListStatusChanges(ctx, req.TransactionId, 0)
+	if err != nil {
+		log.Printf("Error listing status changes of payment %s: %v", req.TransactionId, err)
+		return apierror.Database(err)
+	}
+	var seen int64
+	if len(changes) > 0 {
+		seen = changes[len(changes)-1].ID
+	}
+
+	if payment, err = h.getPayment(ctx, req.TransactionId); err != nil {
+		return err
+	}
+
+	current := lifecycle.Status(payment.Status)
+	err = stream.Send(&pb.PaymentStatusEvent{
+		TransactionId: payment.TransactionID,
+		Status:        payment.Status,
+		ChainTxHash:   payment.ChainTxHash,
+		OccurredAt:    timestamppb.New(payment.UpdatedAt),
+	})
+	if err != nil {
+		return err
+	}
+
+	poll := time.NewTicker(h.WatchPollInterval)
+	defer poll.Stop()
+	for !current.IsTerminal() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-events:
+			if !ok {
+				if h.Watchers.Closed() {
+					return status.Error(codes.Unavailable, "server is shutting down, watch the payment again")
+				}
+				return status.Error(codes.ResourceExhausted, "watcher fell too far behind, watch the payment again")
+			}
+		case <-poll.C:
+		}
+
+		if seen, current, err = h.sendStatusChanges(stream, req.TransactionId, seen, current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPayment reads a payment for WatchPayment, turning failures into API errors
+func (h *PaymentHandler) getPayment(ctx context.Context, transactionID string) (*db.Payment, error) {
+	payment, err := h.DB.GetPayment(ctx, transactionID)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, apierror.NotFound("payment", transactionID)
+	}
+	if err != nil {
+		log.Printf("Error fetching payment %s: %v", transactionID, err)
+		return nil, apierror.Database(err)
+	}
+	return payment, nil
+}
+
+// sendStatusChanges streams the payment's status changes recorded after the change with ID seen,
+// skipping those to the status the client already has, and returns the last change and status sent
+func (h *PaymentHandler) sendStatusChanges(stream pb.PaymentService_WatchPaymentServer, transactionID string, seen int64, current lifecycle.Status) (int64, lifecycle.Status, error) {
+	changes, err := h.DB.ListStatusChanges(stream.Context(), transactionID, seen)
+	if err != nil {
+		log.Printf("Error listing status changes of payment %s: %v", transactionID, err)
+		return seen, current, apierror.Database(err)
+	}
+	if len(changes) == 0 {
+		return seen, current, nil
+	}
+
+	// The history does not record the settlement transaction, so it is read from the payment
+	payment, err := h.DB.GetPayment(stream.Context(), transactionID)
+	if err != nil {
+		log.Printf("Error fetching payment %s: %v", transactionID, err)
+		return seen, current, apierror.Database(err)
+	}
+
+	for _, change := range changes {
+		seen = change.ID
+		if change.To == current {
+			continue
+		}
+		current = change.To
+
+		err := stream.Send(&pb.PaymentStatusEvent{
+			TransactionId: change.TransactionID,
+			FromStatus:    string(change.From),
+			Status:        string(change.To),
+			Reason:        change.Reason,
+			ChainTxHash:   payment.ChainTxHash,
+			OccurredAt:    timestamppb.New(change.At),
+		})
+		if err != nil {
+			return seen, current, err
+		}
+	}
+	return seen, current, nil
+}
+
+// ListenForChainPaymentEvents moves submitted payments to CONFIRMING once the blockchain service
+// reports that their settlement transaction was included in a block, until ctx is canceled and the
+// events already received are applied
+func (h *PaymentHandler) ListenForChainPaymentEvents(ctx context.Context) {
+	err := h.Messages.Subscribe(ctx, chainEventQueue, func(ctx context.Context, msg bus.Message) error {
+		return h.applyChainPaymentEvent(ctx, msg)
+	})
+	if err != nil {
+		log.Fatalf("Failed to start consuming payment events: %v", err)
+	}
+}
+
+// decodeChainPaymentEvent decodes a payment contract event, either in an event envelope or as the JSON
+// the blockchain service published before the envelope. It returns the ID of the event, or of the
+// message for a JSON event, empty if the publisher set none.
+func decodeChainPaymentEvent(msg bus.Message) (*eventspb.ChainPaymentSent, string, error) {
+	event := &eventspb.ChainPaymentSent{}
+	if events.IsEnvelope(msg) {
+		envelope, err := events.Unmarshal(msg, events.TypeChainPaymentSent, event)
+		return event, envelope.ID, err
+	}
+
+	var legacy chainPaymentEvent
+	if err := json.Unmarshal(msg.Body, &legacy); err != nil {
+		return nil, "", err
+	}
+	return &eventspb.ChainPaymentSent{TxHash: legacy.TransactionID, Sender: legacy.Sender, Receiver: legacy.Receiver, Amount: legacy.Amount}, msg.ID, nil
+}
+
+// applyChainPaymentEvent moves the payment settled by a reported transaction to CONFIRMING, once: an
+// event delivered again is acknowledged without being applied. An event for a transaction no payment
+// was settled by is retried within ChainEventMatchWindow of being published, then acknowledged and
+// counted. Another failed event is retried, or dead-lettered if it cannot succeed.
+func (h *PaymentHandler) applyChainPaymentEvent(ctx context.Context, msg bus.Message) error {
+	event, messageID, err := decodeChainPaymentEvent(msg)
+	if err != nil {
+		log.Printf("Error unmarshalling payment event: %v", err)
+		return bus.Permanent(fmt.Errorf("malformed payment event: %v", err))
+	}
+
+	inbox := inboxMessage(chainEventQueue, msg, messageID)
+	if processed, err := h.alreadyProcessed(ctx, inbox); err != nil || processed {
+		return err
+	}
+
+	payment, err := h.DB.GetPaymentByChainTxHash(ctx, event.TxHash)
+	if errors.Is(err, db.ErrNotFound) && time.Since(msg.PublishedAt) >= h.ChainEventMatchWindow {
+		// The contract emits events for every caller, not only this service
+		log.Printf("Ignoring chain transaction %s: no payment was settled by it", event.TxHash)
+		metrics.ChainEventsUnmatched.Inc()
+		return nil
+	}
+	if err != nil {
+		// The event may arrive before the payment's transaction hash is recorded, so an unknown
+		// transaction is retried until the match window ends
+		log.Printf("Error finding the payment of chain transaction %s: %v", event.TxHash, err)
+		return err
+	}
+	if payment.Status != string(lifecycle.Submitted) {
+		return nil
+	}
+
+	err = h.transitionPayment(ctx, payment.TransactionID, lifecycle.Confirming, "rabbitmq:"+chainEventQueue,
+		"settlement transaction included in a block", event.TxHash, inbox)
+	if errors.Is(err, db.ErrDuplicateMessage) {
+		skipDuplicate(inbox)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error updating payment status for transaction %s: %v", payment.TransactionID, err)
+		return messageError(err)
+	}
+	return nil
+}
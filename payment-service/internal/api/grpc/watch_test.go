@@ -0,0 +1,66 @@
+package grpc_server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Go-payments/internal/db/memory"
+	"github.com/Go-payments/internal/lifecycle"
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"google.golang.org/grpc"
+)
+
+// watchStream collects the events WatchPayment sends
+type watchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *pb.PaymentStatusEvent
+}
+
+func (s *watchStream) Context() context.Context { return s.ctx }
+
+func (s *watchStream) Send(event *pb.PaymentStatusEvent) error {
+	s.events <- event
+	return nil
+}
+
+func TestWatchPaymentStreamsChangesMadeByAnotherReplica(t *testing.T) {
+	store := memory.NewStore()
+	watched, other := NewPaymentHandler(store, nil), NewPaymentHandler(store, nil)
+	watched.WatchPollInterval = 10 * time.Millisecond
+	id := pay(t, other, "10.00")
+
+	ctx, cancel := context.WithCancel(as("alice"))
+	defer cancel()
+	stream := &watchStream{ctx: ctx, events: make(chan *pb.PaymentStatusEvent, 10)}
+	done := make(chan error, 1)
+	go func() { done <- watched.WatchPayment(&pb.WatchPaymentRequest{TransactionId: id}, stream) }()
+
+	next := func() *pb.PaymentStatusEvent {
+		t.Helper()
+		select {
+		case event := <-stream.events:
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("no event streamed")
+			return nil
+		}
+	}
+	if event := next(); event.Status != string(lifecycle.Pending) {
+		t.Fatalf("first event is %s, want the current status %s", event.Status, lifecycle.Pending)
+	}
+
+	// The other replica's hub never reaches the watcher; the status history does
+	moveTo(t, other, id, lifecycle.Submitted, lifecycle.Confirming)
+	for _, want := range []lifecycle.Status{lifecycle.Submitted, lifecycle.Confirming} {
+		if event := next(); event.Status != string(want) {
+			t.Errorf("streamed %s, want %s", event.Status, want)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("WatchPayment: %v", err)
+	}
+}
@@ -2,83 +2,57 @@ package middlewares
 
 import (
 	"errors"
-	"fmt"
-	"strings"
+	"net/http"
 
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/Go-payments/internal/auth"
 	"github.com/labstack/echo/v4"
-	"net/http"
 )
 
 var (
 	// Error definitions
 	ErrUnauthorized = errors.New("unauthorized")
-
-	// Secret key (should be loaded from environment variable for production use)
-	jwtSecretKey = []byte("your-secret-key")
+	ErrForbidden    = errors.New("forbidden")
 )
 
-// AuthMiddleware is an Echo-compatible middleware that validates incoming requests for authentication.
-func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		// Extract the Authorization header
-		authHeader := c.Request().Header.Get("Authorization")
-		if authHeader == "" {
-			return echo.NewHTTPError(http.StatusUnauthorized, ErrUnauthorized.Error())
-		}
-
-		// Validate the token
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if !isValidToken(token) {
-			return echo.NewHTTPError(http.StatusUnauthorized, ErrUnauthorized.Error())
+// AuthMiddleware returns an Echo-compatible middleware that validates incoming requests for authentication.
+// The authenticated user's ID is stored in the context under "user_id", the full auth.Principal under "principal".
+func AuthMiddleware(verifier auth.Verifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// Extract the token from the Authorization header
+			token, err := auth.BearerToken(c.Request().Header.Get("Authorization"))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, ErrUnauthorized.Error())
+			}
+
+			// Validate the token and extract the user it was issued to
+			principal, err := verifier.Verify(token)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, ErrUnauthorized.Error())
+			}
+
+			// Set user information in the context
+			c.Set("user_id", principal.UserID)
+			c.Set("principal", principal)
+
+			// Call the next handler in the chain
+			return next(c)
 		}
-
-		// Extract user ID from the token
-		userID := extractUserID(token)
-		if userID == "" {
-			return echo.NewHTTPError(http.StatusUnauthorized, ErrUnauthorized.Error())
-		}
-
-		// Set user information in the context
-		c.Set("user_id", userID)
-
-		// Call the next handler in the chain
-		return next(c)
 	}
 }
 
-// isValidToken validates the provided JWT token.
-func isValidToken(tokenString string) bool {
-	// Parse the token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// RequirePermission returns a middleware rejecting callers without the permission. It must run after AuthMiddleware.
+func RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := c.Get("principal").(auth.Principal)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, ErrUnauthorized.Error())
+			}
+			if !principal.Can(permission) {
+				return echo.NewHTTPError(http.StatusForbidden, ErrForbidden.Error())
+			}
+			return next(c)
 		}
-		return jwtSecretKey, nil
-	})
-
-	// Return whether the token is valid
-	return err == nil && token.Valid
-}
-
-// extractUserID extracts the user ID from a valid JWT token.
-func extractUserID(tokenString string) string {
-	// Parse the token with claims
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecretKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		return ""
 	}
-
-	// Extract and return the user ID
-	if claims, ok := token.Claims.(*jwt.MapClaims); ok {
-		if userID, found := (*claims)["user_id"]; found {
-			return fmt.Sprintf("%v", userID)
-		}
-	}
-
-	return ""
 }
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	jwksMaxAge     = 5 * time.Minute  // How long fetched keys are trusted before refetching
+	jwksMinRefresh = 30 * time.Second // Unknown key IDs trigger a refetch at most this often
+)
+
+// JWKSVerifier verifies RS256 and EdDSA tokens against the JSON Web Key Set user-authentication
+// publishes. Keys are cached; a token signed with a key not in the cache (e.g., after a rotation)
+// triggers a refetch. If user-authentication is unreachable, the last fetched keys keep being used.
+// Key sets are fetched without holding the cache lock, and concurrent refetches share one request, so
+// a slow user-authentication only delays the requests that need the new keys.
+type JWKSVerifier struct {
+	URL      string // e.g., "http://localhost:8081/.well-known/jwks.json"
+	Issuer   string // Required "iss" claim
+	Audience string // Required "aud" claim
+	Client   *http.Client
+
+	fetches singleflight.Group // Collapses concurrent refetches into one
+
+	mu      sync.RWMutex // Guards keys and fetched
+	keys    map[string]publicKey
+	fetched time.Time
+}
+
+type publicKey struct {
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+// NewJWKSVerifier returns a verifier for tokens issued by issuer for audience
+func NewJWKSVerifier(url, issuer, audience string) *JWKSVerifier {
+	return &JWKSVerifier{
+		URL:      url,
+		Issuer:   issuer,
+		Audience: audience,
+		Client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// claims are the claims user-authentication puts in its tokens
+type claims struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	jwt.RegisteredClaims
+}
+
+// Verify checks the token's signature, expiry, issuer and audience and returns its subject.
+// Errors not wrapping ErrInvalidToken mean the keys could not be fetched.
+func (v *JWKSVerifier) Verify(token string) (Principal, error) {
+	var c claims
+	var fetchErr error
+	_, err := jwt.ParseWithClaims(token, &c, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no key ID")
+		}
+		key, err := v.key(kid)
+		if err != nil {
+			fetchErr = err
+			return nil, err
+		}
+		if key == nil {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return key.key, nil
+	})
+	if fetchErr != nil {
+		return Principal{}, fetchErr
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if !c.VerifyIssuer(v.Issuer, true) {
+		return Principal{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.Issuer)
+	}
+	if !c.VerifyAudience(v.Audience, true) {
+		return Principal{}, fmt.Errorf("%w: not issued for %q", ErrInvalidToken, v.Audience)
+	}
+	if c.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return Principal{UserID: c.Subject, TokenID: c.ID, Roles: c.Roles, Permissions: c.Permissions}, nil
+}
+
+// key returns the key with the given ID, refetching the key set when it is stale or lacks the key.
+// It returns nil without an error for key IDs user-authentication does not publish.
+func (v *JWKSVerifier) key(kid string) (*publicKey, error) {
+	v.mu.RLock()
+	key, known := v.keys[kid]
+	age := time.Since(v.fetched)
+	cached := v.keys != nil
+	v.mu.RUnlock()
+
+	if (known && age < jwksMaxAge) || (!known && cached && age < jwksMinRefresh) {
+		if !known {
+			return nil, nil
+		}
+		return &key, nil
+	}
+
+	keys, err := v.refresh()
+	if err != nil {
+		if known {
+			return &key, nil // Keep going on the cached key while user-authentication is down
+		}
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return &key, nil
+	}
+	return nil, nil
+}
+
+// refresh fetches the key set and swaps it into the cache. Callers arriving while a fetch is in
+// flight wait for it and share its result instead of fetching again.
+func (v *JWKSVerifier) refresh() (map[string]publicKey, error) {
+	keys, err, _ := v.fetches.Do(v.URL, func() (interface{}, error) {
+		keys, err := v.fetch()
+		if err != nil {
+			return nil, err
+		}
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		v.keys = keys
+		v.fetched = time.Now()
+		return keys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys.(map[string]publicKey), nil
+}
+
+// fetch downloads and parses the key set
+func (v *JWKSVerifier) fetch() (map[string]publicKey, error) {
+	resp, err := v.Client.Get(v.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue // Skip key types this verifier does not support rather than failing the whole set
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// jwk is a single JSON Web Key (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+func (k jwk) publicKey() (publicKey, error) {
+	switch {
+	case k.Kty == "RSA" && (k.Alg == "" || k.Alg == "RS256"):
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return publicKey{}, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return publicKey{}, errors.New("RSA exponent out of range")
+		}
+		return publicKey{
+			method: jwt.SigningMethodRS256,
+			key:    &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())},
+		}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519" && (k.Alg == "" || k.Alg == "EdDSA"):
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return publicKey{}, errors.New("invalid Ed25519 key length")
+		}
+		return publicKey{method: jwt.SigningMethodEdDSA, key: ed25519.PublicKey(x)}, nil
+	default:
+		return publicKey{}, fmt.Errorf("unsupported key type %s/%s", k.Kty, k.Alg)
+	}
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// signer issues tokens with an Ed25519 key and serves it as a key set, like user-authentication
+type signer struct {
+	kid  string
+	key  ed25519.PrivateKey
+	jwks []byte
+}
+
+func newSigner(t *testing.T, kid string) *signer {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []jwk{{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		Alg: "EdDSA",
+		Use: "sig",
+		Kid: kid,
+		X:   base64.RawURLEncoding.EncodeToString(public),
+	}}})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return &signer{kid: kid, key: private, jwks: jwks}
+}
+
+func (s *signer) token(t *testing.T, subject string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{
+		Subject:   subject,
+		Issuer:    "user-authentication",
+		Audience:  jwt.ClaimStrings{"payment-service"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestJWKSVerifierFetchesOnceForConcurrentRequests(t *testing.T) {
+	s := newSigner(t, "key-1")
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release // Hold every fetch until all requests are waiting for the keys
+		w.Write(s.jwks)
+	}))
+	defer server.Close()
+
+	v := NewJWKSVerifier(server.URL, "user-authentication", "payment-service")
+	token := s.token(t, "alice")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.Verify(token)
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want 1", n)
+	}
+}
+
+func TestJWKSVerifierServesCachedKeysDuringRefetch(t *testing.T) {
+	known := newSigner(t, "key-1")
+	var blocked atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blocked.Load() {
+			<-release
+		}
+		w.Write(known.jwks)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	v := NewJWKSVerifier(server.URL, "user-authentication", "payment-service")
+	if _, err := v.Verify(known.token(t, "alice")); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// A token signed with an unknown key starts a refetch that hangs...
+	blocked.Store(true)
+	unknown := newSigner(t, "key-2")
+	go v.Verify(unknown.token(t, "mallory"))
+	time.Sleep(50 * time.Millisecond)
+
+	// ...which must not hold up tokens signed with a cached key
+	token := known.token(t, "bob")
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(token)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Verify with a cached key waited for the refetch")
+	}
+}
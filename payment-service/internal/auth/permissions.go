@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Permissions granted through roles in user-authentication
+const (
+	PermissionCreatePayments      = "payments:create"        // Pay from one's own account
+	PermissionRefundPayments      = "payments:refund"        // Refund payments one received
+	PermissionReadPayments        = "payments:read"          // See payments one sent or received
+	PermissionReadAllPayments     = "payments:read:all"      // See anyone's payments (support staff)
+	PermissionUpdatePaymentStatus = "payments:status:update" // Move payments through their lifecycle (settlement)
+	PermissionReadLedger          = "ledger:read"            // See ledger balances
+)
+
+// Public is the policy entry of methods anyone may call without a token, such as health checks
+const Public = "public"
+
+// Policy maps full gRPC method names (e.g., "/payment.PaymentService/MakePayment") to the permission
+// needed to call them. Methods missing from the policy are denied, so every new RPC has to be classified.
+type Policy map[string]string
+
+// authorize checks the caller authenticated by the auth interceptors against the policy
+func (p Policy) authorize(ctx context.Context, method string) error {
+	permission, ok := p[method]
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "%s is not allowed", method)
+	}
+	if permission == Public {
+		return nil
+	}
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "request is not authenticated")
+	}
+	if !principal.Can(permission) {
+		return status.Errorf(codes.PermissionDenied, "%s requires the %q permission", method, permission)
+	}
+	return nil
+}
+
+// UnaryPolicyInterceptor rejects unary calls the caller lacks the permission for.
+// It must run after UnaryServerInterceptor.
+func UnaryPolicyInterceptor(p Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := p.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamPolicyInterceptor rejects streaming calls the caller lacks the permission for.
+// It must run after StreamServerInterceptor.
+func StreamPolicyInterceptor(p Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := p.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,117 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	grpc_server "github.com/Go-payments/internal/api/grpc"
+	"github.com/Go-payments/internal/auth"
+	pb "github.com/Go-payments/internal/proto/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rolePermissions are the permissions user-authentication's roles grant (user-authentication/db/roles.go)
+var rolePermissions = map[string][]string{
+	"user":    {auth.PermissionCreatePayments, auth.PermissionRefundPayments, auth.PermissionReadPayments},
+	"support": {auth.PermissionReadPayments, auth.PermissionReadAllPayments},
+	"service": {auth.PermissionReadPayments, auth.PermissionReadAllPayments, auth.PermissionUpdatePaymentStatus},
+	"admin": {auth.PermissionCreatePayments, auth.PermissionRefundPayments, auth.PermissionReadPayments,
+		auth.PermissionReadAllPayments, auth.PermissionUpdatePaymentStatus, auth.PermissionReadLedger},
+}
+
+// serverStream is a grpc.ServerStream carrying only a context, all the policy looks at
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context { return s.ctx }
+
+// authorize runs a call to method through the policy interceptors, as the server does
+func authorize(ctx context.Context, method string, stream bool) error {
+	if stream {
+		return auth.StreamPolicyInterceptor(grpc_server.MethodPermissions)(nil, serverStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: method},
+			func(interface{}, grpc.ServerStream) error { return nil })
+	}
+	_, err := auth.UnaryPolicyInterceptor(grpc_server.MethodPermissions)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+	return err
+}
+
+func TestMethodPermissionsAuthorizeRoles(t *testing.T) {
+	// The roles allowed to call each RPC; every RPC of the service must be listed
+	allowed := map[string][]string{
+		"MakePayment":         {"user", "admin"},
+		"GetPaymentStatus":    {"user", "support", "service", "admin"},
+		"UpdatePaymentStatus": {"service", "admin"},
+		"RefundPayment":       {"user", "admin"},
+		"ListPayments":        {"user", "support", "service", "admin"},
+		"WatchPayment":        {"user", "support", "service", "admin"},
+	}
+
+	type rpc struct {
+		name   string
+		stream bool
+	}
+	var rpcs []rpc
+	for _, m := range pb.PaymentService_ServiceDesc.Methods {
+		rpcs = append(rpcs, rpc{name: m.MethodName})
+	}
+	for _, s := range pb.PaymentService_ServiceDesc.Streams {
+		rpcs = append(rpcs, rpc{name: s.StreamName, stream: true})
+	}
+
+	for _, r := range rpcs {
+		method := "/" + pb.PaymentService_ServiceDesc.ServiceName + "/" + r.name
+		t.Run(r.name, func(t *testing.T) {
+			if _, ok := grpc_server.MethodPermissions[method]; !ok {
+				t.Fatalf("%s has no entry in MethodPermissions", method)
+			}
+			roles, ok := allowed[r.name]
+			if !ok {
+				t.Fatalf("%s is missing from this test; list the roles allowed to call it", r.name)
+			}
+
+			for role, permissions := range rolePermissions {
+				ctx := auth.NewContext(context.Background(), auth.Principal{UserID: "alice", Roles: []string{role}, Permissions: permissions})
+				want := codes.PermissionDenied
+				for _, allowedRole := range roles {
+					if role == allowedRole {
+						want = codes.OK
+					}
+				}
+				if err := authorize(ctx, method, r.stream); status.Code(err) != want {
+					t.Errorf("%s as %s = %v, want %s", r.name, role, err, want)
+				}
+			}
+
+			if err := authorize(context.Background(), method, r.stream); status.Code(err) != codes.Unauthenticated {
+				t.Errorf("%s without a token = %v, want Unauthenticated", r.name, err)
+			}
+		})
+	}
+}
+
+func TestMethodPermissionsDenyUnknownMethods(t *testing.T) {
+	// Not even an admin may call a method the policy does not know
+	ctx := auth.NewContext(context.Background(), auth.Principal{UserID: "alice", Roles: []string{"admin"}, Permissions: rolePermissions["admin"]})
+	for _, stream := range []bool{false, true} {
+		if err := authorize(ctx, "/payment.PaymentService/DeletePayment", stream); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("unknown method (stream %t) = %v, want PermissionDenied", stream, err)
+		}
+	}
+}
+
+func TestUserRoleCannotReadLedgerOrUpdateStatuses(t *testing.T) {
+	user := auth.Principal{UserID: "alice", Roles: []string{"user"}, Permissions: rolePermissions["user"]}
+	if user.Can(auth.PermissionReadLedger) {
+		t.Errorf("a user holds %q", auth.PermissionReadLedger)
+	}
+
+	ctx := auth.NewContext(context.Background(), user)
+	if err := authorize(ctx, pb.PaymentService_UpdatePaymentStatus_FullMethodName, false); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("UpdatePaymentStatus as a user = %v, want PermissionDenied", err)
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RevocationList mirrors the IDs ("jti") of access tokens user-authentication revoked before they
+// expired, e.g. on logout or refresh token reuse. It is refreshed by polling, so a revocation takes
+// effect within one poll interval; if polling fails, the last fetched list stays in force.
+type RevocationList struct {
+	URL      string        // e.g., "http://localhost:8081/revoked"
+	Interval time.Duration // How often the list is fetched
+	Client   *http.Client
+
+	mu      sync.RWMutex
+	revoked map[string]struct{}
+}
+
+// NewRevocationList creates a list polling url every interval
+func NewRevocationList(url string, interval time.Duration) *RevocationList {
+	return &RevocationList{
+		URL:      url,
+		Interval: interval,
+		Client:   &http.Client{Timeout: 5 * time.Second},
+		revoked:  make(map[string]struct{}),
+	}
+}
+
+// Run polls the revocation list until the context is canceled
+func (l *RevocationList) Run(ctx context.Context) {
+	log.Println("Token revocation poller started")
+
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.Refresh(ctx); err != nil {
+			log.Printf("Error fetching revoked tokens: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Token revocation poller stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh replaces the list with the one user-authentication currently serves
+func (l *RevocationList) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		Revoked []struct {
+			ID string `json:"jti"`
+		} `json:"revoked"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("invalid revocation list: %v", err)
+	}
+
+	revoked := make(map[string]struct{}, len(body.Revoked))
+	for _, r := range body.Revoked {
+		revoked[r.ID] = struct{}{}
+	}
+	l.mu.Lock()
+	l.revoked = revoked
+	l.mu.Unlock()
+	return nil
+}
+
+// Revoked reports whether the token with the given ID was revoked
+func (l *RevocationList) Revoked(tokenID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.revoked[tokenID]
+	return ok
+}
+
+// revocationCheckingVerifier rejects tokens on the revocation list after verifying them
+type revocationCheckingVerifier struct {
+	Verifier
+	list *RevocationList
+}
+
+// WithRevocations wraps v so tokens revoked by user-authentication are rejected
+func WithRevocations(v Verifier, list *RevocationList) Verifier {
+	return revocationCheckingVerifier{Verifier: v, list: list}
+}
+
+// Verify verifies the token with the wrapped verifier, then checks it was not revoked
+func (v revocationCheckingVerifier) Verify(token string) (Principal, error) {
+	p, err := v.Verifier.Verify(token)
+	if err != nil {
+		return Principal{}, err
+	}
+	if p.TokenID != "" && v.list.Revoked(p.TokenID) {
+		return Principal{}, fmt.Errorf("%w: token was revoked", ErrInvalidToken)
+	}
+	return p, nil
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes data to a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+// clearEnv blanks every PAYMENTS_* variable for the test, which Load treats as unset, so the environment
+// running the tests cannot leak in
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "PAYMENTS_") {
+			t.Setenv(name, "")
+		}
+	}
+	t.Setenv("PAYMENTS_AUTH_JWKS_URL", "http://localhost:8081/.well-known/jwks.json") // Has no default
+}
+
+func TestLoadLayersSources(t *testing.T) {
+	file := writeFile(t, "payments.yaml", `
+grpc_addr: ":1001"
+shutdown_timeout: 10s
+rabbitmq:
+  prefetch: 20
+`)
+
+	tests := []struct {
+		name         string
+		yaml         bool
+		env          bool
+		flags        bool
+		wantGRPCAddr string
+		wantPrefetch int
+		wantShutdown time.Duration
+	}{
+		{name: "defaults", wantGRPCAddr: ":50051", wantPrefetch: 10, wantShutdown: 30 * time.Second},
+		{name: "YAML over defaults", yaml: true, wantGRPCAddr: ":1001", wantPrefetch: 20, wantShutdown: 10 * time.Second},
+		{name: "environment over YAML", yaml: true, env: true, wantGRPCAddr: ":1002", wantPrefetch: 30, wantShutdown: 10 * time.Second},
+		{name: "flags over environment", yaml: true, env: true, flags: true, wantGRPCAddr: ":1003", wantPrefetch: 40, wantShutdown: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.yaml {
+				t.Setenv("PAYMENTS_CONFIG", file)
+			}
+			if tt.env {
+				t.Setenv("PAYMENTS_GRPC_ADDR", ":1002")
+				t.Setenv("PAYMENTS_RABBITMQ_PREFETCH", "30")
+			}
+			var args []string
+			if tt.flags {
+				args = []string{"-grpc-addr", ":1003", "-rabbitmq-prefetch", "40"}
+			}
+
+			cfg, rest, err := Load(append(args, "serve"))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.GRPCAddr != tt.wantGRPCAddr {
+				t.Errorf("grpc_addr = %q, want %q", cfg.GRPCAddr, tt.wantGRPCAddr)
+			}
+			if cfg.RabbitMQ.Prefetch != tt.wantPrefetch {
+				t.Errorf("rabbitmq.prefetch = %d, want %d", cfg.RabbitMQ.Prefetch, tt.wantPrefetch)
+			}
+			// Set only by the YAML file, so it survives the layers above it
+			if cfg.ShutdownTimeout != tt.wantShutdown {
+				t.Errorf("shutdown_timeout = %s, want %s", cfg.ShutdownTimeout, tt.wantShutdown)
+			}
+			if len(rest) != 1 || rest[0] != "serve" {
+				t.Errorf("arguments after the flags = %q, want [serve]", rest)
+			}
+		})
+	}
+}
+
+func TestLoadReadsSecretFilesOverInlineURLs(t *testing.T) {
+	databaseURL := writeFile(t, "database_url", "postgres://from-file/payments\n")
+	rabbitmqURL := writeFile(t, "rabbitmq_url", "amqp://from-file/\n")
+
+	t.Run("YAML", func(t *testing.T) {
+		clearEnv(t)
+		t.Setenv("PAYMENTS_CONFIG", writeFile(t, "payments.yaml", `
+database:
+  url: postgres://inline/payments
+  url_file: `+databaseURL+`
+rabbitmq:
+  url: amqp://inline/
+  url_file: `+rabbitmqURL+`
+`))
+
+		cfg, _, err := Load(nil)
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if cfg.Database.URL != "postgres://from-file/payments" || cfg.RabbitMQ.URL != "amqp://from-file/" {
+			t.Errorf("URLs = %q and %q, want the contents of their files", cfg.Database.URL, cfg.RabbitMQ.URL)
+		}
+	})
+
+	// The file wins even over a URL given on a higher layer
+	t.Run("environment and flags", func(t *testing.T) {
+		clearEnv(t)
+		t.Setenv("PAYMENTS_DATABASE_URL", "postgres://inline/payments")
+		t.Setenv("PAYMENTS_DATABASE_URL_FILE", databaseURL)
+		t.Setenv("PAYMENTS_RABBITMQ_URL_FILE", rabbitmqURL)
+
+		cfg, _, err := Load([]string{"-rabbitmq-url", "amqp://inline/"})
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if cfg.Database.URL != "postgres://from-file/payments" || cfg.RabbitMQ.URL != "amqp://from-file/" {
+			t.Errorf("URLs = %q and %q, want the contents of their files", cfg.Database.URL, cfg.RabbitMQ.URL)
+		}
+	})
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown YAML key", yaml: "grpc_adr: \":1001\"\n", want: "grpc_adr"},
+		{name: "malformed environment variable", env: map[string]string{"PAYMENTS_RABBITMQ_PREFETCH": "many"}, want: "PAYMENTS_RABBITMQ_PREFETCH"},
+		{name: "malformed flag", args: []string{"-shutdown-timeout", "soon"}, want: "-shutdown-timeout"},
+		{name: "out of range", args: []string{"-rabbitmq-max-attempts", "0"}, want: "rabbitmq.max_attempts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.yaml != "" {
+				t.Setenv("PAYMENTS_CONFIG", writeFile(t, "payments.yaml", tt.yaml))
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, _, err := Load(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want an error naming %s", err, tt.want)
+			}
+		})
+	}
+}
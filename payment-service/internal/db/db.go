@@ -1,10 +1,15 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"time"
 
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/money"
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
@@ -28,47 +33,140 @@ func Connect(dbURL string) (*sql.DB, error) {
 	return db, nil
 }
 
-func (d *DB) SavePayment(senderId, receiverId string, amount float64, transactionID string) error {
+// NewPayment is everything written when a payment is accepted
+type NewPayment struct {
+	TransactionID string
+	SenderID      string
+	ReceiverID    string
+	Amount        money.Amount       // Written as an exact decimal into a NUMERIC column
+	Idempotency   *IdempotencyRecord // Optional; claimed in the same transaction as the payment
+	Events        []OutboxMessage    // Events to publish once the payment is committed
+	Entries       []ledger.Entry     // Ledger entries posted for the new payment
+}
+
+// Payment is a stored payment
+type Payment struct {
+	TransactionID string
+	SenderID      string
+	ReceiverID    string
+	Amount        money.Amount
+	Refunded      money.Amount // Total refunded so far
+	Status        string
+	ChainTxHash   string // On-chain settlement transaction, empty for off-chain payments
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// CreatePayment stores a new payment, its idempotency key, ledger entries and outbox events in one
+// transaction, so a payment is never visible without the events announcing it (and vice versa)
+func (d *DB) CreatePayment(ctx context.Context, p NewPayment) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	// Claim the idempotency key first; a concurrent request with the same key loses here
+	if p.Idempotency != nil {
+		if err := insertIdempotencyRecord(ctx, tx, *p.Idempotency); err != nil {
+			return err
+		}
+	}
+
 	// Prepare SQL statement to save payment
 	query := `
-		INSERT INTO payments (transaction_id, sender_id, receiver_id, amount, status)
-		VALUES ($1, $2, $3, $4, $5)`
+		INSERT INTO payments (transaction_id, sender_id, receiver_id, amount, currency, status)
+		VALUES ($1, $2, $3, $4, $5, $6)`
 
 	// Execute the insert query with values
-	_, err := d.Exec(query, transactionID, senderId, receiverId, amount, "PENDING")
+	_, err = tx.ExecContext(ctx, query, p.TransactionID, p.SenderID, p.ReceiverID, p.Amount.String(), p.Amount.Currency(), lifecycle.Pending)
 	if err != nil {
 		return fmt.Errorf("failed to save payment: %v", err)
 	}
+
+	if err := postEntries(ctx, tx, p.Entries); err != nil {
+		return err
+	}
+
+	for _, event := range p.Events {
+		if err := insertOutboxMessage(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit payment: %v", err)
+	}
 	return nil
 }
 
-
 // GetPaymentStatus retrieves the payment status for a given payment ID
-func (db *DB) GetPaymentStatus(paymentID string) (string, error) {
+func (db *DB) GetPaymentStatus(ctx context.Context, paymentID string) (string, error) {
 	// Query to get the payment status
 	var status string
-	err := db.QueryRow("SELECT status FROM payments WHERE transaction_id = $1", paymentID).Scan(&status)
+	err := db.QueryRowContext(ctx, "SELECT status FROM payments WHERE transaction_id = $1", paymentID).Scan(&status)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
 		return "", fmt.Errorf("failed to fetch payment status: %v", err)
 	}
 
 	return status, nil
 }
-// UpdatePaymentStatus updates the status of a payment in the database
-func (db *DB) UpdatePaymentStatus(transactionID string, status string) error {
-	// Update the payment status based on the provided transaction ID
-	query := `UPDATE payments SET status = $1 WHERE transaction_id = $2`
 
-	// Execute the update query
-	_, err := db.Exec(query, status, transactionID)
+// paymentColumns are the columns read by scanPayment, in order
+const paymentColumns = `transaction_id, sender_id, receiver_id, amount, refunded_amount, currency, status,
+	COALESCE(chain_tx_hash, ''), created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPayment reads a payment selected with paymentColumns
+func scanPayment(row rowScanner) (*Payment, error) {
+	var p Payment
+	var amount, refunded, currency string
+	err := row.Scan(&p.TransactionID, &p.SenderID, &p.ReceiverID, &amount, &refunded, &currency, &p.Status,
+		&p.ChainTxHash, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
-		log.Printf("Error updating payment status for transaction %s: %v", transactionID, err)
-		return fmt.Errorf("failed to update payment status")
+		return nil, err
 	}
 
-	// If successful, return nil (no error)
-	log.Printf("Payment status updated to %s for transaction %s", status, transactionID)
-	return nil
+	if p.Amount, err = money.Parse(amount, currency); err != nil {
+		return nil, fmt.Errorf("invalid amount stored for payment %s: %v", p.TransactionID, err)
+	}
+	if p.Refunded, err = money.Parse(refunded, currency); err != nil {
+		return nil, fmt.Errorf("invalid refunded amount stored for payment %s: %v", p.TransactionID, err)
+	}
+	return &p, nil
 }
 
+// GetPayment retrieves a payment by its transaction ID
+func (d *DB) GetPayment(ctx context.Context, transactionID string) (*Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE transaction_id = $1`
 
+	p, err := scanPayment(d.QueryRowContext(ctx, query, transactionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch payment: %v", err)
+	}
+	return p, nil
+}
+
+// GetPaymentByChainTxHash retrieves the payment settled by an on-chain transaction
+func (d *DB) GetPaymentByChainTxHash(ctx context.Context, chainTxHash string) (*Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE LOWER(chain_tx_hash) = LOWER($1)`
+
+	p, err := scanPayment(d.QueryRowContext(ctx, query, chainTxHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch payment: %v", err)
+	}
+	return p, nil
+}
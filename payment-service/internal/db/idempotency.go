@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrIdempotencyKeyExists is returned when another request already claimed the idempotency key
+	ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an idempotency key
+type IdempotencyRecord struct {
+	SenderID      string // Keys are scoped per sender so clients cannot collide with each other
+	Key           string // The client-supplied idempotency key
+	Fingerprint   string // Hash of the original request body, used to detect conflicting replays
+	TransactionID string // Payment created, or refunded, by the original request
+	Response      []byte // Marshaled response returned to the original request
+}
+
+// GetIdempotencyRecord fetches the record stored for a sender's idempotency key
+func (d *DB) GetIdempotencyRecord(ctx context.Context, senderID, key string) (*IdempotencyRecord, error) {
+	query := `
+		SELECT sender_id, idempotency_key, request_fingerprint, transaction_id, response
+		FROM idempotency_keys
+		WHERE sender_id = $1 AND idempotency_key = $2`
+
+	var rec IdempotencyRecord
+	err := d.QueryRowContext(ctx, query, senderID, key).Scan(&rec.SenderID, &rec.Key, &rec.Fingerprint, &rec.TransactionID, &rec.Response)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch idempotency key: %v", err)
+	}
+
+	return &rec, nil
+}
+
+// insertIdempotencyRecord claims an idempotency key inside a transaction,
+// returning ErrIdempotencyKeyExists if another request already holds it
+func insertIdempotencyRecord(ctx context.Context, tx *sql.Tx, rec IdempotencyRecord) error {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (sender_id, idempotency_key, request_fingerprint, transaction_id, response)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (sender_id, idempotency_key) DO NOTHING`,
+		rec.SenderID, rec.Key, rec.Fingerprint, rec.TransactionID, rec.Response)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to save idempotency key: %v", err)
+	} else if n == 0 {
+		return ErrIdempotencyKeyExists
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDuplicateMessage is returned when the consumer already processed the message whose changes are
+// being written; nothing is written
+var ErrDuplicateMessage = errors.New("message already processed")
+
+// InboxMessage identifies a message received by a consumer. It is recorded in the same transaction as
+// the changes the message causes, so a message delivered again is never applied twice.
+type InboxMessage struct {
+	Consumer  string // Queue the message was received from (e.g., "payment_updates")
+	MessageID string // Event ID, kept by every delivery of the message
+}
+
+// HasProcessedMessage reports whether the consumer already processed the message
+func (d *DB) HasProcessedMessage(ctx context.Context, msg InboxMessage) (bool, error) {
+	var exists bool
+	err := d.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM inbox WHERE consumer = $1 AND message_id = $2)`,
+		msg.Consumer, msg.MessageID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up inbox message: %v", err)
+	}
+	return exists, nil
+}
+
+// insertInboxMessage records a message as processed inside the caller's transaction, returning
+// ErrDuplicateMessage if it already was. A concurrent transaction recording the same message blocks the
+// insert until it ends, so only one of them can commit. A nil message is not recorded.
+func insertInboxMessage(ctx context.Context, tx *sql.Tx, msg *InboxMessage) error {
+	if msg == nil {
+		return nil
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO inbox (consumer, message_id)
+		VALUES ($1, $2)
+		ON CONFLICT (consumer, message_id) DO NOTHING`,
+		msg.Consumer, msg.MessageID)
+	if err != nil {
+		return fmt.Errorf("failed to record inbox message: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to record inbox message: %v", err)
+	} else if n == 0 {
+		return ErrDuplicateMessage
+	}
+	return nil
+}
+
+// PruneInbox deletes the messages processed before the cutoff and returns how many there were. A message
+// delivered again after its entry is pruned would be applied again, so the cutoff must lie well beyond
+// the time a broker may take to redeliver a message.
+func (d *DB) PruneInbox(ctx context.Context, before time.Time) (int, error) {
+	res, err := d.ExecContext(ctx, `DELETE FROM inbox WHERE processed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune inbox: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune inbox: %v", err)
+	}
+	return int(n), nil
+}
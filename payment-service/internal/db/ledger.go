@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/money"
+)
+
+// postEntries validates and writes journal entries inside the caller's transaction,
+// creating ledger accounts on first use
+func postEntries(ctx context.Context, tx *sql.Tx, entries []ledger.Entry) error {
+	for _, entry := range entries {
+		if err := entry.Validate(); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO journal_entries (entry_id, transaction_id, kind, description)
+			VALUES ($1, $2, $3, $4)`,
+			entry.ID, entry.TransactionID, entry.Kind, entry.Description)
+		if err != nil {
+			return fmt.Errorf("failed to save journal entry: %v", err)
+		}
+
+		for _, posting := range entry.Postings {
+			accountID, err := ensureAccount(ctx, tx, posting.Account)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO postings (entry_id, account_id, amount, currency)
+				VALUES ($1, $2, $3, $4)`,
+				entry.ID, accountID, posting.Amount.String(), posting.Amount.Currency())
+			if err != nil {
+				return fmt.Errorf("failed to save posting: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ensureAccount returns the ID of a ledger account, creating it if it does not exist yet
+func ensureAccount(ctx context.Context, tx *sql.Tx, account ledger.Account) (int64, error) {
+	// The no-op update makes RETURNING yield the ID for existing accounts too
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO ledger_accounts (code, kind, owner_id, currency)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (code) DO UPDATE SET code = EXCLUDED.code
+		RETURNING id`,
+		account.Code, account.Kind, account.OwnerID, account.Currency).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch ledger account %s: %v", account.Code, err)
+	}
+	return id, nil
+}
+
+// TrialBalance sums the debits and credits of every ledger account
+func (d *DB) TrialBalance(ctx context.Context) (*ledger.TrialBalance, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT a.code, a.kind, a.owner_id, a.currency,
+			COALESCE(SUM(p.amount) FILTER (WHERE p.amount > 0), 0),
+			COALESCE(-SUM(p.amount) FILTER (WHERE p.amount < 0), 0)
+		FROM ledger_accounts a
+		LEFT JOIN postings p ON p.account_id = a.id
+		GROUP BY a.id
+		ORDER BY a.currency, a.code`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trial balance: %v", err)
+	}
+	defer rows.Close()
+
+	var balances []ledger.AccountBalance
+	for rows.Next() {
+		var account ledger.Account
+		var debits, credits string
+		if err := rows.Scan(&account.Code, &account.Kind, &account.OwnerID, &account.Currency, &debits, &credits); err != nil {
+			return nil, fmt.Errorf("failed to read trial balance: %v", err)
+		}
+
+		balance := ledger.AccountBalance{Account: account}
+		if balance.Debits, err = money.Parse(debits, account.Currency); err != nil {
+			return nil, fmt.Errorf("invalid debits for account %s: %v", account.Code, err)
+		}
+		if balance.Credits, err = money.Parse(credits, account.Currency); err != nil {
+			return nil, fmt.Errorf("invalid credits for account %s: %v", account.Code, err)
+		}
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trial balance: %v", err)
+	}
+
+	return ledger.NewTrialBalance(balances)
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PaymentCursor is the position of the last payment on a page; the next page starts right after it
+type PaymentCursor struct {
+	CreatedAt     time.Time
+	TransactionID string // Breaks ties between payments created at the same instant
+}
+
+// PaymentFilter selects the payments returned by ListPayments. Empty fields do not filter.
+type PaymentFilter struct {
+	PartyID       string // Required; only payments the party sent or received are listed
+	SenderID      string
+	ReceiverID    string
+	Status        string
+	Currency      string
+	CreatedAfter  time.Time // Inclusive
+	CreatedBefore time.Time // Exclusive
+	OldestFirst   bool      // Payments are listed newest first unless set
+	After         *PaymentCursor
+	Limit         int
+}
+
+// ListPayments returns the payments matching the filter, ordered by creation time. Pages are keyset
+// paginated on (created_at, transaction_id), which the payments_sender_created_idx and
+// payments_receiver_created_idx indexes (migration 0005) serve for the two sides of the party filter.
+func (d *DB) ListPayments(ctx context.Context, f PaymentFilter) ([]*Payment, error) {
+	if f.PartyID == "" {
+		return nil, fmt.Errorf("party ID is required to list payments")
+	}
+
+	conditions := []string{"(sender_id = $1 OR receiver_id = $1)"}
+	args := []interface{}{f.PartyID}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.SenderID != "" {
+		where("sender_id = $%d", f.SenderID)
+	}
+	if f.ReceiverID != "" {
+		where("receiver_id = $%d", f.ReceiverID)
+	}
+	if f.Status != "" {
+		where("status = $%d", f.Status)
+	}
+	if f.Currency != "" {
+		where("currency = $%d", f.Currency)
+	}
+	if !f.CreatedAfter.IsZero() {
+		where("created_at >= $%d", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		where("created_at < $%d", f.CreatedBefore)
+	}
+
+	order, seek := "DESC", "<"
+	if f.OldestFirst {
+		order, seek = "ASC", ">"
+	}
+	if f.After != nil {
+		args = append(args, f.After.CreatedAt, f.After.TransactionID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, transaction_id) %s ($%d, $%d)", seek, len(args)-1, len(args)))
+	}
+
+	args = append(args, f.Limit)
+	query := fmt.Sprintf(`SELECT %s FROM payments WHERE %s ORDER BY created_at %s, transaction_id %s LIMIT $%d`,
+		paymentColumns, strings.Join(conditions, " AND "), order, order, len(args))
+
+	rows, err := d.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payments: %v", err)
+	}
+	defer rows.Close()
+
+	var payments []*Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payment: %v", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list payments: %v", err)
+	}
+	return payments, nil
+}
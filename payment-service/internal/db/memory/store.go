@@ -0,0 +1,568 @@
+// Package memory implements db.PaymentStore in process memory, for tests and for running the
+// payment service without Postgres. Nothing survives a restart.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/money"
+)
+
+// StatusChange is an entry of a payment's status history
+type StatusChange struct {
+	TransactionID string
+	From          lifecycle.Status
+	To            lifecycle.Status
+	Actor         string
+	Reason        string
+	At            time.Time
+}
+
+// Refund is a stored refund
+type Refund struct {
+	RefundID      string
+	TransactionID string
+	Amount        money.Amount
+	Status        string
+	Actor         string
+	Reason        string
+	ChainTxHash   string
+	FailureReason string
+}
+
+// outboxEntry is an outbox message with its delivery state
+type outboxEntry struct {
+	msg           db.OutboxMessage
+	nextAttemptAt time.Time
+	lastError     string
+	sent          bool
+}
+
+// Store keeps payments, idempotency keys, refunds, ledger entries, outbox messages and the inbox in memory.
+// Every method runs under a single lock, so each call is atomic like a database transaction.
+type Store struct {
+	mu          sync.Mutex
+	payments    map[string]*db.Payment
+	idempotency map[[2]string]db.IdempotencyRecord
+	history     []StatusChange
+	refunds     map[string]*Refund
+	entries     []ledger.Entry
+	outbox      []*outboxEntry
+	inbox       map[db.InboxMessage]time.Time // When each message was processed
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{
+		payments:    make(map[string]*db.Payment),
+		idempotency: make(map[[2]string]db.IdempotencyRecord),
+		refunds:     make(map[string]*Refund),
+		inbox:       make(map[db.InboxMessage]time.Time),
+	}
+}
+
+var _ db.PaymentStore = (*Store)(nil)
+
+// CreatePayment stores a new payment, its idempotency key, ledger entries and outbox events
+func (s *Store) CreatePayment(ctx context.Context, p db.NewPayment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.Idempotency != nil {
+		if _, ok := s.idempotency[[2]string{p.Idempotency.SenderID, p.Idempotency.Key}]; ok {
+			return db.ErrIdempotencyKeyExists
+		}
+	}
+	if _, ok := s.payments[p.TransactionID]; ok {
+		return fmt.Errorf("failed to save payment: transaction %s already exists", p.TransactionID)
+	}
+	if err := validateEntries(p.Entries); err != nil {
+		return err
+	}
+	refunded, err := money.Zero(p.Amount.Currency())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.payments[p.TransactionID] = &db.Payment{
+		TransactionID: p.TransactionID,
+		SenderID:      p.SenderID,
+		ReceiverID:    p.ReceiverID,
+		Amount:        p.Amount,
+		Refunded:      refunded,
+		Status:        string(lifecycle.Pending),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if p.Idempotency != nil {
+		s.idempotency[[2]string{p.Idempotency.SenderID, p.Idempotency.Key}] = *p.Idempotency
+	}
+	s.entries = append(s.entries, p.Entries...)
+	s.queue(p.Events)
+	return nil
+}
+
+// GetPayment retrieves a payment by its transaction ID
+func (s *Store) GetPayment(ctx context.Context, transactionID string) (*db.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[transactionID]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	payment := *p
+	return &payment, nil
+}
+
+// GetPaymentByChainTxHash retrieves the payment settled by an on-chain transaction
+func (s *Store) GetPaymentByChainTxHash(ctx context.Context, chainTxHash string) (*db.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.payments {
+		if p.ChainTxHash != "" && strings.EqualFold(p.ChainTxHash, chainTxHash) {
+			payment := *p
+			return &payment, nil
+		}
+	}
+	return nil, db.ErrNotFound
+}
+
+// GetPaymentStatus retrieves the status of a payment
+func (s *Store) GetPaymentStatus(ctx context.Context, transactionID string) (string, error) {
+	p, err := s.GetPayment(ctx, transactionID)
+	if err != nil {
+		return "", err
+	}
+	return p.Status, nil
+}
+
+// ListPayments returns the payments matching the filter, ordered by creation time
+func (s *Store) ListPayments(ctx context.Context, f db.PaymentFilter) ([]*db.Payment, error) {
+	if f.PartyID == "" {
+		return nil, fmt.Errorf("party ID is required to list payments")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var payments []*db.Payment
+	for _, p := range s.payments {
+		if matches(p, f) {
+			payment := *p
+			payments = append(payments, &payment)
+		}
+	}
+
+	sort.Slice(payments, func(i, j int) bool {
+		less := before(payments[i].CreatedAt, payments[i].TransactionID, payments[j].CreatedAt, payments[j].TransactionID)
+		if f.OldestFirst {
+			return less
+		}
+		return !less
+	})
+
+	if f.Limit > 0 && len(payments) > f.Limit {
+		payments = payments[:f.Limit]
+	}
+	return payments, nil
+}
+
+// matches reports whether a payment passes the filter, including the page cursor
+func matches(p *db.Payment, f db.PaymentFilter) bool {
+	switch {
+	case p.SenderID != f.PartyID && p.ReceiverID != f.PartyID:
+		return false
+	case f.SenderID != "" && p.SenderID != f.SenderID:
+		return false
+	case f.ReceiverID != "" && p.ReceiverID != f.ReceiverID:
+		return false
+	case f.Status != "" && p.Status != f.Status:
+		return false
+	case f.Currency != "" && p.Amount.Currency() != f.Currency:
+		return false
+	case !f.CreatedAfter.IsZero() && p.CreatedAt.Before(f.CreatedAfter):
+		return false
+	case !f.CreatedBefore.IsZero() && !p.CreatedAt.Before(f.CreatedBefore):
+		return false
+	}
+
+	if f.After != nil {
+		if f.OldestFirst {
+			return before(f.After.CreatedAt, f.After.TransactionID, p.CreatedAt, p.TransactionID)
+		}
+		return before(p.CreatedAt, p.TransactionID, f.After.CreatedAt, f.After.TransactionID)
+	}
+	return true
+}
+
+// before orders payments by (created_at, transaction_id), like the Postgres keyset
+func before(aTime time.Time, aID string, bTime time.Time, bID string) bool {
+	if !aTime.Equal(bTime) {
+		return aTime.Before(bTime)
+	}
+	return aID < bID
+}
+
+// GetIdempotencyRecord fetches the record stored for a sender's idempotency key
+func (s *Store) GetIdempotencyRecord(ctx context.Context, senderID, key string) (*db.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.idempotency[[2]string{senderID, key}]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	return &rec, nil
+}
+
+// TransitionPaymentStatus moves a payment between statuses if it is still in the expected one
+func (s *Store) TransitionPaymentStatus(ctx context.Context, t db.StatusTransition) error {
+	if err := lifecycle.ValidateTransition(t.From, t.To); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.duplicate(t.Inbox) {
+		return db.ErrDuplicateMessage
+	}
+	p, ok := s.payments[t.TransactionID]
+	if !ok || p.Status != string(t.From) {
+		return db.ErrStatusConflict
+	}
+	if err := validateEntries(t.Entries); err != nil {
+		return err
+	}
+
+	s.receive(t.Inbox)
+	p.Status = string(t.To)
+	if t.ChainTxHash != "" {
+		p.ChainTxHash = t.ChainTxHash
+	}
+	p.UpdatedAt = time.Now()
+	s.record(t.TransactionID, t.From, t.To, t.Actor, t.Reason)
+	s.entries = append(s.entries, t.Entries...)
+	return nil
+}
+
+// CreateRefund records a refund and updates the payment's refunded total and status
+func (s *Store) CreateRefund(ctx context.Context, r db.NewRefund) error {
+	newTotal, err := r.PreviousRefunded.Add(r.Amount)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Idempotency != nil {
+		if _, ok := s.idempotency[[2]string{r.Idempotency.SenderID, r.Idempotency.Key}]; ok {
+			return db.ErrIdempotencyKeyExists
+		}
+	}
+	p, ok := s.payments[r.TransactionID]
+	if !ok || p.Status != string(r.From) {
+		return db.ErrStatusConflict
+	}
+	if cmp, err := p.Refunded.Cmp(r.PreviousRefunded); err != nil || cmp != 0 {
+		return db.ErrStatusConflict
+	}
+	if cmp, err := p.Amount.Cmp(newTotal); err != nil || cmp < 0 {
+		return db.ErrStatusConflict
+	}
+	if _, ok := s.refunds[r.RefundID]; ok {
+		return fmt.Errorf("failed to save refund: refund %s already exists", r.RefundID)
+	}
+	if err := validateEntries(r.Entries); err != nil {
+		return err
+	}
+
+	p.Refunded = newTotal
+	p.Status = string(r.To)
+	p.UpdatedAt = time.Now()
+	s.refunds[r.RefundID] = &Refund{
+		RefundID:      r.RefundID,
+		TransactionID: r.TransactionID,
+		Amount:        r.Amount,
+		Status:        r.Status,
+		Actor:         r.Actor,
+		Reason:        r.Reason,
+	}
+	if r.Idempotency != nil {
+		s.idempotency[[2]string{r.Idempotency.SenderID, r.Idempotency.Key}] = *r.Idempotency
+	}
+	if r.From != r.To {
+		s.record(r.TransactionID, r.From, r.To, r.Actor, r.Reason)
+	}
+	s.entries = append(s.entries, r.Entries...)
+	s.queue(r.Events)
+	return nil
+}
+
+// CompleteChainRefund records the outcome of a pending refund's on-chain compensating transfer, undoing
+// the refund if the transfer failed
+func (s *Store) CompleteChainRefund(ctx context.Context, o db.ChainRefundOutcome) (*db.RefundReversal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.duplicate(o.Inbox) {
+		return nil, db.ErrDuplicateMessage
+	}
+	r, ok := s.refunds[o.RefundID]
+	if !ok || r.Status != db.RefundPending {
+		return nil, db.ErrRefundNotFound
+	}
+
+	var reversal *db.RefundReversal
+	if o.Status == db.RefundFailed {
+		p := s.payments[r.TransactionID]
+		var err error
+		if reversal, err = db.NewRefundReversal(p, r.Amount); err != nil {
+			return nil, err
+		}
+		entry := ledger.RefundReversed(ledger.Payment{
+			TransactionID: p.TransactionID,
+			SenderID:      p.SenderID,
+			ReceiverID:    p.ReceiverID,
+			Amount:        p.Amount,
+		}, r.Amount)
+		if err := validateEntries([]ledger.Entry{entry}); err != nil {
+			return nil, err
+		}
+
+		p.Refunded, _ = p.Refunded.Sub(r.Amount)
+		p.Status = string(reversal.To)
+		p.UpdatedAt = time.Now()
+		if reversal.From != reversal.To {
+			s.record(p.TransactionID, reversal.From, reversal.To, o.Actor, fmt.Sprintf("refund %s failed: %s", o.RefundID, o.Failure))
+		}
+		s.entries = append(s.entries, entry)
+	}
+
+	s.receive(o.Inbox)
+	r.Status = o.Status
+	r.ChainTxHash = o.ChainTxHash
+	r.FailureReason = o.Failure
+	return reversal, nil
+}
+
+// HasProcessedMessage reports whether the consumer already processed the message
+func (s *Store) HasProcessedMessage(ctx context.Context, msg db.InboxMessage) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.duplicate(&msg), nil
+}
+
+// PruneInbox forgets the messages processed before the cutoff and returns how many there were
+func (s *Store) PruneInbox(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for msg, processedAt := range s.inbox {
+		if processedAt.Before(before) {
+			delete(s.inbox, msg)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// RelayOutbox publishes up to limit due outbox messages, rescheduling failed ones after backoff(attempts).
+// Like the database, it claims the messages for the lease and publishes them without holding the lock.
+func (s *Store) RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func(db.OutboxMessage) error, backoff func(attempts int) time.Duration) (int, error) {
+	s.mu.Lock()
+	var batch []*outboxEntry
+	now := time.Now()
+	for _, entry := range s.outbox {
+		if len(batch) >= limit {
+			break
+		}
+		if entry.sent || entry.nextAttemptAt.After(now) {
+			continue
+		}
+		entry.nextAttemptAt = now.Add(lease)
+		batch = append(batch, entry)
+	}
+	messages := make([]db.OutboxMessage, len(batch))
+	for i, entry := range batch {
+		messages[i] = entry.msg
+	}
+	s.mu.Unlock()
+
+	errs := make([]error, len(batch))
+	for i, msg := range messages {
+		errs[i] = publish(msg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	published := 0
+	now = time.Now()
+	for i, entry := range batch {
+		if err := errs[i]; err != nil {
+			entry.msg.Attempts++
+			entry.lastError = err.Error()
+			entry.nextAttemptAt = now.Add(backoff(entry.msg.Attempts))
+			continue
+		}
+		entry.sent = true
+		entry.lastError = ""
+		published++
+	}
+	return published, nil
+}
+
+// TrialBalance sums the debits and credits of every ledger account
+func (s *Store) TrialBalance(ctx context.Context) (*ledger.TrialBalance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := make(map[string]int)
+	var balances []ledger.AccountBalance
+	for _, entry := range s.entries {
+		for _, posting := range entry.Postings {
+			i, ok := index[posting.Account.Code]
+			if !ok {
+				zero, err := money.Zero(posting.Account.Currency)
+				if err != nil {
+					return nil, err
+				}
+				i = len(balances)
+				index[posting.Account.Code] = i
+				balances = append(balances, ledger.AccountBalance{Account: posting.Account, Debits: zero, Credits: zero})
+			}
+
+			var err error
+			if posting.Amount.Sign() > 0 {
+				balances[i].Debits, err = balances[i].Debits.Add(posting.Amount)
+			} else {
+				balances[i].Credits, err = balances[i].Credits.Add(posting.Amount.Neg())
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Same order as the Postgres implementation
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Account.Currency != balances[j].Account.Currency {
+			return balances[i].Account.Currency < balances[j].Account.Currency
+		}
+		return balances[i].Account.Code < balances[j].Account.Code
+	})
+	return ledger.NewTrialBalance(balances)
+}
+
+// History returns the status changes recorded for a payment, oldest first
+func (s *Store) History(transactionID string) []StatusChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []StatusChange
+	for _, c := range s.history {
+		if c.TransactionID == transactionID {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// ListStatusChanges returns the status changes of a payment recorded after afterID, oldest first. A
+// change's ID is its position in the history, counting from 1.
+func (s *Store) ListStatusChanges(ctx context.Context, transactionID string, afterID int64) ([]db.StatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []db.StatusChange
+	for i := max(afterID, 0); i < int64(len(s.history)); i++ {
+		c := s.history[i]
+		if c.TransactionID != transactionID {
+			continue
+		}
+		changes = append(changes, db.StatusChange{
+			ID:            i + 1,
+			TransactionID: c.TransactionID,
+			From:          c.From,
+			To:            c.To,
+			Reason:        c.Reason,
+			At:            c.At,
+		})
+	}
+	return changes, nil
+}
+
+// Refund returns a stored refund, or nil if there is none with the ID
+func (s *Store) Refund(refundID string) *Refund {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.refunds[refundID]
+	if !ok {
+		return nil
+	}
+	refund := *r
+	return &refund
+}
+
+// record appends a status change to the history; s.mu must be held
+func (s *Store) record(transactionID string, from, to lifecycle.Status, actor, reason string) {
+	s.history = append(s.history, StatusChange{
+		TransactionID: transactionID,
+		From:          from,
+		To:            to,
+		Actor:         actor,
+		Reason:        reason,
+		At:            time.Now(),
+	})
+}
+
+// duplicate reports whether the consumer already processed a message, nil being none; s.mu must be held
+func (s *Store) duplicate(msg *db.InboxMessage) bool {
+	if msg == nil {
+		return false
+	}
+	_, ok := s.inbox[*msg]
+	return ok
+}
+
+// receive records a message, unless nil, as processed; s.mu must be held
+func (s *Store) receive(msg *db.InboxMessage) {
+	if msg != nil {
+		s.inbox[*msg] = time.Now()
+	}
+}
+
+// queue adds events to the outbox; s.mu must be held
+func (s *Store) queue(events []db.OutboxMessage) {
+	for _, event := range events {
+		event.ID = int64(len(s.outbox) + 1)
+		event.CreatedAt = time.Now()
+		s.outbox = append(s.outbox, &outboxEntry{msg: event, nextAttemptAt: event.CreatedAt})
+	}
+}
+
+// validateEntries checks the double-entry invariants the Postgres implementation enforces when posting
+func validateEntries(entries []ledger.Entry) error {
+	for _, entry := range entries {
+		if err := entry.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/money"
+)
+
+func mustParse(t *testing.T, value, currency string) money.Amount {
+	t.Helper()
+	amount, err := money.Parse(value, currency)
+	if err != nil {
+		t.Fatalf("Parse(%q, %q): %v", value, currency, err)
+	}
+	return amount
+}
+
+// createPayment stores a pending payment with the entries the handlers post for it
+func createPayment(t *testing.T, s *Store, p ledger.Payment) {
+	t.Helper()
+	err := s.CreatePayment(context.Background(), db.NewPayment{
+		TransactionID: p.TransactionID,
+		SenderID:      p.SenderID,
+		ReceiverID:    p.ReceiverID,
+		Amount:        p.Amount,
+		Entries:       []ledger.Entry{ledger.PaymentAccepted(p)},
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment(%s): %v", p.TransactionID, err)
+	}
+}
+
+// transition moves a payment through the given statuses, posting each transition's entries
+func transition(t *testing.T, s *Store, p ledger.Payment, fees ledger.FeeSchedule, statuses ...lifecycle.Status) {
+	t.Helper()
+	from := lifecycle.Pending
+	for _, to := range statuses {
+		entries, err := ledger.ForTransition(p, from, to, fees)
+		if err != nil {
+			t.Fatalf("ForTransition(%s -> %s): %v", from, to, err)
+		}
+		err = s.TransitionPaymentStatus(context.Background(), db.StatusTransition{
+			TransactionID: p.TransactionID,
+			From:          from,
+			To:            to,
+			Actor:         "test",
+			Entries:       entries,
+		})
+		if err != nil {
+			t.Fatalf("TransitionPaymentStatus(%s -> %s): %v", from, to, err)
+		}
+		from = to
+	}
+}
+
+func TestTrialBalanceSumsToZero(t *testing.T) {
+	s := NewStore()
+	fees := ledger.FeeSchedule{BasisPoints: 150}
+
+	settled := ledger.Payment{TransactionID: "tx-settled", SenderID: "alice", ReceiverID: "bob", Amount: mustParse(t, "100.00", "USD")}
+	createPayment(t, s, settled)
+	transition(t, s, settled, fees, lifecycle.Submitted, lifecycle.Completed)
+
+	refund := mustParse(t, "40.00", "USD")
+	err := s.CreateRefund(context.Background(), db.NewRefund{
+		RefundID:         "refund-1",
+		TransactionID:    settled.TransactionID,
+		Amount:           refund,
+		PreviousRefunded: mustParse(t, "0", "USD"),
+		From:             lifecycle.Completed,
+		To:               lifecycle.PartiallyRefunded,
+		Status:           db.RefundCompleted,
+		Actor:            "test",
+		Entries:          []ledger.Entry{ledger.Refund(settled, refund)},
+	})
+	if err != nil {
+		t.Fatalf("CreateRefund: %v", err)
+	}
+
+	failed := ledger.Payment{TransactionID: "tx-failed", SenderID: "carol", ReceiverID: "bob", Amount: mustParse(t, "2500", "JPY")}
+	createPayment(t, s, failed)
+	transition(t, s, failed, fees, lifecycle.Failed)
+
+	pending := ledger.Payment{TransactionID: "tx-pending", SenderID: "alice", ReceiverID: "dave", Amount: mustParse(t, "12.34", "EUR")}
+	createPayment(t, s, pending)
+
+	tb, err := s.TrialBalance(context.Background())
+	if err != nil {
+		t.Fatalf("TrialBalance: %v", err)
+	}
+	if err := tb.Check(); err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+	if len(tb.Totals) != 3 {
+		t.Errorf("trial balance has %d currencies, want 3", len(tb.Totals))
+	}
+
+	balances := make(map[string]string)
+	for _, account := range tb.Accounts {
+		balances[account.Account.Code] = account.Balance().String()
+	}
+	want := map[string]string{
+		"user:alice:USD": "60.00",  // Paid 100.00, got 40.00 back
+		"user:bob:USD":   "-58.50", // Received 98.50 after the fee, returned 40.00
+		"fees:USD":       "-1.50",
+		"clearing:USD":   "0.00",
+		"user:carol:JPY": "0", // Released after the failure
+		"clearing:JPY":   "0",
+		"user:alice:EUR": "12.34", // Still in clearing
+		"clearing:EUR":   "-12.34",
+	}
+	for account, balance := range want {
+		if balances[account] != balance {
+			t.Errorf("balance of %s = %q, want %q", account, balances[account], balance)
+		}
+	}
+}
+
+func TestCreatePaymentRejectsUnbalancedEntries(t *testing.T) {
+	s := NewStore()
+	p := ledger.Payment{TransactionID: "tx-1", SenderID: "alice", ReceiverID: "bob", Amount: mustParse(t, "10.00", "USD")}
+
+	entry := ledger.PaymentAccepted(p)
+	entry.Postings[1].Amount = mustParse(t, "-9.99", "USD")
+	err := s.CreatePayment(context.Background(), db.NewPayment{
+		TransactionID: p.TransactionID,
+		SenderID:      p.SenderID,
+		ReceiverID:    p.ReceiverID,
+		Amount:        p.Amount,
+		Entries:       []ledger.Entry{entry},
+	})
+	if err == nil {
+		t.Fatal("CreatePayment accepted an unbalanced entry")
+	}
+	if _, err := s.GetPayment(context.Background(), p.TransactionID); err != db.ErrNotFound {
+		t.Errorf("GetPayment after rejected create = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFailedChainRefundIsReversed(t *testing.T) {
+	s := NewStore()
+	p := ledger.Payment{TransactionID: "tx-1", SenderID: "alice", ReceiverID: "bob", Amount: mustParse(t, "100.00", "USD")}
+	createPayment(t, s, p)
+	transition(t, s, p, ledger.FeeSchedule{}, lifecycle.Submitted, lifecycle.Completed)
+
+	refund := func(id, value string, previous string, from, to lifecycle.Status) {
+		t.Helper()
+		amount := mustParse(t, value, "USD")
+		err := s.CreateRefund(context.Background(), db.NewRefund{
+			RefundID:         id,
+			TransactionID:    p.TransactionID,
+			Amount:           amount,
+			PreviousRefunded: mustParse(t, previous, "USD"),
+			From:             from,
+			To:               to,
+			Status:           db.RefundPending,
+			Actor:            "test",
+			Entries:          []ledger.Entry{ledger.Refund(p, amount)},
+		})
+		if err != nil {
+			t.Fatalf("CreateRefund(%s): %v", id, err)
+		}
+	}
+	refund("refund-1", "30.00", "0", lifecycle.Completed, lifecycle.PartiallyRefunded)
+	refund("refund-2", "70.00", "30.00", lifecycle.PartiallyRefunded, lifecycle.Refunded)
+
+	tests := []struct {
+		refundID     string
+		outcome      string
+		wantReversal bool
+		wantStatus   lifecycle.Status
+		wantRefunded string
+	}{
+		{refundID: "refund-2", outcome: db.RefundFailed, wantReversal: true, wantStatus: lifecycle.PartiallyRefunded, wantRefunded: "30.00"},
+		{refundID: "refund-1", outcome: db.RefundCompleted, wantStatus: lifecycle.PartiallyRefunded, wantRefunded: "30.00"},
+	}
+	for _, tt := range tests {
+		reversal, err := s.CompleteChainRefund(context.Background(), db.ChainRefundOutcome{
+			RefundID: tt.refundID,
+			Status:   tt.outcome,
+			Failure:  "insufficient funds",
+			Actor:    "test",
+		})
+		if err != nil {
+			t.Fatalf("CompleteChainRefund(%s): %v", tt.refundID, err)
+		}
+		if (reversal != nil) != tt.wantReversal {
+			t.Errorf("CompleteChainRefund(%s) reversal = %+v, want reversal %v", tt.refundID, reversal, tt.wantReversal)
+		}
+
+		payment, err := s.GetPayment(context.Background(), p.TransactionID)
+		if err != nil {
+			t.Fatalf("GetPayment: %v", err)
+		}
+		if payment.Status != string(tt.wantStatus) || payment.Refunded.String() != tt.wantRefunded {
+			t.Errorf("after %s: payment is %s with %s refunded, want %s with %s", tt.refundID, payment.Status, payment.Refunded, tt.wantStatus, tt.wantRefunded)
+		}
+		if got := s.Refund(tt.refundID).Status; got != tt.outcome {
+			t.Errorf("refund %s is %s, want %s", tt.refundID, got, tt.outcome)
+		}
+	}
+
+	// The reversed amount can be refunded again
+	refund("refund-3", "70.00", "30.00", lifecycle.PartiallyRefunded, lifecycle.Refunded)
+
+	history := s.History(p.TransactionID)
+	last := history[len(history)-1]
+	if last.From != lifecycle.PartiallyRefunded || last.To != lifecycle.Refunded {
+		t.Errorf("last status change is %s -> %s, want PARTIALLY_REFUNDED -> REFUNDED", last.From, last.To)
+	}
+	reversed := history[len(history)-2]
+	if reversed.From != lifecycle.Refunded || reversed.To != lifecycle.PartiallyRefunded {
+		t.Errorf("reversal recorded %s -> %s, want REFUNDED -> PARTIALLY_REFUNDED", reversed.From, reversed.To)
+	}
+
+	tb, err := s.TrialBalance(context.Background())
+	if err != nil {
+		t.Fatalf("TrialBalance: %v", err)
+	}
+	if err := tb.Check(); err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+	for _, account := range tb.Accounts {
+		if account.Account.Code == "user:bob:USD" && account.Balance().String() != "0.00" {
+			t.Errorf("receiver balance = %s, want 0.00 after refunding everything", account.Balance())
+		}
+	}
+}
+
+func TestFailedChainRefundOfLastRefundRestoresCompleted(t *testing.T) {
+	s := NewStore()
+	p := ledger.Payment{TransactionID: "tx-1", SenderID: "alice", ReceiverID: "bob", Amount: mustParse(t, "100.00", "USD")}
+	createPayment(t, s, p)
+	transition(t, s, p, ledger.FeeSchedule{}, lifecycle.Submitted, lifecycle.Completed)
+
+	amount := mustParse(t, "100.00", "USD")
+	err := s.CreateRefund(context.Background(), db.NewRefund{
+		RefundID:         "refund-1",
+		TransactionID:    p.TransactionID,
+		Amount:           amount,
+		PreviousRefunded: mustParse(t, "0", "USD"),
+		From:             lifecycle.Completed,
+		To:               lifecycle.Refunded,
+		Status:           db.RefundPending,
+		Entries:          []ledger.Entry{ledger.Refund(p, amount)},
+	})
+	if err != nil {
+		t.Fatalf("CreateRefund: %v", err)
+	}
+
+	reversal, err := s.CompleteChainRefund(context.Background(), db.ChainRefundOutcome{RefundID: "refund-1", Status: db.RefundFailed})
+	if err != nil {
+		t.Fatalf("CompleteChainRefund: %v", err)
+	}
+	if reversal == nil || reversal.From != lifecycle.Refunded || reversal.To != lifecycle.Completed {
+		t.Fatalf("reversal = %+v, want REFUNDED -> COMPLETED", reversal)
+	}
+
+	payment, _ := s.GetPayment(context.Background(), p.TransactionID)
+	if payment.Status != string(lifecycle.Completed) || !payment.Refunded.IsZero() {
+		t.Errorf("payment is %s with %s refunded, want COMPLETED with nothing refunded", payment.Status, payment.Refunded)
+	}
+
+	// The outcome of a refund is only recorded once
+	_, err = s.CompleteChainRefund(context.Background(), db.ChainRefundOutcome{RefundID: "refund-1", Status: db.RefundFailed})
+	if err != db.ErrRefundNotFound {
+		t.Errorf("second CompleteChainRefund = %v, want ErrRefundNotFound", err)
+	}
+}
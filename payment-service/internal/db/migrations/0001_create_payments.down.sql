@@ -0,0 +1,3 @@
+DROP TABLE payment_status_history;
+DROP TABLE idempotency_keys;
+DROP TABLE payments;
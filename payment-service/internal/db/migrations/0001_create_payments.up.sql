@@ -0,0 +1,40 @@
+-- Payments, the idempotency keys that created them and the audit trail of their status changes.
+-- Databases created before migrations already hold some of these tables and columns (the original
+-- payments table, or the schema earlier versions created on startup), so existing ones are adopted.
+CREATE TABLE IF NOT EXISTS payments (
+    transaction_id  TEXT PRIMARY KEY,
+    sender_id       TEXT NOT NULL,
+    receiver_id     TEXT NOT NULL,
+    amount          NUMERIC NOT NULL CHECK (amount > 0),
+    status          TEXT NOT NULL
+);
+
+-- Amounts are exact decimals; the original table stored them as floats
+ALTER TABLE payments ALTER COLUMN amount TYPE NUMERIC USING amount::NUMERIC;
+
+-- Payments stored before the currency was recorded are taken to be in USD
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'USD';
+ALTER TABLE payments ALTER COLUMN currency DROP DEFAULT;
+
+-- The key is claimed before the payment row is written, so the foreign key is checked at commit
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    sender_id           TEXT NOT NULL,
+    idempotency_key     TEXT NOT NULL,
+    request_fingerprint TEXT NOT NULL,
+    transaction_id      TEXT NOT NULL REFERENCES payments (transaction_id) DEFERRABLE INITIALLY DEFERRED,
+    response            BYTEA NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (sender_id, idempotency_key)
+);
+
+CREATE TABLE IF NOT EXISTS payment_status_history (
+    id             BIGSERIAL PRIMARY KEY,
+    transaction_id TEXT NOT NULL REFERENCES payments (transaction_id),
+    from_status    TEXT NOT NULL,
+    to_status      TEXT NOT NULL,
+    actor          TEXT NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payment_status_history_transaction_idx ON payment_status_history (transaction_id, created_at);
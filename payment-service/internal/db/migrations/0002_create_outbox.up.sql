@@ -0,0 +1,15 @@
+-- Events written with the change they announce, published to RabbitMQ by the outbox relay
+CREATE TABLE IF NOT EXISTS outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    queue           TEXT NOT NULL,
+    content_type    TEXT NOT NULL,
+    body            BYTEA NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at         TIMESTAMPTZ
+);
+
+-- The relay only ever scans unsent messages
+CREATE INDEX IF NOT EXISTS outbox_unsent_idx ON outbox (next_attempt_at, id) WHERE sent_at IS NULL;
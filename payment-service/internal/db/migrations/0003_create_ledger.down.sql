@@ -0,0 +1,5 @@
+DROP TABLE postings;
+DROP TABLE journal_entries;
+DROP TABLE ledger_accounts;
+DROP FUNCTION ledger_check_entry_balance();
+DROP FUNCTION ledger_reject_change();
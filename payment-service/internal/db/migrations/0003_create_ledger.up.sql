@@ -0,0 +1,59 @@
+-- Double-entry ledger: accounts, journal entries and their postings (positive = debit, negative = credit)
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id         BIGSERIAL PRIMARY KEY,
+    code       TEXT NOT NULL UNIQUE,
+    kind       TEXT NOT NULL,
+    owner_id   TEXT NOT NULL DEFAULT '',
+    currency   TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    entry_id       TEXT PRIMARY KEY,
+    transaction_id TEXT NOT NULL REFERENCES payments (transaction_id),
+    kind           TEXT NOT NULL,
+    description    TEXT NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS journal_entries_transaction_idx ON journal_entries (transaction_id);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id         BIGSERIAL PRIMARY KEY,
+    entry_id   TEXT NOT NULL REFERENCES journal_entries (entry_id),
+    account_id BIGINT NOT NULL REFERENCES ledger_accounts (id),
+    amount     NUMERIC NOT NULL CHECK (amount <> 0),
+    currency   TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS postings_entry_idx ON postings (entry_id);
+CREATE INDEX IF NOT EXISTS postings_account_idx ON postings (account_id);
+
+-- Entries are immutable; corrections are made by posting a reversing entry
+CREATE OR REPLACE FUNCTION ledger_reject_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% rows are immutable', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journal_entries_immutable BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_reject_change();
+CREATE TRIGGER postings_immutable BEFORE UPDATE OR DELETE ON postings
+    FOR EACH ROW EXECUTE FUNCTION ledger_reject_change();
+
+-- The postings of an entry must sum to zero in every currency; checked at commit, once all postings are written
+CREATE OR REPLACE FUNCTION ledger_check_entry_balance() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM postings WHERE entry_id = NEW.entry_id
+        GROUP BY currency HAVING SUM(amount) <> 0
+    ) THEN
+        RAISE EXCEPTION 'journal entry % is not balanced', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced AFTER INSERT ON postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_entry_balance();
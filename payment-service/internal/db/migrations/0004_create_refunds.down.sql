@@ -0,0 +1,3 @@
+DROP TABLE refunds;
+ALTER TABLE payments DROP COLUMN chain_tx_hash;
+ALTER TABLE payments DROP COLUMN refunded_amount;
@@ -0,0 +1,22 @@
+-- Refunds of completed payments; on-chain refunds stay PENDING until the compensating transfer is reported.
+-- Payments keep the total refunded so far, and the on-chain transaction that settled them, which on-chain
+-- refunds pay back from. Databases whose schema was created on startup already have both columns.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount NUMERIC NOT NULL DEFAULT 0
+    CHECK (refunded_amount >= 0 AND refunded_amount <= amount);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS chain_tx_hash TEXT;
+
+CREATE TABLE IF NOT EXISTS refunds (
+    refund_id      TEXT PRIMARY KEY,
+    transaction_id TEXT NOT NULL REFERENCES payments (transaction_id),
+    amount         NUMERIC NOT NULL CHECK (amount > 0),
+    currency       TEXT NOT NULL,
+    status         TEXT NOT NULL,
+    actor          TEXT NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    chain_tx_hash  TEXT,
+    failure_reason TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refunds_transaction_idx ON refunds (transaction_id);
@@ -0,0 +1,5 @@
+DROP INDEX payments_chain_tx_hash_idx;
+DROP INDEX payments_receiver_created_idx;
+DROP INDEX payments_sender_created_idx;
+ALTER TABLE payments DROP COLUMN updated_at;
+ALTER TABLE payments DROP COLUMN created_at;
@@ -0,0 +1,9 @@
+-- Keyset pagination of ListPayments for either party, and payment lookup by settlement transaction.
+-- Payments listed by creation time record when they were created and last changed; payments stored
+-- before then count as created now.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS payments_sender_created_idx ON payments (sender_id, created_at, transaction_id);
+CREATE INDEX IF NOT EXISTS payments_receiver_created_idx ON payments (receiver_id, created_at, transaction_id);
+CREATE INDEX IF NOT EXISTS payments_chain_tx_hash_idx ON payments (LOWER(chain_tx_hash));
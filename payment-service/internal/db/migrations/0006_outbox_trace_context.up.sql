@@ -0,0 +1,2 @@
+-- W3C trace context of the request that wrote the message, so the relay's publish continues its trace
+ALTER TABLE outbox ADD COLUMN trace_context JSONB NOT NULL DEFAULT '{}';
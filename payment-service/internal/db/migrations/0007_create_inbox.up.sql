@@ -0,0 +1,11 @@
+-- Messages each consumer already processed, recorded with their side effects so a redelivered message
+-- is recognized and skipped
+CREATE TABLE inbox (
+    consumer     TEXT NOT NULL,
+    message_id   TEXT NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (consumer, message_id)
+);
+
+-- Pruning deletes the oldest entries
+CREATE INDEX inbox_processed_at_idx ON inbox (processed_at);
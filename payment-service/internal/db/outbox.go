@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// OutboxMessage is an event stored in the same transaction as the change it announces,
+// waiting for the outbox relay to publish it to RabbitMQ
+type OutboxMessage struct {
+	ID          int64
+	Queue       string // Destination queue (e.g., "payment_updates")
+	ContentType string // MIME type of Body (e.g., "application/protobuf")
+	Body        []byte
+	Attempts    int // Number of failed publish attempts so far
+	CreatedAt   time.Time
+
+	// TraceContext carries the trace of the request that wrote the message (W3C traceparent and
+	// tracestate headers), so the message is published as part of the same trace
+	TraceContext map[string]string
+}
+
+// insertOutboxMessage queues an event inside the caller's transaction
+func insertOutboxMessage(ctx context.Context, tx *sql.Tx, msg OutboxMessage) error {
+	traceContext, err := json.Marshal(msg.TraceContext)
+	if err != nil {
+		return fmt.Errorf("failed to encode trace context: %v", err)
+	}
+	if msg.TraceContext == nil {
+		traceContext = []byte("{}")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox (queue, content_type, body, trace_context)
+		VALUES ($1, $2, $3, $4)`,
+		msg.Queue, msg.ContentType, msg.Body, traceContext)
+	if err != nil {
+		return fmt.Errorf("failed to save outbox message: %v", err)
+	}
+	return nil
+}
+
+// RelayOutbox publishes up to limit due outbox messages with publish, marking each one sent on success
+// and rescheduling it after backoff(attempts) on failure. The messages are first claimed by moving
+// next_attempt_at a lease into the future and committing, so no transaction or row lock is held while
+// publishing waits for the broker; other relays skip claimed messages until the lease runs out, which
+// is also when the messages of a relay that died mid-batch are picked up again. The lease should
+// outlast publishing a whole batch. It returns the number of messages published.
+func (d *DB) RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func(OutboxMessage) error, backoff func(attempts int) time.Duration) (int, error) {
+	batch, err := d.claimOutboxMessages(ctx, limit, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var sent []int64
+	failed := make(map[int64]error)
+	for _, msg := range batch {
+		if err := publish(msg); err != nil {
+			failed[msg.ID] = err
+			continue
+		}
+		sent = append(sent, msg.ID)
+	}
+
+	if err := d.settleOutboxMessages(ctx, batch, sent, failed, backoff); err != nil {
+		return 0, err
+	}
+	return len(sent), nil
+}
+
+// claimOutboxMessages leases up to limit due outbox messages to the caller, oldest first
+func (d *DB) claimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	rows, err := d.QueryContext(ctx, `
+		WITH due AS (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox
+		SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+		FROM due
+		WHERE outbox.id = due.id
+		RETURNING outbox.id, queue, content_type, body, attempts, created_at, trace_context`,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %v", err)
+	}
+	defer rows.Close()
+
+	var batch []OutboxMessage
+	for rows.Next() {
+		var msg OutboxMessage
+		var traceContext []byte
+		if err := rows.Scan(&msg.ID, &msg.Queue, &msg.ContentType, &msg.Body, &msg.Attempts, &msg.CreatedAt, &traceContext); err != nil {
+			return nil, fmt.Errorf("failed to read outbox message: %v", err)
+		}
+		if err := json.Unmarshal(traceContext, &msg.TraceContext); err != nil {
+			log.Printf("Ignoring invalid trace context of outbox message %d: %v", msg.ID, err)
+		}
+		batch = append(batch, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox messages: %v", err)
+	}
+
+	// RETURNING does not keep the order of the claim
+	sort.Slice(batch, func(i, j int) bool { return batch[i].ID < batch[j].ID })
+	return batch, nil
+}
+
+// settleOutboxMessages marks the published messages of a claimed batch sent and reschedules the
+// failed ones, in one short transaction
+func (d *DB) settleOutboxMessages(ctx context.Context, batch []OutboxMessage, sent []int64, failed map[int64]error, backoff func(attempts int) time.Duration) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	for _, id := range sent {
+		_, err := tx.ExecContext(ctx, `UPDATE outbox SET sent_at = NOW(), last_error = NULL WHERE id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("failed to mark outbox message %d as sent: %v", id, err)
+		}
+	}
+
+	for _, msg := range batch {
+		publishErr, ok := failed[msg.ID]
+		if !ok {
+			continue
+		}
+		// Keep the message and try again later
+		delay := backoff(msg.Attempts + 1)
+		_, err := tx.ExecContext(ctx, `
+			UPDATE outbox
+			SET attempts = attempts + 1, last_error = $1, next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+			WHERE id = $3`,
+			publishErr.Error(), delay.Milliseconds(), msg.ID)
+		if err != nil {
+			return fmt.Errorf("failed to reschedule outbox message %d: %v", msg.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit outbox batch: %v", err)
+	}
+	return nil
+}
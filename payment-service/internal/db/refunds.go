@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/money"
+)
+
+// Refund statuses
+const (
+	RefundCompleted = "COMPLETED" // Money returned (off-chain, or on-chain transfer submitted)
+	RefundPending   = "PENDING"   // Waiting for the on-chain compensating transfer
+	RefundFailed    = "FAILED"    // The on-chain compensating transfer could not be made
+)
+
+// ErrRefundNotFound is returned when updating a refund that does not exist or is no longer pending
+var ErrRefundNotFound = errors.New("pending refund not found")
+
+// NewRefund is everything written when a payment is refunded
+type NewRefund struct {
+	RefundID         string
+	TransactionID    string
+	Amount           money.Amount     // Amount refunded by this refund
+	PreviousRefunded money.Amount     // Payment's refunded total the refund was computed against
+	From             lifecycle.Status // Payment status the refund was computed against
+	To               lifecycle.Status // Payment status after the refund
+	Status           string           // RefundCompleted or RefundPending
+	Actor            string
+	Reason           string
+	Idempotency      *IdempotencyRecord // Optional; claimed in the same transaction as the refund
+	Entries          []ledger.Entry     // Ledger entries moving the refunded money
+	Events           []OutboxMessage    // Events to publish once the refund is committed (e.g., on-chain refund command)
+}
+
+// CreateRefund records a refund, claims its idempotency key, bumps the payment's refunded total and
+// status, posts the ledger entries and queues the outbox events in one transaction. The payment is only updated if its
+// refunded total and status are still the ones the refund was computed against, so concurrent
+// refunds can never together exceed the payment amount.
+func (d *DB) CreateRefund(ctx context.Context, r NewRefund) error {
+	newTotal, err := r.PreviousRefunded.Add(r.Amount)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	// Claim the idempotency key first; a concurrent retry with the same key waits for this transaction
+	// and loses here, rather than on the payment's refunded total
+	if r.Idempotency != nil {
+		if err := insertIdempotencyRecord(ctx, tx, *r.Idempotency); err != nil {
+			return err
+		}
+	}
+
+	// Conditional update: only succeeds if no other refund or status change happened in the meantime
+	res, err := tx.ExecContext(ctx, `
+		UPDATE payments SET refunded_amount = $1, status = $2, updated_at = NOW()
+		WHERE transaction_id = $3 AND refunded_amount = $4 AND status = $5 AND amount >= $1`,
+		newTotal.String(), r.To, r.TransactionID, r.PreviousRefunded.String(), r.From)
+	if err != nil {
+		return fmt.Errorf("failed to update refunded amount: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update refunded amount: %v", err)
+	} else if n == 0 {
+		return ErrStatusConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refunds (refund_id, transaction_id, amount, currency, status, actor, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		r.RefundID, r.TransactionID, r.Amount.String(), r.Amount.Currency(), r.Status, r.Actor, r.Reason)
+	if err != nil {
+		return fmt.Errorf("failed to save refund: %v", err)
+	}
+
+	if r.From != r.To {
+		if err := recordStatusHistory(ctx, tx, r.TransactionID, r.From, r.To, r.Actor, r.Reason); err != nil {
+			return err
+		}
+	}
+
+	if err := postEntries(ctx, tx, r.Entries); err != nil {
+		return err
+	}
+
+	for _, event := range r.Events {
+		if err := insertOutboxMessage(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit refund: %v", err)
+	}
+
+	log.Printf("Refunded %s %s of payment %s (refund %s)", r.Amount, r.Amount.Currency(), r.TransactionID, r.RefundID)
+	return nil
+}
+
+// ChainRefundOutcome is the outcome of a pending refund's on-chain compensating transfer
+type ChainRefundOutcome struct {
+	RefundID    string
+	Status      string        // RefundCompleted or RefundFailed
+	ChainTxHash string        // Compensating transfer, if one was sent
+	Failure     string        // Why the transfer failed
+	Actor       string        // Who reported the outcome, recorded if a failure changes the payment's status
+	Inbox       *InboxMessage // Optional message that reported the outcome, recorded with it
+}
+
+// RefundReversal describes how a failed refund was undone
+type RefundReversal struct {
+	TransactionID string
+	Amount        money.Amount     // Amount no longer counted as refunded
+	From          lifecycle.Status // Payment status before the reversal
+	To            lifecycle.Status // Payment status after it; equal to From if the status did not change
+}
+
+// CompleteChainRefund records the outcome of a pending refund's on-chain compensating transfer. A failed
+// transfer undoes the refund in the same transaction: the amount is taken off the payment's refunded
+// total, the status follows the new total and a reversing ledger entry is posted; the reversal is then
+// returned. If the message that reported the outcome was already processed, ErrDuplicateMessage is
+// returned and nothing changes.
+func (d *DB) CompleteChainRefund(ctx context.Context, o ChainRefundOutcome) (*RefundReversal, error) {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	if err := insertInboxMessage(ctx, tx, o.Inbox); err != nil {
+		return nil, err
+	}
+
+	var transactionID, amount, currency string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE refunds SET status = $1, chain_tx_hash = NULLIF($2, ''), failure_reason = NULLIF($3, ''), updated_at = NOW()
+		WHERE refund_id = $4 AND status = $5
+		RETURNING transaction_id, amount, currency`,
+		o.Status, o.ChainTxHash, o.Failure, o.RefundID, RefundPending).Scan(&transactionID, &amount, &currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefundNotFound
+		}
+		return nil, fmt.Errorf("failed to update refund: %v", err)
+	}
+
+	var reversal *RefundReversal
+	if o.Status == RefundFailed {
+		refunded, err := money.Parse(amount, currency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount stored for refund %s: %v", o.RefundID, err)
+		}
+		if reversal, err = reverseRefund(ctx, tx, transactionID, refunded, o); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit refund outcome: %v", err)
+	}
+	if reversal != nil {
+		log.Printf("Reversed failed refund %s of %s %s for payment %s", o.RefundID, reversal.Amount, currency, transactionID)
+	}
+	return reversal, nil
+}
+
+// reverseRefund undoes a refund inside the caller's transaction. The payment is locked first, so a
+// refund issued concurrently is counted in the total the reversal starts from.
+func reverseRefund(ctx context.Context, tx *sql.Tx, transactionID string, amount money.Amount, o ChainRefundOutcome) (*RefundReversal, error) {
+	p, err := scanPayment(tx.QueryRowContext(ctx,
+		`SELECT `+paymentColumns+` FROM payments WHERE transaction_id = $1 FOR UPDATE`, transactionID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment %s: %v", transactionID, err)
+	}
+
+	reversal, err := NewRefundReversal(p, amount)
+	if err != nil {
+		return nil, err
+	}
+	refunded, _ := p.Refunded.Sub(amount)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE payments SET refunded_amount = $1, status = $2, updated_at = NOW()
+		WHERE transaction_id = $3`,
+		refunded.String(), reversal.To, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update refunded amount: %v", err)
+	}
+
+	if reversal.From != reversal.To {
+		reason := fmt.Sprintf("refund %s failed: %s", o.RefundID, o.Failure)
+		if err := recordStatusHistory(ctx, tx, transactionID, reversal.From, reversal.To, o.Actor, reason); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := ledger.RefundReversed(ledger.Payment{
+		TransactionID: p.TransactionID,
+		SenderID:      p.SenderID,
+		ReceiverID:    p.ReceiverID,
+		Amount:        p.Amount,
+	}, amount)
+	if err := postEntries(ctx, tx, []ledger.Entry{entry}); err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// NewRefundReversal works out what undoing a refund of amount does to a payment. The payment goes back
+// to the status its remaining refunded total calls for, which is the one it had before the refund unless
+// other refunds were issued since. This bypasses the lifecycle, which only ever moves refunds forward.
+func NewRefundReversal(p *Payment, amount money.Amount) (*RefundReversal, error) {
+	refunded, err := p.Refunded.Sub(amount)
+	if err != nil {
+		return nil, err
+	}
+	if refunded.Sign() < 0 {
+		return nil, fmt.Errorf("payment %s has %s refunded, less than the %s being reversed", p.TransactionID, p.Refunded, amount)
+	}
+
+	from, err := lifecycle.ParseStatus(p.Status)
+	if err != nil {
+		return nil, err
+	}
+	if !from.IsRefund() {
+		return nil, fmt.Errorf("payment %s is %s, not refunded", p.TransactionID, from)
+	}
+
+	to := lifecycle.PartiallyRefunded
+	if refunded.IsZero() {
+		to = lifecycle.Completed
+	}
+	return &RefundReversal{TransactionID: p.TransactionID, Amount: amount, From: from, To: to}, nil
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/lifecycle"
+)
+
+// ErrStatusConflict is returned when a payment's status changed between reading and updating it
+var ErrStatusConflict = errors.New("payment status changed concurrently")
+
+// StatusTransition describes a status change and the ledger entries it posts
+type StatusTransition struct {
+	TransactionID string
+	From          lifecycle.Status
+	To            lifecycle.Status
+	Actor         string // Who or what triggered the change (e.g., "rabbitmq:payment_updates")
+	Reason        string
+	ChainTxHash   string         // Optional on-chain settlement transaction to record with the change
+	Entries       []ledger.Entry // Posted in the same transaction as the status change
+	Inbox         *InboxMessage  // Optional message that caused the change, recorded with it
+}
+
+// StatusChange is an entry of a payment's status history
+type StatusChange struct {
+	ID            int64 // Grows with every change recorded, so it orders the changes and resumes a listing
+	TransactionID string
+	From          lifecycle.Status
+	To            lifecycle.Status
+	Reason        string
+	At            time.Time
+}
+
+// TransitionPaymentStatus moves a payment from one status to another, records who triggered it and
+// posts the transition's ledger entries. The update only applies if the payment is still in the
+// expected status, so two concurrent writers can never both win, and illegal transitions are
+// rejected before touching the database. If the message that caused the change was already processed,
+// ErrDuplicateMessage is returned and nothing changes.
+func (d *DB) TransitionPaymentStatus(ctx context.Context, t StatusTransition) error {
+	if err := lifecycle.ValidateTransition(t.From, t.To); err != nil {
+		return err
+	}
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	if err := insertInboxMessage(ctx, tx, t.Inbox); err != nil {
+		return err
+	}
+
+	// Conditional update: only succeeds if nobody moved the payment in the meantime
+	res, err := tx.ExecContext(ctx, `
+		UPDATE payments SET status = $1, chain_tx_hash = COALESCE(NULLIF($4, ''), chain_tx_hash), updated_at = NOW()
+		WHERE transaction_id = $2 AND status = $3`,
+		t.To, t.TransactionID, t.From, t.ChainTxHash)
+	if err != nil {
+		return fmt.Errorf("failed to update payment status: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update payment status: %v", err)
+	} else if n == 0 {
+		return ErrStatusConflict
+	}
+
+	// Record the transition for auditing
+	if err := recordStatusHistory(ctx, tx, t.TransactionID, t.From, t.To, t.Actor, t.Reason); err != nil {
+		return err
+	}
+
+	if err := postEntries(ctx, tx, t.Entries); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit status transition: %v", err)
+	}
+
+	log.Printf("Payment %s moved from %s to %s by %s", t.TransactionID, t.From, t.To, t.Actor)
+	return nil
+}
+
+// recordStatusHistory appends a status change to the payment's audit trail inside the caller's transaction
+func recordStatusHistory(ctx context.Context, tx *sql.Tx, transactionID string, from, to lifecycle.Status, actor, reason string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO payment_status_history (transaction_id, from_status, to_status, actor, reason)
+		VALUES ($1, $2, $3, $4, $5)`,
+		transactionID, from, to, actor, reason)
+	if err != nil {
+		return fmt.Errorf("failed to record status transition: %v", err)
+	}
+	return nil
+}
+
+// ListStatusChanges returns the status changes of a payment recorded after the change with ID afterID,
+// oldest first; afterID 0 lists them all
+func (d *DB) ListStatusChanges(ctx context.Context, transactionID string, afterID int64) ([]StatusChange, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT id, transaction_id, from_status, to_status, reason, created_at
+		FROM payment_status_history
+		WHERE transaction_id = $1 AND id > $2
+		ORDER BY id`,
+		transactionID, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list status changes: %v", err)
+	}
+	defer rows.Close()
+
+	var changes []StatusChange
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.ID, &c.TransactionID, &c.From, &c.To, &c.Reason, &c.At); err != nil {
+			return nil, fmt.Errorf("failed to scan status change: %v", err)
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list status changes: %v", err)
+	}
+	return changes, nil
+}
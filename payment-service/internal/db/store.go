@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Go-payments/internal/ledger"
+)
+
+// PaymentStore is the storage the payment handlers depend on. DB implements it on Postgres and
+// memory.Store in process, for tests and for running the service without a database.
+type PaymentStore interface {
+	// CreatePayment stores a new payment with its idempotency key, ledger entries and outbox events
+	CreatePayment(ctx context.Context, p NewPayment) error
+
+	// GetPayment returns ErrNotFound if the payment does not exist
+	GetPayment(ctx context.Context, transactionID string) (*Payment, error)
+
+	// GetPaymentByChainTxHash returns ErrNotFound if no payment was settled by the transaction
+	GetPaymentByChainTxHash(ctx context.Context, chainTxHash string) (*Payment, error)
+
+	// GetPaymentStatus returns ErrNotFound if the payment does not exist
+	GetPaymentStatus(ctx context.Context, transactionID string) (string, error)
+
+	// ListStatusChanges returns the payment's status changes recorded after afterID, oldest first
+	ListStatusChanges(ctx context.Context, transactionID string, afterID int64) ([]StatusChange, error)
+
+	// ListPayments returns a page of payments ordered by creation time
+	ListPayments(ctx context.Context, f PaymentFilter) ([]*Payment, error)
+
+	// GetIdempotencyRecord returns ErrNotFound if the sender never used the key
+	GetIdempotencyRecord(ctx context.Context, senderID, key string) (*IdempotencyRecord, error)
+
+	// TransitionPaymentStatus returns ErrStatusConflict if the payment is no longer in t.From
+	TransitionPaymentStatus(ctx context.Context, t StatusTransition) error
+
+	// CreateRefund returns ErrIdempotencyKeyExists if the key was already claimed, and ErrStatusConflict
+	// if the payment changed since the refund was computed
+	CreateRefund(ctx context.Context, r NewRefund) error
+
+	// CompleteChainRefund undoes a failed refund and returns ErrRefundNotFound if the refund is not pending
+	CompleteChainRefund(ctx context.Context, o ChainRefundOutcome) (*RefundReversal, error)
+
+	// HasProcessedMessage reports whether the consumer already processed the message
+	HasProcessedMessage(ctx context.Context, msg InboxMessage) (bool, error)
+
+	// PruneInbox forgets the messages processed before the cutoff and returns how many there were
+	PruneInbox(ctx context.Context, before time.Time) (int, error)
+
+	// RelayOutbox publishes due outbox messages and returns how many were published
+	RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func(OutboxMessage) error, backoff func(attempts int) time.Duration) (int, error)
+
+	// TrialBalance sums the debits and credits of every ledger account
+	TrialBalance(ctx context.Context) (*ledger.TrialBalance, error)
+}
+
+var _ PaymentStore = (*DB)(nil)
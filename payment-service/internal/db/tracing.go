@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Go-payments/internal/ledger"
+	"github.com/Go-payments/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracing wraps a store so every operation is recorded as a client span (e.g., "db.CreatePayment"),
+// a child of the span in the context the operation is called with. RelayOutbox is left out: it polls
+// every second, and the messages it publishes are traced as part of the requests that wrote them.
+func WithTracing(store PaymentStore) PaymentStore {
+	return &tracedStore{store: store}
+}
+
+type tracedStore struct {
+	store PaymentStore
+}
+
+func (t *tracedStore) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "db."+operation, trace.SpanKindClient,
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperationName(operation),
+	)
+}
+
+func (t *tracedStore) CreatePayment(ctx context.Context, p NewPayment) error {
+	ctx, span := t.start(ctx, "CreatePayment")
+	err := t.store.CreatePayment(ctx, p)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStore) GetPayment(ctx context.Context, transactionID string) (*Payment, error) {
+	ctx, span := t.start(ctx, "GetPayment")
+	p, err := t.store.GetPayment(ctx, transactionID)
+	tracing.End(span, ignoreNotFound(err))
+	return p, err
+}
+
+func (t *tracedStore) GetPaymentByChainTxHash(ctx context.Context, chainTxHash string) (*Payment, error) {
+	ctx, span := t.start(ctx, "GetPaymentByChainTxHash")
+	p, err := t.store.GetPaymentByChainTxHash(ctx, chainTxHash)
+	tracing.End(span, ignoreNotFound(err))
+	return p, err
+}
+
+func (t *tracedStore) GetPaymentStatus(ctx context.Context, transactionID string) (string, error) {
+	ctx, span := t.start(ctx, "GetPaymentStatus")
+	status, err := t.store.GetPaymentStatus(ctx, transactionID)
+	tracing.End(span, ignoreNotFound(err))
+	return status, err
+}
+
+func (t *tracedStore) ListStatusChanges(ctx context.Context, transactionID string, afterID int64) ([]StatusChange, error) {
+	ctx, span := t.start(ctx, "ListStatusChanges")
+	changes, err := t.store.ListStatusChanges(ctx, transactionID, afterID)
+	tracing.End(span, err)
+	return changes, err
+}
+
+func (t *tracedStore) ListPayments(ctx context.Context, f PaymentFilter) ([]*Payment, error) {
+	ctx, span := t.start(ctx, "ListPayments")
+	payments, err := t.store.ListPayments(ctx, f)
+	tracing.End(span, err)
+	return payments, err
+}
+
+func (t *tracedStore) GetIdempotencyRecord(ctx context.Context, senderID, key string) (*IdempotencyRecord, error) {
+	ctx, span := t.start(ctx, "GetIdempotencyRecord")
+	rec, err := t.store.GetIdempotencyRecord(ctx, senderID, key)
+	tracing.End(span, ignoreNotFound(err))
+	return rec, err
+}
+
+func (t *tracedStore) TransitionPaymentStatus(ctx context.Context, st StatusTransition) error {
+	ctx, span := t.start(ctx, "TransitionPaymentStatus")
+	err := t.store.TransitionPaymentStatus(ctx, st)
+	tracing.End(span, ignoreDuplicate(err))
+	return err
+}
+
+func (t *tracedStore) CreateRefund(ctx context.Context, r NewRefund) error {
+	ctx, span := t.start(ctx, "CreateRefund")
+	err := t.store.CreateRefund(ctx, r)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStore) CompleteChainRefund(ctx context.Context, o ChainRefundOutcome) (*RefundReversal, error) {
+	ctx, span := t.start(ctx, "CompleteChainRefund")
+	reversal, err := t.store.CompleteChainRefund(ctx, o)
+	tracing.End(span, ignoreDuplicate(err))
+	return reversal, err
+}
+
+func (t *tracedStore) HasProcessedMessage(ctx context.Context, msg InboxMessage) (bool, error) {
+	ctx, span := t.start(ctx, "HasProcessedMessage")
+	processed, err := t.store.HasProcessedMessage(ctx, msg)
+	tracing.End(span, err)
+	return processed, err
+}
+
+func (t *tracedStore) PruneInbox(ctx context.Context, before time.Time) (int, error) {
+	ctx, span := t.start(ctx, "PruneInbox")
+	n, err := t.store.PruneInbox(ctx, before)
+	tracing.End(span, err)
+	return n, err
+}
+
+func (t *tracedStore) RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func(OutboxMessage) error, backoff func(attempts int) time.Duration) (int, error) {
+	return t.store.RelayOutbox(ctx, limit, lease, publish, backoff)
+}
+
+func (t *tracedStore) TrialBalance(ctx context.Context) (*ledger.TrialBalance, error) {
+	ctx, span := t.start(ctx, "TrialBalance")
+	tb, err := t.store.TrialBalance(ctx)
+	tracing.End(span, err)
+	return tb, err
+}
+
+// ignoreNotFound keeps lookups of missing rows, an expected outcome, from marking their spans as failed
+func ignoreNotFound(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ignoreDuplicate keeps writes skipped for an already processed message, the expected outcome of a
+// redelivery, from marking their spans as failed
+func ignoreDuplicate(err error) error {
+	if errors.Is(err, ErrDuplicateMessage) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+// Package events encodes the events the payment service publishes in the versioned envelope shared with
+// the blockchain service (see events.proto), and decodes the events it receives.
+package events
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Go-payments/bus"
+	"github.com/Go-payments/internal/events/eventspb"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ContentType marks a message holding an Envelope
+const ContentType = "application/cloudevents+protobuf"
+
+// Source identifies the payment service as the publisher of an event
+const Source = "payment-service"
+
+// Event types, each naming its payload message in events.proto
+const (
+	TypePaymentStatusUpdate = "payments.payment.status_update" // eventspb.PaymentStatusUpdate
+	TypeChainPaymentSent    = "blockchain.payment.sent"        // eventspb.ChainPaymentSent
+	TypeRefundRequested     = "payments.refund.requested"      // eventspb.RefundRequested
+	TypeRefundResult        = "blockchain.refund.result"       // eventspb.RefundResult
+)
+
+// schemaVersions holds the payload schema version of every event type this service knows. When a type
+// gets a new version, Unmarshal must learn to convert the older versions still in flight.
+var schemaVersions = map[string]uint32{
+	TypePaymentStatusUpdate: 1,
+	TypeChainPaymentSent:    1,
+	TypeRefundRequested:     1,
+	TypeRefundResult:        1,
+}
+
+// Event holds the attributes of a decoded envelope
+type Event struct {
+	ID            string
+	Type          string
+	Source        string
+	SchemaVersion uint32
+	CorrelationID string
+	Time          time.Time
+}
+
+// Marshal wraps payload in a new envelope of eventType, correlated with the other events of the same
+// payment or refund by correlationID, and encodes it
+func Marshal(eventType, correlationID string, payload proto.Message) ([]byte, error) {
+	version, ok := schemaVersions[eventType]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+	data, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %v", eventType, err)
+	}
+	return proto.Marshal(&eventspb.Envelope{
+		Id:            uuid.NewString(),
+		Type:          eventType,
+		Source:        Source,
+		SchemaVersion: version,
+		CorrelationId: correlationID,
+		Time:          timestamppb.Now(),
+		Data:          data,
+	})
+}
+
+// IsEnvelope reports whether msg holds an envelope. Messages published before the envelope was
+// introduced carry their payload bare.
+func IsEnvelope(msg bus.Message) bool {
+	return msg.ContentType == ContentType
+}
+
+// Unmarshal decodes the envelope in msg, which must hold an event of eventType, into payload and returns
+// its attributes. A payload of a newer schema version than this service knows is decoded as the newest
+// version it knows, ignoring the fields it does not, since versions only change in ways that keep that
+// possible for the rollout of the new version. Failures are permanent: the message can never be decoded.
+func Unmarshal(msg bus.Message, eventType string, payload proto.Message) (Event, error) {
+	var envelope eventspb.Envelope
+	if err := proto.Unmarshal(msg.Body, &envelope); err != nil {
+		return Event{}, fmt.Errorf("malformed event envelope: %v", err)
+	}
+	event := Event{
+		ID:            envelope.Id,
+		Type:          envelope.Type,
+		Source:        envelope.Source,
+		SchemaVersion: max(envelope.SchemaVersion, 1),
+		CorrelationID: envelope.CorrelationId,
+		Time:          envelope.Time.AsTime(),
+	}
+	if event.Type != eventType {
+		return event, fmt.Errorf("expected a %s event, got %q", eventType, event.Type)
+	}
+	if event.ID == "" {
+		return event, errors.New("event has no id")
+	}
+
+	if known := schemaVersions[eventType]; event.SchemaVersion > known {
+		warnNewerVersion(eventType, event.SchemaVersion, known)
+	}
+	if err := proto.Unmarshal(envelope.Data, payload); err != nil {
+		return event, fmt.Errorf("malformed %s event %s (schema version %d): %v", eventType, event.ID, event.SchemaVersion, err)
+	}
+	return event, nil
+}
+
+// warnedVersions holds the unknown schema versions already logged, by event type and version
+var warnedVersions sync.Map
+
+// warnNewerVersion logs the first event of every schema version newer than the one known
+func warnNewerVersion(eventType string, version, known uint32) {
+	if _, seen := warnedVersions.LoadOrStore(fmt.Sprintf("%s/%d", eventType, version), true); !seen {
+		log.Printf("Received %s events of schema version %d, decoding them as version %d", eventType, version, known)
+	}
+}
@@ -0,0 +1,144 @@
+// Package health answers liveness and readiness probes, over HTTP (/livez, /readyz) and through
+// the standard gRPC health service.
+//
+// Liveness only says the process is up and serving. Readiness also probes the dependencies the
+// service cannot work without, such as Postgres and RabbitMQ, and fails from the moment shutdown
+// begins, so load balancers stop sending traffic before the servers drain.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Check probes one dependency and returns an error if it is unusable
+type Check func(ctx context.Context) error
+
+// Checker runs the readiness checks of the service
+type Checker struct {
+	Timeout time.Duration // How long all checks together may take
+
+	mu       sync.Mutex
+	names    []string
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+// NewChecker creates a Checker without any checks, so it is ready until checks are added
+func NewChecker() *Checker {
+	return &Checker{Timeout: 2 * time.Second, checks: map[string]Check{}}
+}
+
+// Add registers a readiness check under a name reported in /readyz (e.g., "postgres")
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Drain makes the service report itself not ready for the rest of its life; called when shutdown begins
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs every check concurrently and returns each one's outcome ("ok" or the error) and whether
+// all of them passed. Checks still running when the timeout expires count as failed.
+func (c *Checker) Ready(ctx context.Context) (map[string]string, bool) {
+	c.mu.Lock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	type outcome struct {
+		name string
+		err  error
+	}
+	outcomes := make(chan outcome, len(checks))
+	for name, check := range checks {
+		go func(name string, check Check) {
+			outcomes <- outcome{name, check(ctx)}
+		}(name, check)
+	}
+
+	results := make(map[string]string, len(checks))
+	ready := !c.draining.Load()
+	for range checks {
+		select {
+		case o := <-outcomes:
+			results[o.name] = "ok"
+			if o.err != nil {
+				results[o.name] = o.err.Error()
+				ready = false
+			}
+		case <-ctx.Done():
+			for name := range checks {
+				if _, ok := results[name]; !ok {
+					results[name] = "timed out"
+				}
+			}
+			return results, false
+		}
+	}
+	return results, ready
+}
+
+// Register adds /livez and /readyz to e. Neither requires authentication.
+func (c *Checker) Register(e *echo.Echo) {
+	e.GET("/livez", func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	})
+	e.GET("/readyz", func(ctx echo.Context) error {
+		results, ready := c.Ready(ctx.Request().Context())
+		body := map[string]interface{}{"status": "ready", "checks": results}
+		switch {
+		case c.draining.Load():
+			body["status"] = "shutting down"
+		case !ready:
+			body["status"] = "unavailable"
+		}
+		code := http.StatusOK
+		if !ready {
+			code = http.StatusServiceUnavailable
+		}
+		return ctx.JSON(code, body)
+	})
+}
+
+// Report keeps the serving status of the gRPC health service in line with the readiness checks,
+// for the whole server ("") and the given services, until ctx is canceled
+func (c *Checker) Report(ctx context.Context, server *grpchealth.Server, interval time.Duration, services ...string) {
+	services = append([]string{""}, services...)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if _, ready := c.Ready(ctx); !ready {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		for _, service := range services {
+			server.SetServingStatus(service, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
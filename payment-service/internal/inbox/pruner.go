@@ -0,0 +1,55 @@
+// Package inbox prunes the inbox table, where consumers record the messages they processed.
+package inbox
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Store holds the inbox to prune
+type Store interface {
+	PruneInbox(ctx context.Context, before time.Time) (int, error)
+}
+
+// Pruner periodically forgets the messages processed longer ago than the retention. A message delivered
+// again after that would be applied a second time, so the retention must cover the longest time a
+// broker may take to redeliver a message.
+type Pruner struct {
+	DB        Store
+	Retention time.Duration // How long processed messages are remembered
+	Interval  time.Duration // How often the inbox is pruned
+}
+
+// NewPruner creates a Pruner
+func NewPruner(database Store, retention, interval time.Duration) *Pruner {
+	return &Pruner{
+		DB:        database,
+		Retention: retention,
+		Interval:  interval,
+	}
+}
+
+// Run prunes the inbox on startup and then every Interval until the context is canceled
+func (p *Pruner) Run(ctx context.Context) {
+	log.Println("Inbox pruner started")
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := p.DB.PruneInbox(ctx, time.Now().Add(-p.Retention))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error pruning inbox: %v", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d inbox message(s) processed more than %s ago", pruned, p.Retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Inbox pruner stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package ledger implements the double-entry bookkeeping behind payments.
+//
+// Every movement of money is a journal entry made of postings against accounts. A posting with a
+// positive amount is a debit and one with a negative amount is a credit; the postings of an entry
+// must sum to zero in every currency, so money is never created or destroyed. Entries are
+// immutable once written: corrections are made by posting a new, reversing entry.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Go-payments/internal/money"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrUnbalancedEntry is returned when an entry's debits and credits differ
+	ErrUnbalancedEntry = errors.New("journal entry is not balanced")
+
+	// ErrEmptyEntry is returned for entries without postings
+	ErrEmptyEntry = errors.New("journal entry has no postings")
+
+	// ErrZeroPosting is returned for postings that move no money
+	ErrZeroPosting = errors.New("posting amount is zero")
+)
+
+// AccountKind classifies what an account represents
+type AccountKind string
+
+const (
+	KindUser     AccountKind = "user"     // Money held on behalf of a user
+	KindClearing AccountKind = "clearing" // Money of payments that are in flight
+	KindFees     AccountKind = "fees"     // Fees earned by the platform
+)
+
+// Account is a ledger account for one owner and one currency
+type Account struct {
+	Code     string // Unique, human-readable identifier (e.g., "user:alice:USD")
+	Kind     AccountKind
+	OwnerID  string // User the account belongs to; empty for platform accounts
+	Currency string
+}
+
+// UserAccount returns the account holding a user's money in a currency
+func UserAccount(userID, currency string) Account {
+	return Account{
+		Code:     fmt.Sprintf("%s:%s:%s", KindUser, userID, currency),
+		Kind:     KindUser,
+		OwnerID:  userID,
+		Currency: currency,
+	}
+}
+
+// ClearingAccount returns the platform account holding in-flight payments in a currency
+func ClearingAccount(currency string) Account {
+	return Account{Code: fmt.Sprintf("%s:%s", KindClearing, currency), Kind: KindClearing, Currency: currency}
+}
+
+// FeesAccount returns the platform account collecting fees in a currency
+func FeesAccount(currency string) Account {
+	return Account{Code: fmt.Sprintf("%s:%s", KindFees, currency), Kind: KindFees, Currency: currency}
+}
+
+// Posting is a single debit (positive amount) or credit (negative amount) against an account
+type Posting struct {
+	Account Account
+	Amount  money.Amount
+}
+
+// EntryKind names the business event an entry records
+type EntryKind string
+
+const (
+	EntryPaymentAccepted EntryKind = "payment_accepted" // Sender's money moved into clearing
+	EntryPaymentSettled  EntryKind = "payment_settled"  // Clearing paid out to the receiver and the fee account
+	EntryPaymentReleased EntryKind = "payment_released" // Clearing returned to the sender after a failure
+	EntryRefund          EntryKind = "refund"           // Receiver's money returned to the sender
+	EntryRefundReversed  EntryKind = "refund_reversed"  // Refund undone because the money never reached the sender
+)
+
+// Entry is an immutable, balanced set of postings
+type Entry struct {
+	ID            string
+	TransactionID string // Payment the entry belongs to
+	Kind          EntryKind
+	Description   string
+	Postings      []Posting
+}
+
+// Validate checks the double-entry invariants: at least one posting, no zero postings,
+// each posting in its account's currency, and debits equal to credits in every currency
+func (e Entry) Validate() error {
+	if len(e.Postings) == 0 {
+		return fmt.Errorf("%w: %s", ErrEmptyEntry, e.ID)
+	}
+
+	totals := make(map[string]money.Amount)
+	for _, p := range e.Postings {
+		if p.Amount.IsZero() {
+			return fmt.Errorf("%w: entry %s, account %s", ErrZeroPosting, e.ID, p.Account.Code)
+		}
+		if p.Amount.Currency() != p.Account.Currency {
+			return fmt.Errorf("%w: posting of %s to account %s", money.ErrCurrencyMismatch, p.Amount.Currency(), p.Account.Code)
+		}
+
+		total, ok := totals[p.Amount.Currency()]
+		if !ok {
+			totals[p.Amount.Currency()] = p.Amount
+			continue
+		}
+		sum, err := total.Add(p.Amount)
+		if err != nil {
+			return err
+		}
+		totals[p.Amount.Currency()] = sum
+	}
+
+	for currency, total := range totals {
+		if !total.IsZero() {
+			return fmt.Errorf("%w: entry %s is off by %s %s", ErrUnbalancedEntry, e.ID, total, currency)
+		}
+	}
+	return nil
+}
+
+// newEntry builds an entry with a fresh ID, dropping zero postings (e.g., a zero fee)
+func newEntry(kind EntryKind, transactionID, description string, postings ...Posting) Entry {
+	entry := Entry{
+		ID:            uuid.New().String(),
+		TransactionID: transactionID,
+		Kind:          kind,
+		Description:   description,
+	}
+	for _, p := range postings {
+		if !p.Amount.IsZero() {
+			entry.Postings = append(entry.Postings, p)
+		}
+	}
+	return entry
+}
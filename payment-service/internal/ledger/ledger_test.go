@@ -0,0 +1,225 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Go-payments/internal/money"
+)
+
+func mustParse(t *testing.T, value, currency string) money.Amount {
+	t.Helper()
+	amount, err := money.Parse(value, currency)
+	if err != nil {
+		t.Fatalf("Parse(%q, %q): %v", value, currency, err)
+	}
+	return amount
+}
+
+func TestEntryValidate(t *testing.T) {
+	usd := func(value string) money.Amount { return mustParse(t, value, "USD") }
+	eur := func(value string) money.Amount { return mustParse(t, value, "EUR") }
+
+	tests := []struct {
+		name     string
+		postings []Posting
+		want     error
+	}{
+		{
+			name: "balanced",
+			postings: []Posting{
+				{Account: UserAccount("alice", "USD"), Amount: usd("10.00")},
+				{Account: ClearingAccount("USD"), Amount: usd("-10.00")},
+			},
+		},
+		{
+			name: "balanced in two currencies",
+			postings: []Posting{
+				{Account: UserAccount("alice", "USD"), Amount: usd("10.00")},
+				{Account: ClearingAccount("USD"), Amount: usd("-10.00")},
+				{Account: UserAccount("alice", "EUR"), Amount: eur("5.00")},
+				{Account: ClearingAccount("EUR"), Amount: eur("-5.00")},
+			},
+		},
+		{
+			name: "no postings",
+			want: ErrEmptyEntry,
+		},
+		{
+			name: "unbalanced",
+			postings: []Posting{
+				{Account: UserAccount("alice", "USD"), Amount: usd("10.00")},
+				{Account: ClearingAccount("USD"), Amount: usd("-9.99")},
+			},
+			want: ErrUnbalancedEntry,
+		},
+		{
+			name: "only credits",
+			postings: []Posting{
+				{Account: UserAccount("alice", "USD"), Amount: usd("-10.00")},
+				{Account: ClearingAccount("USD"), Amount: usd("-10.00")},
+			},
+			want: ErrUnbalancedEntry,
+		},
+		{
+			name: "balanced across currencies only",
+			postings: []Posting{
+				{Account: UserAccount("alice", "USD"), Amount: usd("10.00")},
+				{Account: ClearingAccount("EUR"), Amount: eur("-10.00")},
+			},
+			want: ErrUnbalancedEntry,
+		},
+		{
+			name: "posting in another currency than its account",
+			postings: []Posting{
+				{Account: UserAccount("alice", "USD"), Amount: eur("10.00")},
+				{Account: ClearingAccount("EUR"), Amount: eur("-10.00")},
+			},
+			want: money.ErrCurrencyMismatch,
+		},
+		{
+			name: "zero posting",
+			postings: []Posting{
+				{Account: UserAccount("alice", "USD"), Amount: usd("10.00")},
+				{Account: ClearingAccount("USD"), Amount: usd("-10.00")},
+				{Account: FeesAccount("USD"), Amount: usd("0")},
+			},
+			want: ErrZeroPosting,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Entry{ID: "entry", Postings: tt.postings}.Validate()
+			if tt.want == nil && err != nil {
+				t.Fatalf("Validate() = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentEntries(t *testing.T) {
+	payment := Payment{
+		TransactionID: "tx-1",
+		SenderID:      "alice",
+		ReceiverID:    "bob",
+		Amount:        mustParse(t, "100.00", "USD"),
+	}
+
+	settled, err := PaymentSettled(payment, mustParse(t, "1.50", "USD"))
+	if err != nil {
+		t.Fatalf("PaymentSettled: %v", err)
+	}
+	unpaid, err := PaymentSettled(payment, mustParse(t, "0", "USD"))
+	if err != nil {
+		t.Fatalf("PaymentSettled without fee: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		entry Entry
+		kind  EntryKind
+		want  map[string]string // Amount posted to each account
+	}{
+		{
+			name:  "accepted",
+			entry: PaymentAccepted(payment),
+			kind:  EntryPaymentAccepted,
+			want:  map[string]string{"user:alice:USD": "100.00", "clearing:USD": "-100.00"},
+		},
+		{
+			name:  "settled",
+			entry: settled,
+			kind:  EntryPaymentSettled,
+			want:  map[string]string{"clearing:USD": "100.00", "user:bob:USD": "-98.50", "fees:USD": "-1.50"},
+		},
+		{
+			name:  "settled without fee",
+			entry: unpaid,
+			kind:  EntryPaymentSettled,
+			want:  map[string]string{"clearing:USD": "100.00", "user:bob:USD": "-100.00"},
+		},
+		{
+			name:  "released",
+			entry: PaymentReleased(payment),
+			kind:  EntryPaymentReleased,
+			want:  map[string]string{"clearing:USD": "100.00", "user:alice:USD": "-100.00"},
+		},
+		{
+			name:  "refund",
+			entry: Refund(payment, mustParse(t, "25.00", "USD")),
+			kind:  EntryRefund,
+			want:  map[string]string{"user:bob:USD": "25.00", "user:alice:USD": "-25.00"},
+		},
+		{
+			name:  "refund reversed",
+			entry: RefundReversed(payment, mustParse(t, "25.00", "USD")),
+			kind:  EntryRefundReversed,
+			want:  map[string]string{"user:alice:USD": "25.00", "user:bob:USD": "-25.00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.entry.Validate(); err != nil {
+				t.Fatalf("Validate() = %v", err)
+			}
+			if tt.entry.Kind != tt.kind || tt.entry.TransactionID != payment.TransactionID {
+				t.Errorf("entry is %s for %s, want %s for %s", tt.entry.Kind, tt.entry.TransactionID, tt.kind, payment.TransactionID)
+			}
+
+			got := make(map[string]string)
+			for _, p := range tt.entry.Postings {
+				got[p.Account.Code] = p.Amount.String()
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("postings = %v, want %v", got, tt.want)
+			}
+			for account, amount := range tt.want {
+				if got[account] != amount {
+					t.Errorf("posting to %s = %q, want %q", account, got[account], amount)
+				}
+			}
+		})
+	}
+}
+
+func TestPaymentSettledRejectsFeeAbovePayment(t *testing.T) {
+	payment := Payment{TransactionID: "tx-1", SenderID: "alice", ReceiverID: "bob", Amount: mustParse(t, "1.00", "USD")}
+	if _, err := PaymentSettled(payment, mustParse(t, "1.01", "USD")); err == nil {
+		t.Fatal("PaymentSettled accepted a fee larger than the payment")
+	}
+}
+
+func TestFeeSchedule(t *testing.T) {
+	tests := []struct {
+		name        string
+		basisPoints int64
+		amount      string
+		currency    string
+		want        string
+	}{
+		{name: "no fee", basisPoints: 0, amount: "100.00", currency: "USD", want: "0.00"},
+		{name: "negative schedule charges nothing", basisPoints: -50, amount: "100.00", currency: "USD", want: "0.00"},
+		{name: "exact", basisPoints: 150, amount: "100.00", currency: "USD", want: "1.50"},
+		{name: "rounds half up", basisPoints: 150, amount: "0.10", currency: "USD", want: "0.00"},
+		{name: "tie rounds up", basisPoints: 50, amount: "1.00", currency: "USD", want: "0.01"},
+		{name: "zero-decimal currency", basisPoints: 150, amount: "1000", currency: "JPY", want: "15"},
+		{name: "three-decimal currency", basisPoints: 25, amount: "2.002", currency: "KWD", want: "0.005"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee, err := FeeSchedule{BasisPoints: tt.basisPoints}.Fee(mustParse(t, tt.amount, tt.currency))
+			if err != nil {
+				t.Fatalf("Fee: %v", err)
+			}
+			if fee.String() != tt.want || fee.Currency() != tt.currency {
+				t.Errorf("Fee(%s %s) = %s %s, want %s %s", tt.amount, tt.currency, fee, fee.Currency(), tt.want, tt.currency)
+			}
+		})
+	}
+}
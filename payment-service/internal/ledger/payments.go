@@ -0,0 +1,113 @@
+package ledger
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/Go-payments/internal/lifecycle"
+	"github.com/Go-payments/internal/money"
+)
+
+// Payment holds the facts about a payment needed to post its ledger entries
+type Payment struct {
+	TransactionID string
+	SenderID      string
+	ReceiverID    string
+	Amount        money.Amount
+}
+
+// FeeSchedule describes the fee charged on settled payments
+type FeeSchedule struct {
+	BasisPoints int64 // Fee as a fraction of the amount, in hundredths of a percent (e.g., 150 = 1.5%)
+}
+
+// Fee computes the fee for an amount, rounded half-up to the currency's precision
+func (f FeeSchedule) Fee(amount money.Amount) (money.Amount, error) {
+	if f.BasisPoints <= 0 {
+		return money.Zero(amount.Currency())
+	}
+	fee := new(big.Rat).Mul(amount.Rat(), big.NewRat(f.BasisPoints, 10000))
+	return money.FromRat(fee, amount.Currency(), money.RoundHalfUp)
+}
+
+// PaymentAccepted moves the payment amount from the sender's account into clearing
+func PaymentAccepted(p Payment) Entry {
+	currency := p.Amount.Currency()
+	return newEntry(EntryPaymentAccepted, p.TransactionID,
+		fmt.Sprintf("Payment %s accepted from %s", p.TransactionID, p.SenderID),
+		Posting{Account: UserAccount(p.SenderID, currency), Amount: p.Amount},
+		Posting{Account: ClearingAccount(currency), Amount: p.Amount.Neg()},
+	)
+}
+
+// PaymentSettled pays the cleared amount out to the receiver, less the fee which goes to the fee account
+func PaymentSettled(p Payment, fee money.Amount) (Entry, error) {
+	currency := p.Amount.Currency()
+	net, err := p.Amount.Sub(fee)
+	if err != nil {
+		return Entry{}, err
+	}
+	if net.Sign() < 0 {
+		return Entry{}, fmt.Errorf("fee %s exceeds payment amount %s", fee, p.Amount)
+	}
+
+	return newEntry(EntryPaymentSettled, p.TransactionID,
+		fmt.Sprintf("Payment %s settled to %s", p.TransactionID, p.ReceiverID),
+		Posting{Account: ClearingAccount(currency), Amount: p.Amount},
+		Posting{Account: UserAccount(p.ReceiverID, currency), Amount: net.Neg()},
+		Posting{Account: FeesAccount(currency), Amount: fee.Neg()},
+	), nil
+}
+
+// PaymentReleased returns the cleared amount to the sender after the payment failed or expired
+func PaymentReleased(p Payment) Entry {
+	currency := p.Amount.Currency()
+	return newEntry(EntryPaymentReleased, p.TransactionID,
+		fmt.Sprintf("Payment %s released back to %s", p.TransactionID, p.SenderID),
+		Posting{Account: ClearingAccount(currency), Amount: p.Amount},
+		Posting{Account: UserAccount(p.SenderID, currency), Amount: p.Amount.Neg()},
+	)
+}
+
+// Refund returns money from the receiver to the sender; fees already earned are not returned
+func Refund(p Payment, amount money.Amount) Entry {
+	currency := amount.Currency()
+	return newEntry(EntryRefund, p.TransactionID,
+		fmt.Sprintf("Refund of %s %s for payment %s", amount, currency, p.TransactionID),
+		Posting{Account: UserAccount(p.ReceiverID, currency), Amount: amount},
+		Posting{Account: UserAccount(p.SenderID, currency), Amount: amount.Neg()},
+	)
+}
+
+// RefundReversed undoes a refund whose money never reached the sender (e.g., the on-chain compensating
+// transfer failed), moving the amount back from the sender to the receiver
+func RefundReversed(p Payment, amount money.Amount) Entry {
+	currency := amount.Currency()
+	return newEntry(EntryRefundReversed, p.TransactionID,
+		fmt.Sprintf("Reversal of a failed refund of %s %s for payment %s", amount, currency, p.TransactionID),
+		Posting{Account: UserAccount(p.SenderID, currency), Amount: amount},
+		Posting{Account: UserAccount(p.ReceiverID, currency), Amount: amount.Neg()},
+	)
+}
+
+// ForTransition returns the entries to post when a payment moves between two statuses.
+// Transitions that do not move money (e.g., SUBMITTED -> CONFIRMING) post nothing, and
+// refunds post their own entries with the refunded amount.
+func ForTransition(p Payment, from, to lifecycle.Status, fees FeeSchedule) ([]Entry, error) {
+	switch to {
+	case lifecycle.Completed:
+		fee, err := fees.Fee(p.Amount)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := PaymentSettled(p, fee)
+		if err != nil {
+			return nil, err
+		}
+		return []Entry{entry}, nil
+	case lifecycle.Failed, lifecycle.Expired:
+		return []Entry{PaymentReleased(p)}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,80 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/Go-payments/internal/money"
+)
+
+// AccountBalance is one line of a trial balance
+type AccountBalance struct {
+	Account Account
+	Debits  money.Amount // Sum of positive postings
+	Credits money.Amount // Sum of negative postings, as a positive number
+}
+
+// Balance returns debits minus credits
+func (b AccountBalance) Balance() money.Amount {
+	balance, _ := b.Debits.Sub(b.Credits)
+	return balance
+}
+
+// CurrencyTotals sums all accounts of one currency
+type CurrencyTotals struct {
+	Currency string
+	Debits   money.Amount
+	Credits  money.Amount
+}
+
+// Balanced reports whether total debits equal total credits
+func (t CurrencyTotals) Balanced() bool {
+	cmp, err := t.Debits.Cmp(t.Credits)
+	return err == nil && cmp == 0
+}
+
+// TrialBalance lists every account's debits and credits with per-currency totals
+type TrialBalance struct {
+	Accounts []AccountBalance
+	Totals   []CurrencyTotals
+}
+
+// NewTrialBalance computes per-currency totals for a set of account balances
+func NewTrialBalance(accounts []AccountBalance) (*TrialBalance, error) {
+	tb := &TrialBalance{Accounts: accounts}
+
+	index := make(map[string]int)
+	for _, a := range accounts {
+		i, ok := index[a.Account.Currency]
+		if !ok {
+			zero, err := money.Zero(a.Account.Currency)
+			if err != nil {
+				return nil, err
+			}
+			index[a.Account.Currency] = len(tb.Totals)
+			tb.Totals = append(tb.Totals, CurrencyTotals{Currency: a.Account.Currency, Debits: zero, Credits: zero})
+			i = len(tb.Totals) - 1
+		}
+
+		debits, err := tb.Totals[i].Debits.Add(a.Debits)
+		if err != nil {
+			return nil, err
+		}
+		credits, err := tb.Totals[i].Credits.Add(a.Credits)
+		if err != nil {
+			return nil, err
+		}
+		tb.Totals[i].Debits, tb.Totals[i].Credits = debits, credits
+	}
+
+	return tb, nil
+}
+
+// Check returns an error naming the first currency whose debits and credits differ
+func (tb *TrialBalance) Check() error {
+	for _, t := range tb.Totals {
+		if !t.Balanced() {
+			return fmt.Errorf("%w: %s debits %s, credits %s", ErrUnbalancedEntry, t.Currency, t.Debits, t.Credits)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package lifecycle defines the payment status state machine shared by the API handlers and the database layer.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Status is the lifecycle state of a payment
+type Status string
+
+const (
+	Pending    Status = "PENDING"    // Accepted and stored, not yet handed to a settlement rail
+	Submitted  Status = "SUBMITTED"  // Handed to the settlement rail (e.g., transaction broadcast on-chain)
+	Confirming Status = "CONFIRMING" // Seen by the settlement rail, waiting for enough confirmations
+	Completed  Status = "COMPLETED"  // Settled; funds reached the receiver
+	Failed     Status = "FAILED"     // Settlement failed; no funds moved
+	Refunded   Status = "REFUNDED"   // Settled and then returned to the sender in full
+	Expired    Status = "EXPIRED"    // Never submitted before its deadline
+
+	PartiallyRefunded Status = "PARTIALLY_REFUNDED" // Settled, with part of the amount returned to the sender
+)
+
+var (
+	// ErrUnknownStatus is returned when parsing a status that is not part of the lifecycle
+	ErrUnknownStatus = errors.New("unknown payment status")
+
+	// ErrIllegalTransition is returned when a payment cannot move between two statuses
+	ErrIllegalTransition = errors.New("illegal payment status transition")
+)
+
+// transitions lists, for every status, the statuses a payment may move to next
+var transitions = map[Status][]Status{
+	Pending:    {Submitted, Failed, Expired},
+	Submitted:  {Confirming, Completed, Failed},
+	Confirming: {Completed, Failed},
+	Completed:  {PartiallyRefunded, Refunded},
+	Failed:     {},
+	Refunded:   {},
+	Expired:    {},
+
+	PartiallyRefunded: {Refunded},
+}
+
+// TransitionError describes a rejected status change
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%v: %s -> %s", ErrIllegalTransition, e.From, e.To)
+}
+
+// Unwrap lets callers match the error with errors.Is(err, ErrIllegalTransition)
+func (e *TransitionError) Unwrap() error {
+	return ErrIllegalTransition
+}
+
+// ParseStatus converts a wire value into a Status, accepting any letter case
+func ParseStatus(s string) (Status, error) {
+	status := Status(strings.ToUpper(strings.TrimSpace(s)))
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownStatus, s)
+	}
+	return status, nil
+}
+
+// IsTerminal reports whether no further transitions are possible from the status
+func (s Status) IsTerminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// CanTransition reports whether a payment may move from one status to another
+func CanTransition(from, to Status) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns a *TransitionError if the status change is not allowed
+func ValidateTransition(from, to Status) error {
+	if !CanTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+// IsRefund reports whether reaching the status requires recording a refund,
+// which only the refund flow can do
+func (s Status) IsRefund() bool {
+	return s == Refunded || s == PartiallyRefunded
+}
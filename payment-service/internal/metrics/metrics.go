@@ -0,0 +1,224 @@
+// Package metrics defines the Prometheus metrics of the payment service and serves them at /metrics.
+//
+// Metrics are registered on Registry rather than the global Prometheus registry, so the exposed
+// metrics are exactly the ones listed here plus the Go runtime, process and database pool ones.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "payments"
+
+// Registry holds every metric of the service
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RPCDuration observes every RPC by full method name and status code; the error rate is the
+	// share of observations whose code is not OK
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Time taken to handle gRPC calls, by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	// HTTPDuration observes every HTTP request by route pattern and status
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// PaymentsCreated counts accepted payments
+	PaymentsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "created_total",
+		Help:      "Payments accepted, by currency.",
+	}, []string{"currency"})
+
+	// PaymentStatusChanges counts the statuses payments move to, e.g. COMPLETED or FAILED
+	PaymentStatusChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_changes_total",
+		Help:      "Payment status changes, by new status and currency.",
+	}, []string{"status", "currency"})
+
+	// ChainEventsUnmatched counts contract events acknowledged because no payment was settled by their transaction
+	ChainEventsUnmatched = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chain_events_unmatched_total",
+		Help:      "Payment contract events for transactions no payment was settled by, acknowledged without being applied.",
+	})
+
+	// QueuePublished counts messages published to RabbitMQ
+	QueuePublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_published_total",
+		Help:      "Messages published to RabbitMQ, by queue and result (ok or error).",
+	}, []string{"queue", "result"})
+
+	// QueueConsumed counts messages received from RabbitMQ
+	QueueConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_consumed_total",
+		Help:      "Messages received from RabbitMQ, by queue.",
+	}, []string{"queue"})
+
+	// QueueLag observes how long messages waited between being published and received
+	QueueLag = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_lag_seconds",
+		Help:      "Time between publishing and receiving a RabbitMQ message, for messages carrying a timestamp.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 15, 60, 300, 900},
+	}, []string{"queue"})
+
+	// QueueRetried counts messages scheduled to be delivered again after their handling failed
+	QueueRetried = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_retried_total",
+		Help:      "Messages whose handling failed and that were scheduled for another attempt, by queue.",
+	}, []string{"queue"})
+
+	// QueueDeadLettered counts messages moved to a dead-letter queue
+	QueueDeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_dead_lettered_total",
+		Help:      "Messages moved to the dead-letter queue after their last attempt or a permanent failure, by queue.",
+	}, []string{"queue"})
+
+	// QueueDuplicates counts messages skipped because their consumer already processed them
+	QueueDuplicates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_duplicates_total",
+		Help:      "Messages delivered again after being processed, acknowledged without being applied twice, by queue.",
+	}, []string{"queue"})
+
+	// QueueMissingIDs counts messages received without an event or message ID, deduplicated by content
+	QueueMissingIDs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_missing_ids_total",
+		Help:      "Messages received without an event or message ID, deduplicated by the hash of their body, by queue.",
+	}, []string{"queue"})
+
+	// QueueReconnects counts how often the connection to RabbitMQ was re-established after being lost
+	QueueReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_reconnects_total",
+		Help:      "Times the connection to RabbitMQ was re-established after being lost.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RPCDuration,
+		HTTPDuration,
+		PaymentsCreated,
+		PaymentStatusChanges,
+		ChainEventsUnmatched,
+		QueuePublished,
+		QueueConsumed,
+		QueueLag,
+		QueueRetried,
+		QueueDeadLettered,
+		QueueDuplicates,
+		QueueMissingIDs,
+		QueueReconnects,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exports the connection pool statistics of the database (open, idle and in-use
+// connections, waits for a connection)
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterQueueDepth exports the number of messages waiting in each queue the service consumes,
+// asked from the broker whenever the metrics are scraped
+func RegisterQueueDepth(depths func() (map[string]int, error)) {
+	Registry.MustRegister(&queueDepthCollector{
+		depths: depths,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_messages"),
+			"Messages waiting in a consumed RabbitMQ queue.", []string{"queue"}, nil),
+	})
+}
+
+type queueDepthCollector struct {
+	depths func() (map[string]int, error)
+	desc   *prometheus.Desc
+}
+
+func (c *queueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	depths, err := c.depths()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for queue, n := range depths {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), queue)
+	}
+}
+
+// UnaryServerInterceptor observes the duration and outcome of unary calls
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		RPCDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor observes the duration and outcome of streaming calls
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		RPCDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Middleware observes the duration and status of HTTP requests. Requests matching no route share
+// one label, so probing random paths cannot create unbounded series.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				c.Error(err) // Writes the response, so its status is known below
+			}
+
+			route := c.Path()
+			if route == "" || c.Response().Status == http.StatusNotFound && route == "/*" {
+				route = "unmatched"
+			}
+			HTTPDuration.WithLabelValues(c.Request().Method, route, strconv.Itoa(c.Response().Status)).Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Command gen copies the money package's precision.go, its currency precision and rounding code, into
+// another package, so modules that cannot import the money package share one definition of both.
+// It is run by "go generate" in the money package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+)
+
+// source is the file copied, relative to the money package
+const source = "precision.go"
+
+// packageClause matches the package clause of the source
+var packageClause = regexp.MustCompile(`(?m)^package money$`)
+
+func main() {
+	out := flag.String("out", "", "file to write the copy to")
+	pkg := flag.String("package", "blockchain", "package of the copy")
+	flag.Parse()
+	if *out == "" {
+		log.Fatal("-out is required")
+	}
+
+	src, err := os.ReadFile(source)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", source, err)
+	}
+	if !packageClause.Match(src) {
+		log.Fatalf("No package clause found in %s", source)
+	}
+
+	var copied bytes.Buffer
+	copied.WriteString("// Code generated by payment-service/internal/money/gen from payment-service/internal/money/" + source + ". DO NOT EDIT.\n\n")
+	copied.Write(packageClause.ReplaceAll(src, []byte("package "+*pkg)))
+
+	formatted, err := format.Source(copied.Bytes())
+	if err != nil {
+		log.Fatalf("Failed to format the copy of %s: %v", source, err)
+	}
+	if err := os.WriteFile(*out, formatted, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package money represents payment amounts exactly, as integer minor units of a currency or asset.
+//
+// Rounding rules:
+//   - Amounts supplied by clients are never rounded: Parse rejects values with more
+//     fractional digits than the currency allows.
+//   - Amounts derived from others (e.g., fees) round to the currency's precision using
+//     the mode the caller passes (see FromRat).
+//   - The exponents table in precision.go is the one definition of currency precision. The
+//     blockchain module, which cannot import this package, gets a generated copy of that file.
+package money
+
+//go:generate go run ./gen -out ../../../blockchain/utils/precision_gen.go
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	// ErrInvalidAmount is returned for values that are not plain decimal numbers
+	ErrInvalidAmount = errors.New("invalid amount")
+
+	// ErrTooPrecise is returned when a value has more fractional digits than its currency allows
+	ErrTooPrecise = errors.New("amount has more decimal places than the currency allows")
+
+	// ErrCurrencyMismatch is returned when combining amounts of different currencies
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// Amount is an exact quantity of a single currency, stored in minor units (cents, satoshi, wei...)
+type Amount struct {
+	minor    *big.Int
+	currency string
+}
+
+// Parse converts a decimal string in major units (e.g., "12.34") into an Amount without rounding
+func Parse(value, currency string) (Amount, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Amount{}, err
+	}
+
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	digits := strings.TrimPrefix(value, "-")
+
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+
+	// Trailing zeros never change the value, so "1.500" is fine for a 2-digit currency
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > exp {
+		return Amount{}, fmt.Errorf("%w: %q has %d, %s allows %d", ErrTooPrecise, value, len(frac), currency, exp)
+	}
+
+	minor, ok := new(big.Int).SetString(whole+frac+strings.Repeat("0", exp-len(frac)), 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	if negative {
+		minor.Neg(minor)
+	}
+
+	return Amount{minor: minor, currency: strings.ToUpper(currency)}, nil
+}
+
+// FromMinor builds an Amount from an integer number of minor units
+func FromMinor(minor *big.Int, currency string) (Amount, error) {
+	if _, err := Exponent(currency); err != nil {
+		return Amount{}, err
+	}
+	return Amount{minor: new(big.Int).Set(minor), currency: strings.ToUpper(currency)}, nil
+}
+
+// Zero returns a zero amount of the given currency
+func Zero(currency string) (Amount, error) {
+	return FromMinor(new(big.Int), currency)
+}
+
+// Currency returns the upper-case currency or asset code
+func (a Amount) Currency() string {
+	return a.currency
+}
+
+// Minor returns a copy of the amount in minor units
+func (a Amount) Minor() *big.Int {
+	if a.minor == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(a.minor)
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the amount
+func (a Amount) Sign() int {
+	if a.minor == nil {
+		return 0
+	}
+	return a.minor.Sign()
+}
+
+// IsZero reports whether the amount is zero
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// Rat returns the amount in major units as an exact rational number
+func (a Amount) Rat() *big.Rat {
+	exp, _ := Exponent(a.currency)
+	return new(big.Rat).SetFrac(a.Minor(), pow10(exp))
+}
+
+// String formats the amount in major units with exactly the currency's precision (e.g., "12.30")
+func (a Amount) String() string {
+	exp, _ := Exponent(a.currency)
+	minor := a.Minor()
+
+	sign := ""
+	if minor.Sign() < 0 {
+		sign = "-"
+		minor.Neg(minor)
+	}
+
+	digits := minor.String()
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// Add returns a + b; both amounts must share a currency
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a.currency != b.currency {
+		return Amount{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.currency, b.currency)
+	}
+	return Amount{minor: new(big.Int).Add(a.Minor(), b.Minor()), currency: a.currency}, nil
+}
+
+// Sub returns a - b; both amounts must share a currency
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if a.currency != b.currency {
+		return Amount{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.currency, b.currency)
+	}
+	return Amount{minor: new(big.Int).Sub(a.Minor(), b.Minor()), currency: a.currency}, nil
+}
+
+// Cmp compares a and b, returning -1, 0 or +1; both amounts must share a currency
+func (a Amount) Cmp(b Amount) (int, error) {
+	if a.currency != b.currency {
+		return 0, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.currency, b.currency)
+	}
+	return a.Minor().Cmp(b.Minor()), nil
+}
+
+// Neg returns -a
+func (a Amount) Neg() Amount {
+	return Amount{minor: new(big.Int).Neg(a.Minor()), currency: a.currency}
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
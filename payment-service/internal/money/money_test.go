@@ -0,0 +1,64 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		value, currency string
+		want            string // String of the parsed amount
+	}{
+		{value: "12.34", currency: "USD", want: "12.34"},
+		{value: "12.3", currency: "usd", want: "12.30"},
+		{value: "12.300", currency: "EUR", want: "12.30"},
+		{value: "0.05", currency: "USD", want: "0.05"},
+		{value: ".5", currency: "USD", want: "0.50"},
+		{value: "-7.01", currency: "USD", want: "-7.01"},
+		{value: "1500", currency: "JPY", want: "1500"},
+		{value: "1.234", currency: "BHD", want: "1.234"},
+		{value: "0.000000000000000001", currency: "ETH", want: "0.000000000000000001"},
+	}
+
+	for _, tt := range tests {
+		a, err := Parse(tt.value, tt.currency)
+		if err != nil {
+			t.Fatalf("Parse(%q, %s): %v", tt.value, tt.currency, err)
+		}
+		if got := a.String(); got != tt.want {
+			t.Errorf("Parse(%q, %s).String() = %q, want %q", tt.value, tt.currency, got, tt.want)
+		}
+
+		// Parsing the formatted amount gives the same amount back
+		again, err := Parse(a.String(), a.Currency())
+		if err != nil {
+			t.Fatalf("Parse(%q, %s): %v", a.String(), a.Currency(), err)
+		}
+		if cmp, _ := again.Cmp(a); cmp != 0 {
+			t.Errorf("%s did not survive a round trip, got %s", a, again)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		value, currency string
+		want            error
+	}{
+		{value: "12.345", currency: "USD", want: ErrTooPrecise},
+		{value: "1500.5", currency: "JPY", want: ErrTooPrecise},
+		{value: "1.2345", currency: "BHD", want: ErrTooPrecise},
+		{value: "0.0000000000000000001", currency: "ETH", want: ErrTooPrecise},
+		{value: "", currency: "USD", want: ErrInvalidAmount},
+		{value: "1e3", currency: "USD", want: ErrInvalidAmount},
+		{value: "1,000", currency: "USD", want: ErrInvalidAmount},
+		{value: "10", currency: "XYZ", want: ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(tt.value, tt.currency); !errors.Is(err, tt.want) {
+			t.Errorf("Parse(%q, %s) = %v, want %v", tt.value, tt.currency, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Currency precision and rounding, shared with the blockchain module: "go generate" copies this file
+// there, so it must only use the standard library and declare nothing else the copy could clash with.
+
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrUnknownCurrency is returned for currency or asset codes we have no precision for
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// exponents holds the number of minor-unit digits for each supported ISO 4217 currency and crypto asset
+var exponents = map[string]int{
+	// Fiat currencies (ISO 4217)
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"INR": 2,
+	"CAD": 2,
+	"AUD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"SGD": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+	// Crypto assets
+	"BTC":  8,
+	"ETH":  18,
+	"USDC": 6,
+	"USDT": 6,
+}
+
+// Exponent returns the number of minor-unit digits for a currency code (e.g., 2 for USD, 18 for ETH)
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[strings.ToUpper(currency)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return exp, nil
+}
+
+// RoundingMode selects how a value that falls between two minor units is resolved
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest minor unit, ties to the even one (banker's rounding)
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest minor unit, ties away from zero
+	RoundHalfUp
+	// RoundDown truncates towards zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+)
+
+// round resolves a rational number to an integer using the rounding mode
+func round(r *big.Rat, mode RoundingMode) *big.Int {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		// Compare twice the remainder with the denominator to locate the midpoint
+		half := new(big.Int).Lsh(rem, 1).Cmp(den)
+		switch mode {
+		case RoundUp:
+			quo.Add(quo, big.NewInt(1))
+		case RoundHalfUp:
+			if half >= 0 {
+				quo.Add(quo, big.NewInt(1))
+			}
+		case RoundHalfEven:
+			if half > 0 || half == 0 && quo.Bit(0) == 1 {
+				quo.Add(quo, big.NewInt(1))
+			}
+		case RoundDown:
+			// Truncation is what QuoRem already did
+		}
+	}
+
+	if r.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	return quo
+}
@@ -0,0 +1,17 @@
+package money
+
+import (
+	"math/big"
+	"strings"
+)
+
+// FromRat rounds an exact value in major units to the currency's precision
+func FromRat(value *big.Rat, currency string, mode RoundingMode) (Amount, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Amount{}, err
+	}
+
+	scaled := new(big.Rat).Mul(value, new(big.Rat).SetInt(pow10(exp)))
+	return Amount{minor: round(scaled, mode), currency: strings.ToUpper(currency)}, nil
+}
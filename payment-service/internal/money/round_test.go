@@ -0,0 +1,71 @@
+package money
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFromRatRoundingModes(t *testing.T) {
+	// Each value is in major units of USD, so rounding happens at the third decimal place
+	tests := []struct {
+		value                          string
+		halfEven, halfUp, down, upward string
+	}{
+		{value: "1.005", halfEven: "1.00", halfUp: "1.01", down: "1.00", upward: "1.01"},
+		{value: "1.015", halfEven: "1.02", halfUp: "1.02", down: "1.01", upward: "1.02"},
+		{value: "1.004", halfEven: "1.00", halfUp: "1.00", down: "1.00", upward: "1.01"},
+		{value: "1.006", halfEven: "1.01", halfUp: "1.01", down: "1.00", upward: "1.01"},
+		{value: "1.01", halfEven: "1.01", halfUp: "1.01", down: "1.01", upward: "1.01"},
+		{value: "-1.005", halfEven: "-1.00", halfUp: "-1.01", down: "-1.00", upward: "-1.01"},
+		{value: "-1.015", halfEven: "-1.02", halfUp: "-1.02", down: "-1.01", upward: "-1.02"},
+		{value: "-1.004", halfEven: "-1.00", halfUp: "-1.00", down: "-1.00", upward: "-1.01"},
+		{value: "1/3", halfEven: "0.33", halfUp: "0.33", down: "0.33", upward: "0.34"},
+		{value: "2/3", halfEven: "0.67", halfUp: "0.67", down: "0.66", upward: "0.67"},
+	}
+
+	for _, tt := range tests {
+		value, ok := new(big.Rat).SetString(tt.value)
+		if !ok {
+			t.Fatalf("bad test value %q", tt.value)
+		}
+		for mode, want := range map[RoundingMode]string{
+			RoundHalfEven: tt.halfEven,
+			RoundHalfUp:   tt.halfUp,
+			RoundDown:     tt.down,
+			RoundUp:       tt.upward,
+		} {
+			a, err := FromRat(value, "USD", mode)
+			if err != nil {
+				t.Fatalf("FromRat(%s): %v", tt.value, err)
+			}
+			if got := a.String(); got != want {
+				t.Errorf("FromRat(%s, mode %d) = %s, want %s", tt.value, mode, got, want)
+			}
+		}
+	}
+}
+
+func TestFromRatUsesCurrencyPrecision(t *testing.T) {
+	value := big.NewRat(12345, 1000) // 12.345
+	tests := []struct {
+		currency, want string
+	}{
+		{currency: "JPY", want: "12"},
+		{currency: "USD", want: "12.34"},
+		{currency: "BHD", want: "12.345"},
+	}
+
+	for _, tt := range tests {
+		a, err := FromRat(value, tt.currency, RoundHalfEven)
+		if err != nil {
+			t.Fatalf("FromRat(%s): %v", tt.currency, err)
+		}
+		if got := a.String(); got != tt.want {
+			t.Errorf("FromRat(12.345, %s) = %s, want %s", tt.currency, got, tt.want)
+		}
+	}
+
+	if _, err := FromRat(value, "XYZ", RoundHalfEven); err == nil {
+		t.Error("FromRat accepted an unknown currency")
+	}
+}
@@ -0,0 +1,100 @@
+// Package outbox relays events stored in the outbox table to the message bus.
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Go-payments/bus"
+	"github.com/Go-payments/internal/db"
+	"github.com/Go-payments/internal/tracing"
+)
+
+// Store holds the outbox messages to relay
+type Store interface {
+	RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func(db.OutboxMessage) error, backoff func(attempts int) time.Duration) (int, error)
+}
+
+// Relay periodically publishes pending outbox messages. A message is only marked sent after the
+// bus accepted it, so every committed event is delivered at least once.
+type Relay struct {
+	DB         Store
+	Publisher  bus.Publisher
+	Interval   time.Duration // How often to poll when the outbox is empty
+	BatchSize  int           // Maximum number of messages claimed at a time
+	Lease      time.Duration // How long claimed messages are kept from other relays; must outlast publishing a batch
+	MinBackoff time.Duration // Delay before the first retry of a failed message
+	MaxBackoff time.Duration // Upper bound for the exponential retry delay
+}
+
+// NewRelay creates a Relay with default polling and retry settings
+func NewRelay(database Store, publisher bus.Publisher) *Relay {
+	return &Relay{
+		DB:         database,
+		Publisher:  publisher,
+		Interval:   time.Second,
+		BatchSize:  100,
+		Lease:      10 * time.Minute,
+		MinBackoff: time.Second,
+		MaxBackoff: 5 * time.Minute,
+	}
+}
+
+// Run publishes outbox messages until the context is canceled
+func (r *Relay) Run(ctx context.Context) {
+	log.Println("Outbox relay started")
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	// A batch in progress when shutdown begins is finished rather than rolled back
+	batchCtx := context.WithoutCancel(ctx)
+	publish := func(msg db.OutboxMessage) error {
+		return r.publish(batchCtx, msg)
+	}
+
+	for {
+		// Drain the outbox before waiting for the next tick
+		for {
+			published, err := r.DB.RelayOutbox(batchCtx, r.BatchSize, r.Lease, publish, r.backoff)
+			if err != nil {
+				log.Printf("Error relaying outbox messages: %v", err)
+				break
+			}
+			if published < r.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish sends a single outbox message to its queue, continuing the trace of the request that wrote it
+func (r *Relay) publish(ctx context.Context, msg db.OutboxMessage) error {
+	ctx = tracing.Extract(ctx, msg.TraceContext)
+	err := r.Publisher.Publish(ctx, msg.Queue, bus.Message{ContentType: msg.ContentType, Body: msg.Body})
+	if err != nil {
+		log.Printf("Failed to publish outbox message %d to %s (attempt %d): %v", msg.ID, msg.Queue, msg.Attempts+1, err)
+		return err
+	}
+	return nil
+}
+
+// backoff doubles the retry delay with every attempt, capped at MaxBackoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.MinBackoff
+	for i := 1; i < attempts && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+	return delay
+}
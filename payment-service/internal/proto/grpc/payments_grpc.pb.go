@@ -22,18 +22,30 @@ const (
 	PaymentService_MakePayment_FullMethodName         = "/payment.PaymentService/MakePayment"
 	PaymentService_GetPaymentStatus_FullMethodName    = "/payment.PaymentService/GetPaymentStatus"
 	PaymentService_UpdatePaymentStatus_FullMethodName = "/payment.PaymentService/UpdatePaymentStatus"
+	PaymentService_RefundPayment_FullMethodName       = "/payment.PaymentService/RefundPayment"
+	PaymentService_ListPayments_FullMethodName        = "/payment.PaymentService/ListPayments"
+	PaymentService_WatchPayment_FullMethodName        = "/payment.PaymentService/WatchPayment"
 )
 
 // PaymentServiceClient is the client API for PaymentService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Every call must carry an "authorization: Bearer <token>" metadata entry with a token issued by user-authentication,
+// and the token must grant the permission noted on the RPC
 type PaymentServiceClient interface {
-	// Makes a payment and returns the transaction details
+	// Makes a payment and returns the transaction details (payments:create)
 	MakePayment(ctx context.Context, in *PaymentRequest, opts ...grpc.CallOption) (*PaymentResponse, error)
-	// Gets the payment status for a transaction
+	// Gets the payment status for a transaction (payments:read)
 	GetPaymentStatus(ctx context.Context, in *PaymentStatusRequest, opts ...grpc.CallOption) (*PaymentStatusResponse, error)
-	// Updates the payment status (e.g., from pending to completed)
+	// Updates the payment status; only transitions allowed by the payment lifecycle are accepted (payments:status:update)
 	UpdatePaymentStatus(ctx context.Context, in *PaymentUpdateRequest, opts ...grpc.CallOption) (*PaymentUpdateResponse, error)
+	// Refunds a completed payment in full or in part; may be called repeatedly until fully refunded (payments:refund)
+	RefundPayment(ctx context.Context, in *RefundRequest, opts ...grpc.CallOption) (*RefundResponse, error)
+	// Lists the payments the caller sent or received, newest first, one page at a time (payments:read)
+	ListPayments(ctx context.Context, in *ListPaymentsRequest, opts ...grpc.CallOption) (*ListPaymentsResponse, error)
+	// Streams the payment's current status followed by every status change, until it reaches a final status (payments:read)
+	WatchPayment(ctx context.Context, in *WatchPaymentRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PaymentStatusEvent], error)
 }
 
 type paymentServiceClient struct {
@@ -74,16 +86,64 @@ func (c *paymentServiceClient) UpdatePaymentStatus(ctx context.Context, in *Paym
 	return out, nil
 }
 
+func (c *paymentServiceClient) RefundPayment(ctx context.Context, in *RefundRequest, opts ...grpc.CallOption) (*RefundResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RefundResponse)
+	err := c.cc.Invoke(ctx, PaymentService_RefundPayment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) ListPayments(ctx context.Context, in *ListPaymentsRequest, opts ...grpc.CallOption) (*ListPaymentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPaymentsResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ListPayments_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) WatchPayment(ctx context.Context, in *WatchPaymentRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PaymentStatusEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PaymentService_ServiceDesc.Streams[0], PaymentService_WatchPayment_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchPaymentRequest, PaymentStatusEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PaymentService_WatchPaymentClient = grpc.ServerStreamingClient[PaymentStatusEvent]
+
 // PaymentServiceServer is the server API for PaymentService service.
 // All implementations must embed UnimplementedPaymentServiceServer
 // for forward compatibility.
+//
+// Every call must carry an "authorization: Bearer <token>" metadata entry with a token issued by user-authentication,
+// and the token must grant the permission noted on the RPC
 type PaymentServiceServer interface {
-	// Makes a payment and returns the transaction details
+	// Makes a payment and returns the transaction details (payments:create)
 	MakePayment(context.Context, *PaymentRequest) (*PaymentResponse, error)
-	// Gets the payment status for a transaction
+	// Gets the payment status for a transaction (payments:read)
 	GetPaymentStatus(context.Context, *PaymentStatusRequest) (*PaymentStatusResponse, error)
-	// Updates the payment status (e.g., from pending to completed)
+	// Updates the payment status; only transitions allowed by the payment lifecycle are accepted (payments:status:update)
 	UpdatePaymentStatus(context.Context, *PaymentUpdateRequest) (*PaymentUpdateResponse, error)
+	// Refunds a completed payment in full or in part; may be called repeatedly until fully refunded (payments:refund)
+	RefundPayment(context.Context, *RefundRequest) (*RefundResponse, error)
+	// Lists the payments the caller sent or received, newest first, one page at a time (payments:read)
+	ListPayments(context.Context, *ListPaymentsRequest) (*ListPaymentsResponse, error)
+	// Streams the payment's current status followed by every status change, until it reaches a final status (payments:read)
+	WatchPayment(*WatchPaymentRequest, grpc.ServerStreamingServer[PaymentStatusEvent]) error
 	mustEmbedUnimplementedPaymentServiceServer()
 }
 
@@ -103,6 +163,15 @@ func (UnimplementedPaymentServiceServer) GetPaymentStatus(context.Context, *Paym
 func (UnimplementedPaymentServiceServer) UpdatePaymentStatus(context.Context, *PaymentUpdateRequest) (*PaymentUpdateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdatePaymentStatus not implemented")
 }
+func (UnimplementedPaymentServiceServer) RefundPayment(context.Context, *RefundRequest) (*RefundResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RefundPayment not implemented")
+}
+func (UnimplementedPaymentServiceServer) ListPayments(context.Context, *ListPaymentsRequest) (*ListPaymentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPayments not implemented")
+}
+func (UnimplementedPaymentServiceServer) WatchPayment(*WatchPaymentRequest, grpc.ServerStreamingServer[PaymentStatusEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchPayment not implemented")
+}
 func (UnimplementedPaymentServiceServer) mustEmbedUnimplementedPaymentServiceServer() {}
 func (UnimplementedPaymentServiceServer) testEmbeddedByValue()                        {}
 
@@ -178,6 +247,53 @@ func _PaymentService_UpdatePaymentStatus_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PaymentService_RefundPayment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefundRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).RefundPayment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_RefundPayment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).RefundPayment(ctx, req.(*RefundRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_ListPayments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPaymentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).ListPayments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_ListPayments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).ListPayments(ctx, req.(*ListPaymentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_WatchPayment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchPaymentRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PaymentServiceServer).WatchPayment(m, &grpc.GenericServerStream[WatchPaymentRequest, PaymentStatusEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PaymentService_WatchPaymentServer = grpc.ServerStreamingServer[PaymentStatusEvent]
+
 // PaymentService_ServiceDesc is the grpc.ServiceDesc for PaymentService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -197,7 +313,21 @@ var PaymentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdatePaymentStatus",
 			Handler:    _PaymentService_UpdatePaymentStatus_Handler,
 		},
+		{
+			MethodName: "RefundPayment",
+			Handler:    _PaymentService_RefundPayment_Handler,
+		},
+		{
+			MethodName: "ListPayments",
+			Handler:    _PaymentService_ListPayments_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPayment",
+			Handler:       _PaymentService_WatchPayment_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "internal/api/grpc/payments.proto",
 }
@@ -0,0 +1,203 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Go-payments/bus"
+	"github.com/Go-payments/internal/metrics"
+	"github.com/Go-payments/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// consumerSeq numbers the consumers of this process so each gets a unique tag
+var consumerSeq atomic.Int64
+
+// Subscribe calls handle for the messages of a queue until ctx is canceled, continuing the trace each
+// message was published in, and settles each message by its outcome (see settle). Up to the prefetch
+// count are delivered ahead of handling. The queue's retry and dead-letter queues are declared
+// alongside it. If the connection or the consumer's channel is lost, consuming resumes once it can be
+// re-established, and the broker redelivers the messages that were not yet settled. When ctx is
+// canceled, the consumer is canceled on the broker, and Subscribe returns once the messages already
+// delivered are handled.
+func (c *Connection) Subscribe(ctx context.Context, queueName string, handle bus.Handler) error {
+	msgs, err := c.consume(ctx, queueName)
+	if err != nil {
+		return err
+	}
+
+	// Each message is handled to the end even if shutdown begins meanwhile
+	for msg := range msgs {
+		msgCtx, span := startConsumerSpan(context.WithoutCancel(ctx), queueName, msg)
+		err := handle(msgCtx, bus.Message{
+			ID:          msg.MessageId,
+			ContentType: msg.ContentType,
+			Body:        msg.Body,
+			PublishedAt: msg.Timestamp,
+		})
+		span.End()
+		c.settle(msgCtx, queueName, msg, err)
+	}
+	return nil
+}
+
+// consume starts consuming a queue; the returned channel is closed once ctx is canceled and the
+// messages already delivered are drained. Every message must be settled once handled.
+func (c *Connection) consume(ctx context.Context, queueName string) (<-chan amqp.Delivery, error) {
+	consumer := &consumer{
+		conn:  c,
+		queue: queueName,
+		tag:   fmt.Sprintf("payments-%s-%d", queueName, consumerSeq.Add(1)),
+	}
+	msgs, err := consumer.subscribe()
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop deliveries on shutdown; waiting for the broker's confirmation lets in-flight deliveries through
+	go func() {
+		<-ctx.Done()
+		consumer.cancel()
+	}()
+
+	c.mu.Lock()
+	c.consumed[queueName] = true
+	c.mu.Unlock()
+
+	// Count the deliveries and how long they waited in the queue on their way to the caller
+	out := make(chan amqp.Delivery)
+	go func() {
+		defer close(out)
+		for {
+			for msg := range msgs {
+				metrics.QueueConsumed.WithLabelValues(queueName).Inc()
+				if !msg.Timestamp.IsZero() {
+					metrics.QueueLag.WithLabelValues(queueName).Observe(time.Since(msg.Timestamp).Seconds())
+				}
+				out <- msg
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("Consumer %s lost its channel, resubscribing", consumer.tag)
+			if msgs = consumer.resubscribe(ctx); msgs == nil {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// consumer is one subscription to a queue, which moves to a new channel when its channel is lost
+type consumer struct {
+	conn  *Connection
+	queue string
+	tag   string // Consumer tag, needed to cancel the consumer
+
+	mu       sync.Mutex
+	ch       *amqp.Channel // Channel the consumer currently receives on
+	canceled bool          // Set once ctx is canceled; no new subscription is made after
+}
+
+// subscribe opens a channel limited to the prefetch count and starts consuming the queue on it
+func (cs *consumer) subscribe() (<-chan amqp.Delivery, error) {
+	ch, err := cs.conn.channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Qos(cs.conn.opts.Prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to set prefetch count: %v", err)
+	}
+	if err := declareQueue(ch, cs.queue); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if err := cs.conn.declareRetryQueues(ch, cs.queue); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.canceled {
+		ch.Close()
+		return nil, context.Canceled
+	}
+
+	msgs, err := ch.Consume(
+		cs.queue, // Queue name
+		cs.tag,   // Consumer name, needed to cancel the consumer
+		false,    // Messages are settled by settle once handled
+		false,    // Don't use exclusive access to the queue
+		false,    // No-local (not supported by RabbitMQ)
+		false,    // No wait for delivery
+		nil,      // No additional arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to start consuming messages: %v", err)
+	}
+	cs.ch = ch
+	return msgs, nil
+}
+
+// resubscribe subscribes again, retrying with backoff while the connection is being re-established.
+// It returns nil once ctx is canceled.
+func (cs *consumer) resubscribe(ctx context.Context) <-chan amqp.Delivery {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		msgs, err := cs.subscribe()
+		if err == nil {
+			log.Printf("Consumer %s resubscribed to %s", cs.tag, cs.queue)
+			return msgs
+		}
+		log.Printf("Failed to resubscribe consumer %s, retrying in %s: %v", cs.tag, delay, err)
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
+
+// cancel stops deliveries to the consumer. Its channel stays open so the messages already delivered
+// can still be settled; it is closed with the connection.
+func (cs *consumer) cancel() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.canceled = true
+	if cs.ch == nil {
+		return
+	}
+	if err := cs.ch.Cancel(cs.tag, false); err != nil && !cs.conn.isClosed() {
+		log.Printf("Failed to cancel consumer %s: %v", cs.tag, err)
+	}
+}
+
+// startConsumerSpan returns ctx continuing the trace the message was published in, with a span for
+// processing it; the caller ends the span once the message is handled
+func startConsumerSpan(ctx context.Context, queueName string, msg amqp.Delivery) (context.Context, trace.Span) {
+	carrier := map[string]string{}
+	for key, value := range msg.Headers {
+		if s, ok := value.(string); ok {
+			carrier[key] = s
+		}
+	}
+	return tracing.Start(tracing.Extract(ctx, carrier), "process "+queueName, trace.SpanKindConsumer,
+		semconv.MessagingSystemRabbitmq,
+		semconv.MessagingOperationTypeDeliver,
+		semconv.MessagingDestinationName(queueName),
+	)
+}
@@ -0,0 +1,161 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Go-payments/bus"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetter is a message waiting in a dead-letter queue
+type DeadLetter struct {
+	MessageID      string
+	ContentType    string
+	Body           []byte
+	Attempts       int       // Times handling the message failed
+	LastError      string    // Why the last attempt failed
+	PublishedAt    time.Time // When the message was first published, if known
+	DeadLetteredAt time.Time // When the message was moved to the dead-letter queue, if known
+}
+
+func newDeadLetter(msg amqp.Delivery) DeadLetter {
+	lastError, _ := msg.Headers[bus.LastErrorHeader].(string)
+	deadLetteredAt, _ := msg.Headers[bus.DeadLetteredAtHeader].(time.Time)
+	return DeadLetter{
+		MessageID:      msg.MessageId,
+		ContentType:    msg.ContentType,
+		Body:           msg.Body,
+		Attempts:       bus.Attempts(msg.Headers),
+		LastError:      lastError,
+		PublishedAt:    msg.Timestamp,
+		DeadLetteredAt: deadLetteredAt,
+	}
+}
+
+// adminChannel opens a channel for inspecting the dead-letter queue of queueName, declaring the queue
+// in case nothing was dead-lettered yet
+func (c *Connection) adminChannel(queueName string) (*amqp.Channel, error) {
+	ch, err := c.channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := declareQueue(ch, bus.DeadLetterQueue(queueName)); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// deadLetterCount returns the number of messages dead-lettered from queueName, at most limit unless
+// limit is 0
+func deadLetterCount(ch *amqp.Channel, queueName string, limit int) (int, error) {
+	q, err := ch.QueueInspect(bus.DeadLetterQueue(queueName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect queue %s: %v", bus.DeadLetterQueue(queueName), err)
+	}
+	if limit > 0 && limit < q.Messages {
+		return limit, nil
+	}
+	return q.Messages, nil
+}
+
+// DeadLetters returns up to limit of the messages dead-lettered from queueName, oldest first, without
+// removing them; a limit of 0 returns all of them
+func (c *Connection) DeadLetters(queueName string, limit int) ([]DeadLetter, error) {
+	ch, err := c.adminChannel(queueName)
+	if err != nil {
+		return nil, err
+	}
+	// Closing the channel returns the messages taken below to the queue
+	defer ch.Close()
+
+	count, err := deadLetterCount(ch, queueName, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, count)
+	for len(letters) < count {
+		msg, ok, err := ch.Get(bus.DeadLetterQueue(queueName), false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read queue %s: %v", bus.DeadLetterQueue(queueName), err)
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, newDeadLetter(msg))
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters moves up to limit of the messages dead-lettered from queueName back to it, oldest
+// first, with their attempts reset; a limit of 0 replays all of them. Messages dead-lettered again
+// while replaying are left for the next replay. It returns how many were moved.
+func (c *Connection) ReplayDeadLetters(ctx context.Context, queueName string, limit int) (int, error) {
+	ch, err := c.adminChannel(queueName)
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	count, err := deadLetterCount(ch, queueName, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for replayed < count {
+		msg, ok, err := ch.Get(bus.DeadLetterQueue(queueName), false)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read queue %s: %v", bus.DeadLetterQueue(queueName), err)
+		}
+		if !ok {
+			break
+		}
+
+		headers := amqp.Table{}
+		for key, value := range msg.Headers {
+			headers[key] = value
+		}
+		delete(headers, bus.AttemptsHeader)
+		delete(headers, bus.LastErrorHeader)
+		delete(headers, bus.DeadLetteredAtHeader)
+
+		err = c.publish(ctx, queueName, true, amqp.Publishing{
+			Headers:       headers,
+			ContentType:   msg.ContentType,
+			DeliveryMode:  amqp.Persistent,
+			CorrelationId: msg.CorrelationId,
+			MessageId:     msg.MessageId,
+			Timestamp:     msg.Timestamp,
+			Type:          msg.Type,
+			Body:          msg.Body,
+		})
+		if err != nil {
+			msg.Nack(false, true)
+			return replayed, fmt.Errorf("failed to replay message to %s: %v", queueName, err)
+		}
+		if err := msg.Ack(false); err != nil {
+			return replayed, fmt.Errorf("replayed a message to %s but failed to remove it from %s: %v", queueName, bus.DeadLetterQueue(queueName), err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// PurgeDeadLetters deletes every message dead-lettered from queueName and returns how many there were
+func (c *Connection) PurgeDeadLetters(queueName string) (int, error) {
+	ch, err := c.adminChannel(queueName)
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	purged, err := ch.QueuePurge(bus.DeadLetterQueue(queueName), false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge queue %s: %v", bus.DeadLetterQueue(queueName), err)
+	}
+	return purged, nil
+}
@@ -0,0 +1,207 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Go-payments/bus"
+	"github.com/Go-payments/internal/metrics"
+	"github.com/Go-payments/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Publish sends a message to a RabbitMQ queue as a persistent message and returns once the broker has
+// confirmed it, so a nil error means the message is safe with the broker. It fails if no confirmation
+// comes within the confirm timeout; the message may then still have been taken, so a caller retrying
+// it may publish it twice. The trace context of ctx travels in the message headers, so consumers
+// continue the trace.
+func (c *Connection) Publish(ctx context.Context, queueName string, msg bus.Message) (err error) {
+	ctx, span := tracing.Start(ctx, "publish "+queueName, trace.SpanKindProducer,
+		semconv.MessagingSystemRabbitmq,
+		semconv.MessagingOperationTypePublish,
+		semconv.MessagingDestinationName(queueName),
+	)
+	defer func() { tracing.End(span, err) }()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		metrics.QueuePublished.WithLabelValues(queueName, result).Inc()
+	}()
+
+	return c.publish(ctx, queueName, true, amqp.Publishing{
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.ID,
+		Timestamp:    time.Now(), // Lets consumers measure how long the message waited
+		Headers:      traceHeaders(ctx),
+		Body:         msg.Body,
+	})
+}
+
+// publish publishes msg to a queue, declaring the queue first if declare is set, and waits for the
+// broker's confirmation
+func (c *Connection) publish(ctx context.Context, queueName string, declare bool, msg amqp.Publishing) error {
+	publisher, err := c.confirmChannel()
+	if err != nil {
+		return err
+	}
+	confirmed, err := publisher.publish(ctx, queueName, declare, msg)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(c.opts.ConfirmTimeout)
+	defer timeout.Stop()
+	select {
+	case ack, ok := <-confirmed:
+		if !ok {
+			return errors.New("channel closed before the broker confirmed the message")
+		}
+		if !ack {
+			return errors.New("broker rejected the message")
+		}
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("broker did not confirm the message within %s", c.opts.ConfirmTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// traceHeaders returns the trace context of ctx as AMQP message headers
+func traceHeaders(ctx context.Context) amqp.Table {
+	headers := amqp.Table{}
+	for key, value := range tracing.Inject(ctx) {
+		headers[key] = value
+	}
+	return headers
+}
+
+// confirmChannel returns the channel messages are published on, opening it on the current connection
+// if there is none yet or the previous one was closed
+func (c *Connection) confirmChannel() (*confirmChannel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.publisher != nil && !c.publisher.isClosed() {
+		return c.publisher, nil
+	}
+	if c.conn.IsClosed() {
+		return nil, errNotConnected
+	}
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	publisher, err := newConfirmChannel(ch)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	c.publisher = publisher
+	return publisher, nil
+}
+
+// confirmChannel is a channel in confirm mode, which hands every publisher the broker's confirmation
+// of its own message
+type confirmChannel struct {
+	ch *amqp.Channel
+
+	publishMu sync.Mutex      // Serializes publishes, so delivery tags are known
+	nextTag   uint64          // Delivery tag of the next message published
+	declared  map[string]bool // Queues already declared on this channel
+
+	pendingMu sync.Mutex
+	pending   map[uint64]chan bool // Waiting publishers by delivery tag; nil once the channel is closed
+}
+
+func newConfirmChannel(ch *amqp.Channel) (*confirmChannel, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to put the channel in confirm mode: %v", err)
+	}
+	cc := &confirmChannel{
+		ch:       ch,
+		nextTag:  1,
+		declared: map[string]bool{},
+		pending:  map[uint64]chan bool{},
+	}
+	go cc.dispatch(ch.NotifyPublish(make(chan amqp.Confirmation, 64)))
+	return cc, nil
+}
+
+// dispatch passes each confirmation to the publisher waiting for it. Once the channel is closed, the
+// publishers still waiting are told their message was not confirmed.
+func (cc *confirmChannel) dispatch(confirmations chan amqp.Confirmation) {
+	for confirmation := range confirmations {
+		cc.pendingMu.Lock()
+		waiter := cc.pending[confirmation.DeliveryTag]
+		delete(cc.pending, confirmation.DeliveryTag)
+		cc.pendingMu.Unlock()
+
+		if waiter != nil {
+			waiter <- confirmation.Ack
+		}
+	}
+
+	cc.pendingMu.Lock()
+	for _, waiter := range cc.pending {
+		close(waiter)
+	}
+	cc.pending = nil
+	cc.pendingMu.Unlock()
+}
+
+func (cc *confirmChannel) isClosed() bool {
+	cc.pendingMu.Lock()
+	defer cc.pendingMu.Unlock()
+	return cc.pending == nil
+}
+
+// publish publishes msg to a queue, first declaring the queue if declare is set and it was not
+// declared on this channel yet. The returned channel receives whether the broker took the message, or
+// is closed if the channel closes before the broker answers.
+func (cc *confirmChannel) publish(ctx context.Context, queueName string, declare bool, msg amqp.Publishing) (<-chan bool, error) {
+	cc.publishMu.Lock()
+	defer cc.publishMu.Unlock()
+
+	if declare && !cc.declared[queueName] {
+		if err := declareQueue(cc.ch, queueName); err != nil {
+			return nil, err
+		}
+		cc.declared[queueName] = true
+	}
+
+	// Register before publishing, since the confirmation may arrive before Publish returns
+	tag := cc.nextTag
+	confirmed := make(chan bool, 1) // Buffered, so dispatch never waits for a publisher that gave up
+	cc.pendingMu.Lock()
+	if cc.pending == nil {
+		cc.pendingMu.Unlock()
+		return nil, errors.New("channel closed")
+	}
+	cc.pending[tag] = confirmed
+	cc.pendingMu.Unlock()
+
+	err := cc.ch.PublishWithContext(ctx,
+		"",        // Default exchange
+		queueName, // Routing key (queue name)
+		false,     // Not mandatory: the queue is declared before publishing
+		false,     // Not immediate
+		msg,
+	)
+	if err != nil {
+		cc.pendingMu.Lock()
+		delete(cc.pending, tag)
+		cc.pendingMu.Unlock()
+		return nil, fmt.Errorf("failed to publish message: %v", err)
+	}
+	cc.nextTag++
+	return confirmed, nil
+}
@@ -0,0 +1,94 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Go-payments/bus"
+	"github.com/Go-payments/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// retryDelay is how long a message waits before its next delivery after failing attempts times. It
+// doubles with every attempt.
+func (c *Connection) retryDelay(attempts int) time.Duration {
+	return bus.RetryDelay(c.opts.RetryDelay, attempts)
+}
+
+// declareRetryQueues declares the dead-letter queue of queueName and one retry queue per delay. A retry
+// queue has no consumer: its messages expire after the delay and are dead-lettered back to queueName.
+func (c *Connection) declareRetryQueues(ch *amqp.Channel, queueName string) error {
+	if err := declareQueue(ch, bus.DeadLetterQueue(queueName)); err != nil {
+		return err
+	}
+	for attempts := 1; attempts < c.opts.MaxAttempts; attempts++ {
+		delay := c.retryDelay(attempts)
+		name := bus.RetryQueue(queueName, delay)
+		_, err := ch.QueueDeclare(name, true, false, false, false, amqp.Table(bus.RetryQueueArguments(queueName, delay)))
+		if err != nil {
+			return fmt.Errorf("failed to declare queue %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// settle acknowledges a message received from queueName once it is handled. If handling failed with
+// err, the message is moved to a retry queue, from which it is delivered again after a delay that
+// doubles with every attempt, or to the dead-letter queue once the attempts are used up or err is
+// permanent. If that move fails, the message is returned to queueName to be delivered again right away.
+func (c *Connection) settle(ctx context.Context, queueName string, msg amqp.Delivery, err error) {
+	if err == nil {
+		if ackErr := msg.Ack(false); ackErr != nil {
+			// The channel was lost; the broker delivers the message again
+			log.Printf("Failed to acknowledge message %d from %s: %v", msg.DeliveryTag, queueName, ackErr)
+		}
+		return
+	}
+
+	failed := bus.Attempts(msg.Headers) + 1
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	headers[bus.AttemptsHeader] = int32(failed)
+	headers[bus.LastErrorHeader] = err.Error()
+
+	target := bus.DeadLetterQueue(queueName)
+	if !bus.IsPermanent(err) && failed < c.opts.MaxAttempts {
+		target = bus.RetryQueue(queueName, c.retryDelay(failed))
+	} else {
+		headers[bus.DeadLetteredAtHeader] = time.Now().UTC()
+	}
+
+	moveErr := c.publish(ctx, target, false, amqp.Publishing{
+		Headers:       headers,
+		ContentType:   msg.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Timestamp:     msg.Timestamp,
+		Type:          msg.Type,
+		Body:          msg.Body,
+	})
+	if moveErr != nil {
+		log.Printf("Failed to move message %d from %s to %s, requeuing it: %v", msg.DeliveryTag, queueName, target, moveErr)
+		if nackErr := msg.Nack(false, true); nackErr != nil {
+			log.Printf("Failed to requeue message %d from %s: %v", msg.DeliveryTag, queueName, nackErr)
+		}
+		return
+	}
+
+	if target == bus.DeadLetterQueue(queueName) {
+		metrics.QueueDeadLettered.WithLabelValues(queueName).Inc()
+		log.Printf("Dead-lettered message from %s after %d attempts: %v", queueName, failed, err)
+	} else {
+		metrics.QueueRetried.WithLabelValues(queueName).Inc()
+		log.Printf("Retrying message from %s in %s (attempt %d of %d): %v", queueName, c.retryDelay(failed), failed, c.opts.MaxAttempts, err)
+	}
+	if ackErr := msg.Ack(false); ackErr != nil {
+		// The message was moved, but is also delivered again
+		log.Printf("Failed to acknowledge message %d from %s: %v", msg.DeliveryTag, queueName, ackErr)
+	}
+}
@@ -0,0 +1,114 @@
+// Package watch fans payment status changes out to the clients watching them.
+package watch
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Go-payments/internal/lifecycle"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before it is dropped
+const subscriberBuffer = 16
+
+// Event is a status change of a payment
+type Event struct {
+	TransactionID string
+	From          lifecycle.Status
+	To            lifecycle.Status
+	Reason        string
+	ChainTxHash   string
+	OccurredAt    time.Time
+}
+
+// Hub delivers the events published for a payment to everyone subscribed to it. It only sees the
+// transitions made by this process, so every writer of payment statuses must publish to it; watchers
+// also poll the status history for the transitions made by other replicas.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+	closed      bool
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[string]map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving the events of a payment and a function that ends the
+// subscription. The channel is closed when the subscription ends, the subscriber falls too far behind
+// or the hub is closed.
+func (h *Hub) Subscribe(transactionID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subscribers[transactionID] == nil {
+		h.subscribers[transactionID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[transactionID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.remove(transactionID, ch)
+		})
+	}
+}
+
+// Publish delivers an event to the payment's subscribers without blocking; subscribers whose buffer
+// is full are dropped so one stuck client cannot hold up status updates
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[e.TransactionID] {
+		select {
+		case ch <- e:
+		default:
+			log.Printf("Dropping slow watcher of payment %s", e.TransactionID)
+			h.remove(e.TransactionID, ch)
+		}
+	}
+}
+
+// Close ends every subscription and refuses new ones, so watchers let go of the server on shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for transactionID, subs := range h.subscribers {
+		for ch := range subs {
+			h.remove(transactionID, ch)
+		}
+	}
+}
+
+// Closed reports whether Close was called, to tell a shutdown from a subscriber falling behind
+func (h *Hub) Closed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+// remove unregisters and closes a subscriber's channel if it is still registered; h.mu must be held
+func (h *Hub) remove(transactionID string, ch chan Event) {
+	subs := h.subscribers[transactionID]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(h.subscribers, transactionID)
+	}
+}
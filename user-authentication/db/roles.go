@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Roles a user can hold
+const (
+	RoleUser    = "user"    // Makes and refunds their own payments; given to everyone on signup
+	RoleSupport = "support" // Looks at anyone's payments without being able to change them
+	RoleAdmin   = "admin"   // Everything, including the ledger
+	RoleService = "service" // Settlement services moving payments through their lifecycle
+)
+
+// rolePermissions are the permissions each role grants, as enforced by payment-service
+var rolePermissions = map[string][]string{
+	RoleUser:    {"payments:create", "payments:refund", "payments:read"},
+	RoleSupport: {"payments:read", "payments:read:all"},
+	RoleAdmin:   {"payments:create", "payments:refund", "payments:read", "payments:read:all", "payments:status:update", "ledger:read"},
+	RoleService: {"payments:read", "payments:read:all", "payments:status:update"},
+}
+
+// ErrUnknownRole is returned when assigning a role that does not exist
+var ErrUnknownRole = errors.New("unknown role")
+
+// ErrUserNotFound is returned when assigning a role to a user that does not exist
+var ErrUserNotFound = errors.New("user not found")
+
+// CreateRoleTablesIfNotExists creates the role tables, brings the built-in roles' permissions up to
+// date and gives users without any role the default one
+func CreateRoleTablesIfNotExists(db *pgxpool.Pool) error {
+	ctx := context.Background()
+	createTablesQuery := `
+	CREATE TABLE IF NOT EXISTS roles (
+		name VARCHAR(32) PRIMARY KEY
+	);
+
+	CREATE TABLE IF NOT EXISTS role_permissions (
+		role VARCHAR(32) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+		permission VARCHAR(64) NOT NULL,
+		PRIMARY KEY (role, permission)
+	);
+
+	CREATE TABLE IF NOT EXISTS user_roles (
+		username VARCHAR(255) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+		role VARCHAR(32) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+		PRIMARY KEY (username, role)
+	);
+	`
+	if _, err := db.Exec(ctx, createTablesQuery); err != nil {
+		return fmt.Errorf("failed to create role tables: %v", err)
+	}
+
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		for role, permissions := range rolePermissions {
+			if _, err := tx.Exec(ctx, `INSERT INTO roles (name) VALUES ($1) ON CONFLICT DO NOTHING`, role); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM role_permissions WHERE role = $1 AND NOT (permission = ANY($2))`, role, permissions); err != nil {
+				return err
+			}
+			for _, permission := range permissions {
+				if _, err := tx.Exec(ctx, `INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING`, role, permission); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Users who signed up before roles existed
+		_, err := tx.Exec(ctx, `
+			INSERT INTO user_roles (username, role)
+			SELECT username, $1 FROM users u
+			WHERE NOT EXISTS (SELECT 1 FROM user_roles r WHERE r.username = u.username)`,
+			RoleUser)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seed roles: %v", err)
+	}
+	log.Println("Checked for role tables and created them if they did not exist")
+	return nil
+}
+
+// UserGrants returns the roles of a user and the permissions they carry, both sorted
+func UserGrants(ctx context.Context, db *pgxpool.Pool, username string) ([]string, []string, error) {
+	rows, err := db.Query(ctx, `SELECT role FROM user_roles WHERE username = $1 ORDER BY role`, username)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load roles: %v", err)
+	}
+	roles, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load roles: %v", err)
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT DISTINCT p.permission FROM user_roles r
+		JOIN role_permissions p ON p.role = r.role
+		WHERE r.username = $1 ORDER BY p.permission`,
+		username)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load permissions: %v", err)
+	}
+	permissions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load permissions: %v", err)
+	}
+	return roles, permissions, nil
+}
+
+// GrantRole gives a user a role. Tokens issued afterwards (including on refresh) carry it.
+func GrantRole(ctx context.Context, db *pgxpool.Pool, username, role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownRole, role)
+	}
+	var exists bool
+	if err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`, username).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up user: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+
+	_, err := db.Exec(ctx, `INSERT INTO user_roles (username, role) VALUES ($1, $2) ON CONFLICT DO NOTHING`, username, role)
+	if err != nil {
+		return fmt.Errorf("failed to grant role: %v", err)
+	}
+	return nil
+}
+
+// RevokeRole takes a role away from a user. Access tokens already issued keep it until they expire.
+func RevokeRole(ctx context.Context, db *pgxpool.Pool, username, role string) error {
+	_, err := db.Exec(ctx, `DELETE FROM user_roles WHERE username = $1 AND role = $2`, username, role)
+	if err != nil {
+		return fmt.Errorf("failed to revoke role: %v", err)
+	}
+	return nil
+}
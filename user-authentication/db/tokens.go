@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrRefreshTokenInvalid is returned for refresh tokens that are unknown or expired
+var ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+
+// ErrRefreshTokenReused is returned when a refresh token that was already exchanged (or revoked) is
+// presented again. Its whole family has been revoked by the time this is returned.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// RefreshToken is a refresh token as stored server-side. Only a hash of the token itself is kept.
+//
+// Every login starts a family; each refresh exchanges the presented token for a new one in the
+// same family and records the access token issued alongside it, so a family can be revoked as a whole.
+type RefreshToken struct {
+	Hash            string
+	FamilyID        string
+	Username        string
+	AccessTokenID   string    // "jti" of the access token issued with this refresh token
+	AccessExpiresAt time.Time // Expiry of that access token
+	ExpiresAt       time.Time
+}
+
+// CreateTokenTablesIfNotExists creates the refresh token and revoked token tables
+func CreateTokenTablesIfNotExists(db *pgxpool.Pool) error {
+	createTablesQuery := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token_hash TEXT PRIMARY KEY,
+		family_id TEXT NOT NULL,
+		username VARCHAR(255) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+		access_jti TEXT NOT NULL,
+		access_expires_at TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		used_at TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	);
+	CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family_id);
+	CREATE INDEX IF NOT EXISTS refresh_tokens_access_jti_idx ON refresh_tokens (access_jti);
+
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti TEXT PRIMARY KEY,
+		expires_at TIMESTAMPTZ NOT NULL
+	);
+	`
+
+	_, err := db.Exec(context.Background(), createTablesQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create token tables: %v", err)
+	}
+	log.Println("Checked for token tables and created them if they did not exist")
+	return nil
+}
+
+// SaveRefreshToken stores a newly issued refresh token
+func SaveRefreshToken(ctx context.Context, db *pgxpool.Pool, t RefreshToken) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO refresh_tokens (token_hash, family_id, username, access_jti, access_expires_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		t.Hash, t.FamilyID, t.Username, t.AccessTokenID, t.AccessExpiresAt, t.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save refresh token: %v", err)
+	}
+	return nil
+}
+
+// UseRefreshToken marks a refresh token as exchanged and returns it. A single statement claims the
+// token, so two concurrent refreshes with the same token cannot both succeed; presenting a token that
+// was already used or revoked revokes its family and returns ErrRefreshTokenReused.
+func UseRefreshToken(ctx context.Context, db *pgxpool.Pool, hash string) (RefreshToken, error) {
+	t := RefreshToken{Hash: hash}
+	err := db.QueryRow(ctx, `
+		UPDATE refresh_tokens SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+		RETURNING family_id, username, access_jti, access_expires_at, expires_at`,
+		hash).Scan(&t.FamilyID, &t.Username, &t.AccessTokenID, &t.AccessExpiresAt, &t.ExpiresAt)
+	if err == nil {
+		return t, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return RefreshToken{}, fmt.Errorf("failed to use refresh token: %v", err)
+	}
+
+	// Not claimable: find out whether it is unknown, expired or being replayed
+	var familyID string
+	var exchanged bool
+	err = db.QueryRow(ctx, `
+		SELECT family_id, used_at IS NOT NULL OR revoked_at IS NOT NULL FROM refresh_tokens WHERE token_hash = $1`,
+		hash).Scan(&familyID, &exchanged)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RefreshToken{}, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to look up refresh token: %v", err)
+	}
+	if !exchanged {
+		return RefreshToken{}, ErrRefreshTokenInvalid // Expired
+	}
+
+	if err := RevokeTokenFamily(ctx, db, familyID); err != nil {
+		return RefreshToken{}, err
+	}
+	return RefreshToken{}, ErrRefreshTokenReused
+}
+
+// FindRefreshTokenFamily returns the family a refresh token belongs to
+func FindRefreshTokenFamily(ctx context.Context, db *pgxpool.Pool, hash string) (string, error) {
+	var familyID string
+	err := db.QueryRow(ctx, `SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, hash).Scan(&familyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up refresh token: %v", err)
+	}
+	return familyID, nil
+}
+
+// FindAccessTokenFamily returns the family of the refresh token an access token was issued with
+func FindAccessTokenFamily(ctx context.Context, db *pgxpool.Pool, jti string) (string, error) {
+	var familyID string
+	err := db.QueryRow(ctx, `SELECT family_id FROM refresh_tokens WHERE access_jti = $1`, jti).Scan(&familyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up access token: %v", err)
+	}
+	return familyID, nil
+}
+
+// RevokeTokenFamily revokes every refresh token of a family and puts the access tokens issued
+// with them that have not expired yet on the revocation list
+func RevokeTokenFamily(ctx context.Context, db *pgxpool.Pool, familyID string) error {
+	_, err := db.Exec(ctx, `
+		WITH revoked AS (
+			UPDATE refresh_tokens SET revoked_at = now()
+			WHERE family_id = $1 AND revoked_at IS NULL
+			RETURNING access_jti, access_expires_at
+		)
+		INSERT INTO revoked_tokens (jti, expires_at)
+		SELECT access_jti, access_expires_at FROM revoked WHERE access_expires_at > now()
+		ON CONFLICT (jti) DO NOTHING`,
+		familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token family: %v", err)
+	}
+	return nil
+}
+
+// RevokeAccessToken puts a single access token on the revocation list until it expires
+func RevokeAccessToken(ctx context.Context, db *pgxpool.Pool, jti string, expiresAt time.Time) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`,
+		jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %v", err)
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether the access token with the given ID is on the revocation list
+func IsTokenRevoked(ctx context.Context, db *pgxpool.Pool, jti string) (bool, error) {
+	var revoked bool
+	err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up revoked token: %v", err)
+	}
+	return revoked, nil
+}
+
+// RevokedToken is an access token revoked before its expiry
+type RevokedToken struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// PruneExpiredTokens deletes refresh tokens and revocations that expired. Exchanged refresh tokens are
+// kept until then so that replaying them is still detected; revocations of expired access tokens are
+// no longer needed, as verifiers reject those anyway.
+func PruneExpiredTokens(ctx context.Context, db *pgxpool.Pool) error {
+	if _, err := db.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at <= now()`); err != nil {
+		return fmt.Errorf("failed to prune refresh tokens: %v", err)
+	}
+	if _, err := db.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= now()`); err != nil {
+		return fmt.Errorf("failed to prune revoked tokens: %v", err)
+	}
+	return nil
+}
+
+// ListRevokedTokens returns the revoked access tokens that have not expired yet
+func ListRevokedTokens(ctx context.Context, db *pgxpool.Pool) ([]RevokedToken, error) {
+	rows, err := db.Query(ctx, `SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > now() ORDER BY expires_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revoked tokens: %v", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (RevokedToken, error) {
+		var t RevokedToken
+		err := row.Scan(&t.ID, &t.ExpiresAt)
+		return t, err
+	})
+}
@@ -0,0 +1,211 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// SigningKey is a private key tokens are signed with, identified by the "kid" token header
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod // RS256 for RSA keys, EdDSA for Ed25519 keys
+	Signer crypto.Signer
+}
+
+// KeySet holds every key whose tokens are still accepted, and the one new tokens are signed with.
+//
+// Keys are PEM files in a directory, named after their key ID (e.g., "2026-10-18.pem"). Unless a key
+// ID is pinned, the key whose ID sorts last is active, so rotating means adding a newer file and
+// reloading; the old key keeps verifying (and stays in the JWKS) until its file is removed.
+type KeySet struct {
+	dir      string
+	activeID string
+
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// LoadKeySet loads the keys in dir. activeID pins the signing key; empty selects the newest.
+func LoadKeySet(dir, activeID string) (*KeySet, error) {
+	ks := &KeySet{dir: dir, activeID: activeID}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// NewEphemeralKeySet generates a single Ed25519 key that lives as long as the process.
+// Tokens stop verifying on restart, so it is only meant for local development.
+func NewEphemeralKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key ID: %v", err)
+	}
+	key := &SigningKey{ID: "ephemeral-" + hex.EncodeToString(id), Method: jwt.SigningMethodEdDSA, Signer: private}
+	return &KeySet{active: key, keys: map[string]*SigningKey{key.ID: key}}, nil
+}
+
+// Reload re-reads the key directory, picking up added and removed keys. On error the current keys stay in use.
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("failed to list keys: %v", err)
+	}
+	keys := make(map[string]*SigningKey, len(paths))
+	var ids []string
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return err
+		}
+		keys[key.ID] = key
+		ids = append(ids, key.ID)
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("no signing keys (*.pem) in %s", ks.dir)
+	}
+	sort.Strings(ids)
+
+	activeID := ks.activeID
+	if activeID == "" {
+		activeID = ids[len(ids)-1]
+	}
+	active, ok := keys[activeID]
+	if !ok {
+		return fmt.Errorf("active key %q not found in %s", activeID, ks.dir)
+	}
+
+	ks.mu.Lock()
+	ks.keys, ks.active = keys, active
+	ks.mu.Unlock()
+	return nil
+}
+
+// loadSigningKey reads a PKCS#8 or PKCS#1 PEM private key; the key ID is the file name without ".pem"
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	id := strings.TrimSuffix(filepath.Base(path), ".pem")
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%s: RSA keys must be at least 2048 bits", path)
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Signer: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Signer: key}, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T, use RSA or Ed25519", path, parsed)
+	}
+}
+
+// Active returns the key new tokens are signed with
+func (ks *KeySet) Active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+// Key looks up a key by ID
+func (ks *KeySet) Key(id string) (*SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[id]
+	return key, ok
+}
+
+// JWK is the public half of a signing key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of every key in the set, sorted by ID
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		jwk, err := key.publicJWK()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+func (k *SigningKey) publicJWK() (JWK, error) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch public := k.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return JWK{}, errors.New("unsupported key type")
+	}
+	return jwk, nil
+}
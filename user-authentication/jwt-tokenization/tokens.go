@@ -1,5 +1,11 @@
 package token
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	// "log"
 	"net/http"
@@ -11,7 +17,21 @@ import (
 	// "golang.org/x/crypto/bcrypt"
 	// "context"
 )
-var mySigningKey = []byte("107db0dc9d4fd8b8cc0387f816d5e1ecb6c8183ce7fee4825cfe4e8dc99a2c464ea772daf6cbe8f4507b144bd1898861aac5f80923b2c7345fcbcf17078b2c45ad2e7a902b303349846578d1d4793155d8a9757bc91a09578a6e971d8882a1178f9ee9b3c0b32919aac08c8f610de126e117d0e05522a18a23251d2b4f1ac3366bbd68c4050526c8d2c5fd2dccd683ea982642f4ee53ba569482a46cb2320f603aff011acc6dc5f6a0b2222fb0d52346e4454325a712e60e5942b2f441a7dbcfb9f9e440054f271c86ecc060280fbd1262522fe6e920eb859fb1afefbf93451af705c5d70f6285a327a2ce80cd4ac2c7f754c73a04ed1aaf93cb132e4e80b7f5")
+
+// Issuer signs and validates access tokens.
+// Tokens carry the standard claims: sub (the username), iss, aud, iat, exp and a unique jti,
+// plus the user's roles and the permissions they grant.
+type Issuer struct {
+	Keys       *KeySet
+	Name       string        // "iss" claim, checked by verifiers
+	Audience   []string      // "aud" claim, the services the tokens are meant for
+	TTL        time.Duration // How long an access token stays valid; keep it short, refresh tokens renew it
+	RefreshTTL time.Duration // How long a refresh token can be exchanged for a new access token
+
+	// IsRevoked reports whether the access token with the given ID was revoked before it expired.
+	// Tokens are not checked against a revocation list if it is nil.
+	IsRevoked func(ctx context.Context, jti string) (bool, error)
+}
 
 // Struct for representing user data (for JWT payload)
 type User struct {
@@ -21,62 +41,147 @@ type User struct {
 
 // Custom claims for JWT token
 type Claims struct {
-	Username string `json:"username"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"` // What the roles allow; services enforce these
 	jwt.RegisteredClaims
 }
 
 
 // Helper function to generate JWT token
-func GenerateJWT(username string) (string, error) {
+// The claims are returned alongside, so the token can be tracked by its ID and expiry.
+func (i *Issuer) GenerateJWT(username string, roles, permissions []string) (string, *Claims, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
 	claims := &Claims{
-		Username: username,
+		Roles:       roles,
+		Permissions: permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token expires in 24 hours
+			Subject:   username,
+			Issuer:    i.Name,
+			Audience:  i.Audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.TTL)),
+			ID:        jti,
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(mySigningKey)
+	key := i.Keys.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.Signer)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return tokenString, nil
+	return tokenString, claims, nil
+}
+
+// newTokenID returns a random "jti" so every token can be told apart (and later revoked)
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewFamilyID returns a random ID for a new refresh token family (one per login)
+func NewFamilyID() (string, error) {
+	return newTokenID()
+}
+
+// NewRefreshToken returns an opaque refresh token and the hash it is stored under.
+// Only the hash is persisted, so a leaked database does not hand out usable tokens.
+func NewRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(b)
+	return refreshToken, HashRefreshToken(refreshToken), nil
+}
+
+// HashRefreshToken returns the hash a refresh token is stored and looked up under
+func HashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
 }
 
-// Helper function to validate JWT token
-func ValidateJWT(tokenStr string) (*Claims, error) {
+// ErrTokenRevoked is returned when validating an access token revoked on logout
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// Helper function to validate JWT token; any key still in the key set is accepted, and revoked tokens are rejected
+func (i *Issuer) ValidateJWT(ctx context.Context, tokenStr string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return mySigningKey, nil
+		kid, _ := token.Header["kid"].(string)
+		key, ok := i.Keys.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.Signer.Public(), nil
 	})
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
-	return nil, err
+	if !claims.VerifyIssuer(i.Name, true) {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if i.IsRevoked != nil {
+		revoked, err := i.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
 }
 
 // Middleware to validate JWT token for protected routes
-func TokenValidationMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+func (i *Issuer) TokenValidationMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		tokenString := c.Request().Header.Get("Authorization")
+		tokenString := BearerToken(c)
 		if tokenString == "" {
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Missing token"})
 		}
 
-		if len(tokenString) > 7 && strings.ToUpper(tokenString[:7]) == "BEARER " {
-			tokenString = tokenString[7:]
-		}
-
-		claims, err := ValidateJWT(tokenString)
+		claims, err := i.ValidateJWT(c.Request().Context(), tokenString)
 		if err != nil {
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token"})
 		}
 
-		c.Set("username", claims.Username)
+		c.Set("username", claims.Subject)
 		return next(c)
 	}
 }
 
+// BearerToken returns the token of the request's Authorization header, or "" if there is none
+func BearerToken(c echo.Context) string {
+	tokenString := c.Request().Header.Get("Authorization")
+	if len(tokenString) > 7 && strings.ToUpper(tokenString[:7]) == "BEARER " {
+		tokenString = tokenString[7:]
+	}
+	return tokenString
+}
+
 // Protected route handler
 func ProtectedHandler(c echo.Context) error {
 	username := c.Get("username").(string)
 	return c.String(http.StatusOK, fmt.Sprintf("Hello, %s! You have accessed a protected route.", username))
 }
+
+// JWKSHandler serves the public keys tokens can be verified with at /.well-known/jwks.json
+func (i *Issuer) JWKSHandler(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, i.Keys.JWKS())
+}
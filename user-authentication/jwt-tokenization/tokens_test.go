@@ -0,0 +1,46 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateJWTRejectsRevokedTokens(t *testing.T) {
+	keys, err := NewEphemeralKeySet()
+	if err != nil {
+		t.Fatalf("NewEphemeralKeySet: %v", err)
+	}
+	revoked := map[string]bool{}
+	issuer := &Issuer{
+		Keys:     keys,
+		Name:     "user-authentication",
+		Audience: []string{"payment-service"},
+		TTL:      time.Minute,
+		IsRevoked: func(ctx context.Context, jti string) (bool, error) {
+			return revoked[jti], nil
+		},
+	}
+
+	token, claims, err := issuer.GenerateJWT("alice", nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	if _, err := issuer.ValidateJWT(context.Background(), token); err != nil {
+		t.Fatalf("ValidateJWT before logout: %v", err)
+	}
+
+	revoked[claims.ID] = true
+	if _, err := issuer.ValidateJWT(context.Background(), token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("ValidateJWT after logout = %v, want ErrTokenRevoked", err)
+	}
+
+	// A revocation list that cannot be read fails validation rather than letting the token through
+	issuer.IsRevoked = func(ctx context.Context, jti string) (bool, error) {
+		return false, errors.New("database unavailable")
+	}
+	if _, err := issuer.ValidateJWT(context.Background(), token); err == nil {
+		t.Error("ValidateJWT accepted a token it could not check against the revocation list")
+	}
+}
@@ -9,15 +9,82 @@ import (
 	"github.com/labstack/echo/v4"
 "github.com/labstack/echo/v4/middleware"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	// "strings"
 	"golang.org/x/crypto/bcrypt"
 	token	"user-auth/jwt-tokenization"
 	database "user-auth/db"
 	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 
-var db *pgx.Conn
+var db *pgxpool.Pool
+
+// draining is set once shutdown begins, so readiness fails while in-flight requests finish
+var draining atomic.Bool
+
+// tokens signs the access tokens handed out on signup and login
+var tokens *token.Issuer
+
+// getEnv returns the environment variable, or fallback when it is unset
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// newIssuer configures token signing from the environment.
+// AUTH_KEYS_DIR holds the PEM signing keys (see token.KeySet); without it a throwaway key is generated.
+func newIssuer() (*token.Issuer, error) {
+	var keys *token.KeySet
+	var err error
+	if dir := os.Getenv("AUTH_KEYS_DIR"); dir != "" {
+		keys, err = token.LoadKeySet(dir, os.Getenv("AUTH_ACTIVE_KID"))
+	} else {
+		log.Println("AUTH_KEYS_DIR is not set, signing tokens with an ephemeral key that is lost on restart")
+		keys, err = token.NewEphemeralKeySet()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := time.ParseDuration(getEnv("AUTH_TOKEN_TTL", "15m"))
+	if err != nil {
+		return nil, err
+	}
+	refreshTTL, err := time.ParseDuration(getEnv("AUTH_REFRESH_TOKEN_TTL", "720h"))
+	if err != nil {
+		return nil, err
+	}
+	return &token.Issuer{
+		Keys:       keys,
+		Name:       getEnv("AUTH_ISSUER", "user-authentication"),
+		Audience:   strings.Split(getEnv("AUTH_AUDIENCE", "payment-service"), ","),
+		TTL:        ttl,
+		RefreshTTL: refreshTTL,
+	}, nil
+}
+
+// reloadKeysOnHangup re-reads the signing keys on SIGHUP, so keys can be rotated without a restart
+func reloadKeysOnHangup(keys *token.KeySet) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := keys.Reload(); err != nil {
+			log.Printf("Failed to reload signing keys: %v", err)
+			continue
+		}
+		log.Printf("Reloaded signing keys, signing with %s", keys.Active().ID)
+	}
+}
 
 // Register a new user
 func RegisterUser(username, password string) error {
@@ -62,35 +129,50 @@ func SignupHandler(c echo.Context) error {
 	err := db.QueryRow(context.Background(), "SELECT username FROM users WHERE username = $1", user.Username).Scan(&existingUser.Username)
 	if err == nil {
 		// Username already exists
+		signupsTotal.WithLabelValues("conflict").Inc()
 		return c.JSON(http.StatusConflict, map[string]string{"error": "Username already exists"})
 	} else if err != pgx.ErrNoRows {
 		// Database error
+		signupsTotal.WithLabelValues("error").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
 
 	// Hash the user's password before storing it
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
+		signupsTotal.WithLabelValues("error").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Error hashing password"})
 	}
 
 	// Insert the new user into the database
 	_, err = db.Exec(context.Background(), "INSERT INTO users (username, password) VALUES ($1, $2)", user.Username, hashedPassword)
 	if err != nil {
+		signupsTotal.WithLabelValues("error").Inc()
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create user"})
+	}
+
+	// New users can pay and see their own payments; other roles are granted by an administrator
+	if err := database.GrantRole(c.Request().Context(), db, user.Username, database.RoleUser); err != nil {
+		signupsTotal.WithLabelValues("error").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create user"})
 	}
 
-	// Optionally, generate a JWT token for the user
-	token, err := token.GenerateJWT(user.Username)
+	// Optionally, generate a JWT token for the user, starting a new refresh token family
+	familyID, err := token.NewFamilyID()
 	if err != nil {
+		signupsTotal.WithLabelValues("error").Inc()
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not generate token"})
+	}
+	response, err := issueTokens(c.Request().Context(), user.Username, familyID)
+	if err != nil {
+		signupsTotal.WithLabelValues("error").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not generate token"})
 	}
 
-	// Return a success message with the generated token
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "User created successfully",
-		"token":   token,
-	})
+	// Return a success message with the generated tokens
+	response.Message = "User created successfully"
+	signupsTotal.WithLabelValues("success").Inc()
+	return c.JSON(http.StatusOK, response)
 }
 
 // Login handler to authenticate the user and return a JWT
@@ -103,21 +185,224 @@ func LoginHandler(c echo.Context) error {
 	// Authenticate user from the database
 	valid, err := AuthenticateUser(user.Username, user.Password)
 	if err != nil {
+		loginsTotal.WithLabelValues("error").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
 
 	if !valid {
+		loginsTotal.WithLabelValues("invalid_credentials").Inc()
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid username or password"})
 	}
 
-	// User authenticated, generate JWT
-	token, err := token.GenerateJWT(user.Username)
+	// User authenticated, generate JWT; every login starts a new refresh token family
+	familyID, err := token.NewFamilyID()
 	if err != nil {
+		loginsTotal.WithLabelValues("error").Inc()
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create token"})
+	}
+	response, err := issueTokens(c.Request().Context(), user.Username, familyID)
+	if err != nil {
+		loginsTotal.WithLabelValues("error").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create token"})
 	}
 
 	// Return JWT to the client
-	return c.JSON(http.StatusOK, map[string]string{"token": token})
+	loginsTotal.WithLabelValues("success").Inc()
+	return c.JSON(http.StatusOK, response)
+}
+
+// tokenResponse is returned whenever tokens are issued
+type tokenResponse struct {
+	Message      string `json:"message,omitempty"`
+	Token        string `json:"token"`         // Access token
+	RefreshToken string `json:"refresh_token"` // Exchanged at /refresh for a new pair; single use
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds until the access token expires
+}
+
+// issueTokens issues an access token and a refresh token in the given family, storing the refresh token
+func issueTokens(ctx context.Context, username, familyID string) (*tokenResponse, error) {
+	// Roles are looked up on every issue, so changes apply from the next refresh
+	roles, permissions, err := database.UserGrants(ctx, db, username)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, claims, err := tokens.GenerateJWT(username, roles, permissions)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, refreshHash, err := token.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.SaveRefreshToken(ctx, db, database.RefreshToken{
+		Hash:            refreshHash,
+		FamilyID:        familyID,
+		Username:        username,
+		AccessTokenID:   claims.ID,
+		AccessExpiresAt: claims.ExpiresAt.Time,
+		ExpiresAt:       time.Now().Add(tokens.RefreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tokens.TTL.Seconds()),
+	}, nil
+}
+
+// refreshRequest carries the refresh token for /refresh and /logout
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh handler to exchange a refresh token for a new access and refresh token.
+// Refresh tokens are single use: presenting one a second time means it was stolen (or the client
+// misbehaves), so the whole family is revoked and the user has to log in again.
+func RefreshHandler(c echo.Context) error {
+	var req refreshRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ctx := c.Request().Context()
+	used, err := database.UseRefreshToken(ctx, db, token.HashRefreshToken(req.RefreshToken))
+	if errors.Is(err, database.ErrRefreshTokenReused) {
+		log.Println("Refresh token reuse detected, revoked its token family")
+		refreshesTotal.WithLabelValues("reused").Inc()
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Refresh token was already used, please log in again"})
+	}
+	if errors.Is(err, database.ErrRefreshTokenInvalid) {
+		refreshesTotal.WithLabelValues("invalid").Inc()
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired refresh token"})
+	}
+	if err != nil {
+		log.Printf("Failed to refresh token: %v", err)
+		refreshesTotal.WithLabelValues("error").Inc()
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	response, err := issueTokens(ctx, used.Username, used.FamilyID)
+	if err != nil {
+		refreshesTotal.WithLabelValues("error").Inc()
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create token"})
+	}
+	refreshesTotal.WithLabelValues("success").Inc()
+	return c.JSON(http.StatusOK, response)
+}
+
+// Logout handler to end a session. The session is found by its refresh token or, failing that, the
+// access token the request was made with; its refresh token family is revoked, along with every
+// access token issued in it.
+func LogoutHandler(c echo.Context) error {
+	var req refreshRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	accessToken := token.BearerToken(c)
+	if req.RefreshToken == "" && accessToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "A refresh token or access token is required"})
+	}
+
+	ctx := c.Request().Context()
+	var familyID string
+	var err error
+	if req.RefreshToken != "" {
+		familyID, err = database.FindRefreshTokenFamily(ctx, db, token.HashRefreshToken(req.RefreshToken))
+	} else {
+		claims, validateErr := tokens.ValidateJWT(ctx, accessToken)
+		if validateErr != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token"})
+		}
+		familyID, err = database.FindAccessTokenFamily(ctx, db, claims.ID)
+		if errors.Is(err, database.ErrRefreshTokenInvalid) {
+			// Issued before refresh tokens existed; all there is to revoke is the token itself
+			err = database.RevokeAccessToken(ctx, db, claims.ID, claims.ExpiresAt.Time)
+			familyID = ""
+		}
+	}
+	if errors.Is(err, database.ErrRefreshTokenInvalid) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+	}
+	if err == nil && familyID != "" {
+		err = database.RevokeTokenFamily(ctx, db, familyID)
+	}
+	if err != nil {
+		log.Printf("Failed to log out: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// Revoked handler listing the IDs of access tokens revoked before they expire. Services verifying
+// tokens poll it.
+func RevokedHandler(c echo.Context) error {
+	revoked, err := database.ListRevokedTokens(c.Request().Context(), db)
+	if err != nil {
+		log.Printf("Failed to list revoked tokens: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	type revokedToken struct {
+		ID        string `json:"jti"`
+		ExpiresAt int64  `json:"exp"`
+	}
+	response := struct {
+		Revoked []revokedToken `json:"revoked"`
+	}{Revoked: make([]revokedToken, 0, len(revoked))}
+	for _, t := range revoked {
+		response.Revoked = append(response.Revoked, revokedToken{ID: t.ID, ExpiresAt: t.ExpiresAt.Unix()})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// pruneExpiredTokens deletes expired refresh tokens and revocations on startup and then every interval
+// until ctx is canceled
+func pruneExpiredTokens(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := database.PruneExpiredTokens(ctx, db); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to prune expired tokens: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Liveness handler, answering as long as the server is up
+func LivezHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readiness handler, failing when the database cannot be reached or the server is shutting down
+func ReadyzHandler(c echo.Context) error {
+	if draining.Load() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"status": "shutting down"})
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 2*time.Second)
+	defer cancel()
+	if err := db.Ping(ctx); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "unavailable",
+			"checks": map[string]string{"postgres": err.Error()},
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "ready",
+		"checks": map[string]string{"postgres": "ok"},
+	})
 }
 
 func main() {
@@ -126,26 +411,87 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer dbConn.Close(context.Background())
+	defer dbConn.Close()
 	db=dbConn
 
 	// Ensure that the 'users' table exists
 	if err := database.CreateTableIfNotExists(dbConn); err != nil {
 		log.Fatal(err)
 	}
+	if err := database.CreateTokenTablesIfNotExists(dbConn); err != nil {
+		log.Fatal(err)
+	}
+	if err := database.CreateRoleTablesIfNotExists(dbConn); err != nil {
+		log.Fatal(err)
+	}
+
+	// "roles grant|revoke|list ..." manages roles without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "roles" {
+		if err := runRolesCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	issuer, err := newIssuer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	issuer.IsRevoked = func(ctx context.Context, jti string) (bool, error) {
+		return database.IsTokenRevoked(ctx, db, jti)
+	}
+	tokens = issuer
+	go reloadKeysOnHangup(issuer.Keys)
 
 	// Create a new Echo instance
 	e := echo.New()
 
 e.Use(middleware.Logger())
+	e.Use(metricsMiddleware)
 	// Define routes
 	e.POST("/login", LoginHandler)
 	e.POST("/signup", SignupHandler)
+	e.POST("/refresh", RefreshHandler)
+	e.POST("/logout", LogoutHandler)
+	e.GET("/revoked", RevokedHandler)
 	
-e.GET("/protected", token.TokenValidationMiddleware(token.ProtectedHandler))
+e.GET("/protected", tokens.TokenValidationMiddleware(token.ProtectedHandler))
+	e.GET("/.well-known/jwks.json", tokens.JWKSHandler)
+	e.GET("/livez", LivezHandler)
+	e.GET("/readyz", ReadyzHandler)
+	e.GET("/metrics", MetricsHandler)
 
+	shutdownTimeout, err := time.ParseDuration(getEnv("AUTH_SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	pruneInterval, err := time.ParseDuration(getEnv("AUTH_PRUNE_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Start the server; SIGINT or SIGTERM stops it once in-flight requests are done
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Start the server
-	log.Println("Server running on http://localhost:8080")
-	e.Logger.Fatal(e.Start(":8080"))
+	go pruneExpiredTokens(ctx, pruneInterval)
+
+	addr := getEnv("AUTH_ADDR", ":8081")
+	go func() {
+		log.Printf("Server running on %s", addr)
+		if err := e.Start(addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop() // A second signal kills the process right away
+	log.Printf("Shutting down, waiting up to %s for in-flight requests...", shutdownTimeout)
+	draining.Store(true)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server did not shut down cleanly: %v", err)
+	}
 }
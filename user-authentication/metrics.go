@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsRegistry holds the metrics served at /metrics
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	// loginsTotal counts login attempts by result: success, invalid_credentials or error
+	loginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "logins_total",
+		Help:      "Login attempts, by result (success, invalid_credentials, error).",
+	}, []string{"result"})
+
+	// signupsTotal counts signups by result: success, conflict or error
+	signupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "signups_total",
+		Help:      "Signup attempts, by result (success, conflict, error).",
+	}, []string{"result"})
+
+	// refreshesTotal counts refresh token exchanges by result: success, invalid, reused or error
+	refreshesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "token_refreshes_total",
+		Help:      "Refresh token exchanges, by result (success, invalid, reused, error).",
+	}, []string{"result"})
+
+	// httpDuration observes every request by route pattern and status
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "auth",
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		loginsTotal,
+		signupsTotal,
+		refreshesTotal,
+		httpDuration,
+	)
+}
+
+// MetricsHandler serves the metrics in the Prometheus exposition format
+var MetricsHandler = echo.WrapHandler(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{Registry: metricsRegistry}))
+
+// metricsMiddleware observes the duration and status of requests; requests matching no route share one label
+func metricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err) // Writes the response, so its status is known below
+		}
+
+		route := c.Path()
+		if route == "" || c.Response().Status == http.StatusNotFound && route == "/*" {
+			route = "unmatched"
+		}
+		httpDuration.WithLabelValues(c.Request().Method, route, strconv.Itoa(c.Response().Status)).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
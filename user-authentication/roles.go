@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	database "user-auth/db"
+)
+
+// runRolesCommand manages user roles from the command line:
+//
+//	roles grant <username> <role>
+//	roles revoke <username> <role>
+//	roles list <username>
+//
+// This is also how the first administrator is created, as roles cannot be granted over HTTP.
+func runRolesCommand(args []string) error {
+	ctx := context.Background()
+	usage := errors.New("usage: roles grant|revoke <username> <role>, or roles list <username>")
+	if len(args) < 2 {
+		return usage
+	}
+
+	action, username := args[0], args[1]
+	switch {
+	case action == "grant" && len(args) == 3:
+		if err := database.GrantRole(ctx, db, username, args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("Granted %s to %s\n", args[2], username)
+	case action == "revoke" && len(args) == 3:
+		if err := database.RevokeRole(ctx, db, username, args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %s from %s\n", args[2], username)
+	case action == "list" && len(args) == 2:
+		roles, permissions, err := database.UserGrants(ctx, db, username)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Roles:       %s\n", strings.Join(roles, ", "))
+		fmt.Printf("Permissions: %s\n", strings.Join(permissions, ", "))
+	default:
+		return usage
+	}
+	return nil
+}